@@ -0,0 +1,87 @@
+package drawgl
+
+import "fmt"
+
+// AlphaMode declares how the color channels of an image relate to its alpha
+// channel. The zero value is Premultiplied, which is what image/color
+// produces, and what operations combining neighbouring pixels expect.
+type AlphaMode int
+
+const (
+	// Premultiplied holds color channels already multiplied by alpha
+	Premultiplied AlphaMode = iota
+	// Straight holds color channels independent of alpha
+	Straight
+)
+
+func (m AlphaMode) String() string {
+	switch m {
+	case Premultiplied:
+		return "premultiplied"
+	case Straight:
+		return "straight"
+	default:
+		return fmt.Sprintf("AlphaMode(%d)", int(m))
+	}
+}
+
+// Premultiply returns the straight color with its channels multiplied by its
+// alpha.
+func (c FloatColor) Premultiply() FloatColor {
+	return FloatColor{R: c.R * c.A, G: c.G * c.A, B: c.B * c.A, A: c.A}
+}
+
+// Unpremultiply returns the premultiplied color with its channels divided by
+// its alpha. Fully transparent colors become transparent black.
+func (c FloatColor) Unpremultiply() FloatColor {
+	if c.A == 0 {
+		return FloatColor{}
+	}
+
+	return FloatColor{R: c.R / c.A, G: c.G / c.A, B: c.B / c.A, A: c.A}
+}
+
+// ClampPremultiplied clamps the alpha of a premultiplied color to the 0-1
+// range, and its color channels between 0 and the alpha, which filters with
+// negative lobes may overshoot.
+func (c FloatColor) ClampPremultiplied() FloatColor {
+	c.A = c.A.Clamped()
+
+	for _, v := range []*ColorValue{&c.R, &c.G, &c.B} {
+		if *v < 0 {
+			*v = 0
+		} else if *v > c.A {
+			*v = c.A
+		}
+	}
+
+	return c
+}
+
+// ConvertAlpha returns the image with the given alpha mode. The image itself
+// is returned if it already has that mode, otherwise a converted copy.
+func ConvertAlpha(img *FloatImage, mode AlphaMode) *FloatImage {
+	if img.Alpha == mode {
+		return img
+	}
+
+	dst := CopyImage(img)
+	dst.Alpha = mode
+
+	for y := dst.Rect.Min.Y; y < dst.Rect.Max.Y; y++ {
+		i := dst.PixOffset(dst.Rect.Min.X, y)
+		row := dst.Pix[i : i+4*dst.Rect.Dx()]
+
+		for j := 0; j < len(row); j += 4 {
+			c := FloatColor{R: row[j], G: row[j+1], B: row[j+2], A: row[j+3]}
+			if mode == Straight {
+				c = c.Unpremultiply()
+			} else {
+				c = c.Premultiply()
+			}
+			row[j], row[j+1], row[j+2], row[j+3] = c.R, c.G, c.B, c.A
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,50 @@
+package drawgl_test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/urandom/drawgl"
+)
+
+func TestConvertAlpha(t *testing.T) {
+	img := drawgl.NewFloatImage(image.Rect(0, 0, 2, 1))
+	img.UnsafeSetColor(0, 0, drawgl.FloatColor{R: 0.25, G: 0.5, B: 0, A: 0.5})
+	img.UnsafeSetColor(1, 0, drawgl.FloatColor{})
+
+	if drawgl.ConvertAlpha(img, drawgl.Premultiplied) != img {
+		t.Fatalf("Expected the image itself\n")
+	}
+
+	straight := drawgl.ConvertAlpha(img, drawgl.Straight)
+	if straight.Alpha != drawgl.Straight {
+		t.Fatalf("Expected a straight image, got %s\n", straight.Alpha)
+	}
+
+	if c := straight.FloatAt(0, 0); c != (drawgl.FloatColor{R: 0.5, G: 1, B: 0, A: 0.5}) {
+		t.Fatalf("Unexpected straight color %v\n", c)
+	}
+
+	if c := straight.FloatAt(1, 0); c != (drawgl.FloatColor{}) {
+		t.Fatalf("Expected transparent black, got %v\n", c)
+	}
+
+	// color.Color values are always premultiplied
+	if c := straight.At(0, 0).(drawgl.FloatColor); c != img.FloatAt(0, 0) {
+		t.Fatalf("Expected a premultiplied color, got %v\n", c)
+	}
+
+	straight.Set(1, 0, color.NRGBA{R: 255, A: 128})
+	if c := straight.FloatAt(1, 0); !c.ApproxEqual(drawgl.FloatColor{R: 1, A: 0.5}) {
+		t.Fatalf("Expected a straight color to be stored, got %v\n", c)
+	}
+
+	if c := drawgl.ConvertAlpha(straight, drawgl.Premultiplied).FloatAt(0, 0); c != img.FloatAt(0, 0) {
+		t.Fatalf("Expected the original color back, got %v\n", c)
+	}
+
+	if c := (drawgl.FloatColor{R: 0.8, G: -0.1, B: 0.2, A: 0.5}).ClampPremultiplied(); c != (drawgl.FloatColor{R: 0.5, G: 0, B: 0.2, A: 0.5}) {
+		t.Fatalf("Unexpected clamped color %v\n", c)
+	}
+}
@@ -0,0 +1,232 @@
+package drawgl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/urandom/graph"
+)
+
+// Batch processes a JSON graph definition once for every input file. The
+// definition is executed as a template for each input, with the input path
+// as its first argument, the output path as the second, followed by Args, so
+// that definitions written for drawgl-json can be used as they are. The two
+// paths are escaped for use inside a quoted JSON string.
+type Batch struct {
+	// Definition holds the JSON graph definition
+	Definition []byte
+	// Output is a text/template producing the output path of each input,
+	// executed with its BatchItem, as in "out/{{.Name}}.png"
+	Output string
+	Args   []string
+	// Overrides are applied to the definition of every input
+	Overrides []Override
+	// Workers is the number of inputs processed at the same time. It
+	// defaults to the number of CPUs.
+	Workers int
+	// Graph processes the graph of every input
+	Graph Graph
+	// Done, if not nil, is called after each input is processed, with the
+	// error it failed with. It may be called from multiple goroutines at
+	// the same time.
+	Done func(item BatchItem, err error)
+}
+
+// BatchItem describes an input of a batch.
+type BatchItem struct {
+	Index int
+	// Path is the path of the input file, and Dir its directory
+	Path string
+	Dir  string
+	// Base is the file name of the input, Name the file name without its
+	// extension, and Ext the extension, including the leading dot
+	Base string
+	Name string
+	Ext  string
+	// Output is the path produced by the output template
+	Output string
+}
+
+// BatchFailure holds the error that a batch input failed with.
+type BatchFailure struct {
+	Item BatchItem
+	Err  error
+}
+
+// BatchSummary holds the outcome of running a batch.
+type BatchSummary struct {
+	Processed int
+	// Failures are ordered by the index of their inputs
+	Failures []BatchFailure
+}
+
+// BatchInputs expands the given patterns into a sorted list of input files.
+// A pattern is either a directory, whose regular files are all included, or
+// a glob, as accepted by filepath.Glob.
+func BatchInputs(patterns ...string) ([]string, error) {
+	seen := make(map[string]bool)
+	var inputs []string
+
+	for _, pattern := range patterns {
+		var matches []string
+
+		if fi, err := os.Stat(pattern); err == nil && fi.IsDir() {
+			files, err := ioutil.ReadDir(pattern)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, f := range files {
+				if f.Mode().IsRegular() {
+					matches = append(matches, filepath.Join(pattern, f.Name()))
+				}
+			}
+		} else {
+			if matches, err = filepath.Glob(pattern); err != nil {
+				return nil, fmt.Errorf("expanding %q: %v", pattern, err)
+			}
+		}
+
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				inputs = append(inputs, m)
+			}
+		}
+	}
+
+	sort.Strings(inputs)
+
+	return inputs, nil
+}
+
+// Run processes the graph once for every input, continuing past the inputs
+// that fail. The returned error is only set if the batch could not be
+// started. Once the context is done, the remaining inputs fail with its
+// error.
+func (b Batch) Run(ctx context.Context, inputs []string) (BatchSummary, error) {
+	var summary BatchSummary
+
+	out, err := template.New("output").Parse(b.Output)
+	if err != nil {
+		return summary, fmt.Errorf("parsing output template: %v", err)
+	}
+
+	workers := b.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	items := make(chan BatchItem)
+	go func() {
+		defer close(items)
+
+		for i, path := range inputs {
+			base := filepath.Base(path)
+			ext := filepath.Ext(base)
+
+			items <- BatchItem{
+				Index: i,
+				Path:  path,
+				Dir:   filepath.Dir(path),
+				Base:  base,
+				Name:  strings.TrimSuffix(base, ext),
+				Ext:   ext,
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for item := range items {
+				err := b.process(ctx, out, &item)
+
+				mu.Lock()
+				summary.Processed++
+				if err != nil {
+					summary.Failures = append(summary.Failures, BatchFailure{Item: item, Err: err})
+				}
+				mu.Unlock()
+
+				if b.Done != nil {
+					b.Done(item, err)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	sort.Slice(summary.Failures, func(i, j int) bool {
+		return summary.Failures[i].Item.Index < summary.Failures[j].Item.Index
+	})
+
+	return summary, nil
+}
+
+// process instantiates and processes the graph for a single input, setting
+// the item's output path.
+func (b Batch) process(ctx context.Context, out *template.Template, item *BatchItem) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := out.Execute(&buf, item); err != nil {
+		return fmt.Errorf("executing output template: %v", err)
+	}
+	item.Output = buf.String()
+
+	if dir := filepath.Dir(item.Output); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	paths := []string{jsonEscape(item.Path), jsonEscape(item.Output)}
+	data := &graph.JSONTemplateData{Args: append(paths, b.Args...)}
+	roots, err := ProcessJSON(bytes.NewReader(b.Definition), data, b.Overrides...)
+	if err != nil {
+		return err
+	}
+
+	var errs Errors
+	for _, err := range b.Graph.ProcessRoots(ctx, roots...) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return errs
+	}
+}
+
+// jsonEscape escapes s so that it can be placed between the quotes of a JSON
+// string.
+func jsonEscape(s string) string {
+	b, _ := json.Marshal(s)
+
+	return string(b[1 : len(b)-1])
+}
@@ -0,0 +1,100 @@
+package drawgl_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/operation/tests"
+)
+
+func TestBatch(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in")
+	if err := os.Mkdir(in, 0755); err != nil {
+		t.Fatalf("Error creating the input directory: %v\n", err)
+	}
+
+	img, err := ioutil.ReadFile(filepath.Join(tests.TestDataDir(), "test.png"))
+	if err != nil {
+		t.Fatalf("Error reading test image: %v\n", err)
+	}
+
+	files := map[string][]byte{`q"\uote.png`: img, "a.png": img, "b.png": img, "broken.png": []byte("not an image"), "c.txt": nil}
+	for name, b := range files {
+		if err := ioutil.WriteFile(filepath.Join(in, name), b, 0644); err != nil {
+			t.Fatalf("Error writing %s: %v\n", name, err)
+		}
+	}
+
+	inputs, err := drawgl.BatchInputs(filepath.Join(in, "*.png"))
+	if err != nil {
+		t.Fatalf("Error expanding inputs: %v\n", err)
+	}
+
+	if len(inputs) != 4 || filepath.Base(inputs[0]) != "a.png" || filepath.Base(inputs[2]) != "broken.png" {
+		t.Fatalf("Unexpected inputs %v\n", inputs)
+	}
+
+	if all, err := drawgl.BatchInputs(in, filepath.Join(in, "a.png")); err != nil || len(all) != 5 {
+		t.Fatalf("Expected the directory to expand into 5 files, got %v, %v\n", all, err)
+	}
+
+	var done int32
+	b := drawgl.Batch{
+		Definition: []byte(`{
+			"Name": "Load",
+			"Options": {"Path": "{{ index .Args 0 }}"},
+			"Outputs": {
+				"Output": {
+					"Name": "BoxBlur",
+					"Options": {"Radius": {{ index .Args 2 }}},
+					"Outputs": {"Output": {"Name": "Save", "Options": {"Path": "{{ index .Args 1 }}"}}}
+				}
+			}
+		}`),
+		Output:  filepath.Join(dir, "out", "{{.Name}}-blurred{{.Ext}}"),
+		Args:    []string{"1"},
+		Workers: 2,
+		Done: func(item drawgl.BatchItem, err error) {
+			atomic.AddInt32(&done, 1)
+		},
+	}
+
+	summary, err := b.Run(context.Background(), inputs)
+	if err != nil {
+		t.Fatalf("Error running batch: %v\n", err)
+	}
+
+	if summary.Processed != 4 || done != 4 {
+		t.Fatalf("Expected 4 processed inputs, got %d, with %d calls to Done\n", summary.Processed, done)
+	}
+
+	if len(summary.Failures) != 1 || summary.Failures[0].Item.Base != "broken.png" {
+		t.Fatalf("Expected broken.png to fail, got %v\n", summary.Failures)
+	}
+
+	// Quotes and backslashes in paths don't break the definition
+	for _, name := range []string{"a-blurred.png", "b-blurred.png", `q"\uote-blurred.png`} {
+		if _, err := os.Stat(filepath.Join(dir, "out", name)); err != nil {
+			t.Fatalf("Expected output %s: %v\n", name, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	summary, err = b.Run(ctx, inputs)
+	if err != nil || len(summary.Failures) != 4 {
+		t.Fatalf("Expected all inputs to fail once cancelled, got %v, %v\n", summary.Failures, err)
+	}
+
+	b.Output = "{{.Missing"
+	if _, err := b.Run(context.Background(), inputs); err == nil {
+		t.Fatalf("Expected an output template error\n")
+	}
+}
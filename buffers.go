@@ -0,0 +1,128 @@
+package drawgl
+
+import "github.com/urandom/graph"
+
+// bufferRefs tracks the nodes that hold, or have yet to receive, each
+// buffer. A buffer that is held by a single node may be handed over to an
+// InPlaceProcessor without copying it, and the results of a node are
+// released once all of its children have received them. It is only used by
+// the goroutine that walks the graph.
+type bufferRefs struct {
+	// consumers holds the number of children connected to each output of a
+	// node
+	consumers map[graph.Id]map[graph.ConnectorName]int
+	// remaining holds the number of children that have yet to receive the
+	// results of a node
+	remaining map[graph.Id]int
+	refs      map[*FloatImage]int
+	// pinned buffers are referenced by deferred tile chains, and are never
+	// handed over
+	pinned map[*FloatImage]bool
+	held   map[graph.Id][]*FloatImage
+}
+
+// newBufferRefs counts the children of each node of the graph.
+func newBufferRefs(rg *rootsGraph) *bufferRefs {
+	b := &bufferRefs{
+		consumers: make(map[graph.Id]map[graph.ConnectorName]int),
+		remaining: make(map[graph.Id]int),
+		refs:      make(map[*FloatImage]int),
+		pinned:    make(map[*FloatImage]bool),
+		held:      make(map[graph.Id][]*FloatImage),
+	}
+
+	for _, parents := range rg.parents {
+		for _, p := range parents {
+			c := b.consumers[p.Node.Id()]
+			if c == nil {
+				c = make(map[graph.ConnectorName]int)
+				b.consumers[p.Node.Id()] = c
+			}
+			c[p.From]++
+		}
+	}
+
+	return b
+}
+
+// produced registers the buffers of a node's result with each of the node's
+// children.
+func (b *bufferRefs) produced(r Result) {
+	for conn, count := range b.consumers[r.Id] {
+		b.remaining[r.Id] += count
+
+		if buf := outputBuffer(r, conn); buf != nil {
+			b.refs[buf] += count
+		}
+	}
+}
+
+// take hands the buffers collected from a node's parents over to the node,
+// reporting whether its main input has to be copied before the node can
+// write to it, and which parents have no more children waiting for their
+// results.
+func (b *bufferRefs) take(wd graph.WalkData, buffers map[graph.ConnectorName]Result, inPlace bool) (copyInput bool, released []graph.Id) {
+	id := wd.Node.Id()
+
+	for _, p := range wd.Parents {
+		if buf := buffers[p.To].Buffer; buf != nil {
+			b.held[id] = append(b.held[id], buf)
+
+			if inPlace && p.To == graph.InputName && (b.refs[buf] > 1 || b.pinned[buf]) {
+				copyInput = true
+			}
+		} else if tiles := buffers[p.To].tiles; tiles != nil && tiles.shared {
+			// The output of a shared tile source is kept for all of its
+			// consumers
+			copyInput = copyInput || inPlace && p.To == graph.InputName
+		}
+
+		pid := p.Node.Id()
+		if b.remaining[pid]--; b.remaining[pid] <= 0 {
+			delete(b.remaining, pid)
+			released = append(released, pid)
+		}
+	}
+
+	return copyInput, released
+}
+
+// release drops the references to the buffers held by a finished node.
+func (b *bufferRefs) release(id graph.Id) {
+	for _, buf := range b.held[id] {
+		if b.refs[buf]--; b.refs[buf] <= 0 {
+			delete(b.refs, buf)
+		}
+	}
+
+	delete(b.held, id)
+}
+
+// children returns the number of children connected to the outputs of the
+// node.
+func (b *bufferRefs) children(id graph.Id) (count int) {
+	for _, c := range b.consumers[id] {
+		count += c
+	}
+
+	return count
+}
+
+// pin prevents the buffer from ever being handed over.
+func (b *bufferRefs) pin(buf *FloatImage) {
+	if buf != nil {
+		b.pinned[buf] = true
+	}
+}
+
+// outputBuffer returns the buffer that a child connected to the given
+// output receives.
+func outputBuffer(r Result, from graph.ConnectorName) *FloatImage {
+	if from != graph.OutputName {
+		if nb, ok := r.NamedBuffers[from]; ok && nb != nil {
+			return nb
+		}
+	}
+
+	return r.Buffer
+}
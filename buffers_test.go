@@ -0,0 +1,202 @@
+package drawgl_test
+
+import (
+	"context"
+	"image"
+	"sync"
+	"testing"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/operation/color"
+	"github.com/urandom/drawgl/operation/transform"
+	"github.com/urandom/graph"
+	"github.com/urandom/graph/base"
+)
+
+type sourceNode struct {
+	base.Node
+	buf *drawgl.FloatImage
+}
+
+func (n sourceNode) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+	output <- drawgl.Result{Id: n.Id(), Buffer: n.buf}
+
+	wd.Close()
+}
+
+// invertNode inverts the red channel of its input in place, and records the
+// buffer and the original value of the first pixel it received
+type invertNode struct {
+	base.Node
+	mu       *sync.Mutex
+	received **drawgl.FloatImage
+	value    *drawgl.ColorValue
+}
+
+func (n invertNode) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+	buf := buffers[graph.InputName].Buffer
+
+	n.mu.Lock()
+	*n.received = buf
+	*n.value = buf.Pix[0]
+	n.mu.Unlock()
+
+	for i := 0; i < len(buf.Pix); i += 4 {
+		buf.Pix[i] = 1 - buf.Pix[i]
+	}
+
+	output <- drawgl.Result{Id: n.Id(), Buffer: buf}
+
+	wd.Close()
+}
+
+func (n invertNode) InPlace() bool {
+	return true
+}
+
+func TestGraphInPlaceChain(t *testing.T) {
+	var mu sync.Mutex
+	var received *drawgl.FloatImage
+	var value drawgl.ColorValue
+	var out *drawgl.FloatImage
+
+	src := sourceImage()
+	source := base.NewLinkerNode(sourceNode{Node: base.NewNode(), buf: src})
+	invert := base.NewLinkerNode(invertNode{Node: base.NewNode(), mu: &mu, received: &received, value: &value})
+	capture := base.NewLinkerNode(captureNode{Node: base.NewNode(), buf: &out})
+
+	source.Link(invert)
+	invert.Link(capture)
+
+	g := drawgl.Graph{}
+	if err := g.Process(source); err != nil {
+		t.Fatalf("Error processing graph: %v\n", err)
+	}
+
+	if received != src {
+		t.Fatalf("Expected the buffer of a linear chain to be handed over without copying\n")
+	}
+
+	if value != 0.25 || out.Pix[0] != 0.75 {
+		t.Fatalf("Expected the inverted value 0.75 of 0.25, got %v of %v\n", out.Pix[0], value)
+	}
+}
+
+func TestGraphInPlaceFanOut(t *testing.T) {
+	var mu sync.Mutex
+	var received1, received2 *drawgl.FloatImage
+	var value1, value2 drawgl.ColorValue
+
+	src := sourceImage()
+	source := base.NewLinkerNode(sourceNode{Node: base.NewNode(), buf: src})
+	invert1 := base.NewLinkerNode(invertNode{Node: base.NewNode(), mu: &mu, received: &received1, value: &value1})
+	invert2 := base.NewLinkerNode(invertNode{Node: base.NewNode(), mu: &mu, received: &received2, value: &value2})
+
+	source.Link(invert1)
+	source.Link(invert2)
+
+	g := drawgl.Graph{}
+	if err := g.Process(source); err != nil {
+		t.Fatalf("Error processing graph: %v\n", err)
+	}
+
+	if value1 != 0.25 || value2 != 0.25 {
+		t.Fatalf("Expected both nodes to receive the original value 0.25, got %v and %v\n", value1, value2)
+	}
+
+	if received1 == received2 {
+		t.Fatalf("Expected the nodes to receive different buffers\n")
+	}
+}
+
+// waitNode captures its input once the wait channel is closed
+type waitNode struct {
+	base.Node
+	wait <-chan struct{}
+	buf  **drawgl.FloatImage
+}
+
+func (n waitNode) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+	<-n.wait
+	*n.buf = buffers[graph.InputName].Buffer
+	output <- drawgl.Result{Id: n.Id()}
+
+	wd.Close()
+}
+
+func TestGraphInPlaceOperations(t *testing.T) {
+	var out, orig *drawgl.FloatImage
+
+	src := sourceImage()
+	source := base.NewLinkerNode(sourceNode{Node: base.NewNode(), buf: src})
+
+	crop, err := transform.NewCropLinker(transform.CropOptions{Min: [2]int{1, 1}, Max: [2]int{3, 3}})
+	if err != nil {
+		t.Fatalf("Error creating a crop linker: %v\n", err)
+	}
+
+	convert, err := color.NewColorSpaceLinker(color.ColorSpaceOptions{Space: drawgl.SRGB})
+	if err != nil {
+		t.Fatalf("Error creating a color space linker: %v\n", err)
+	}
+
+	source.Link(crop)
+	crop.Link(convert)
+	convert.Link(base.NewLinkerNode(captureNode{Node: base.NewNode(), buf: &out}))
+
+	if err := (drawgl.Graph{}).Process(source); err != nil {
+		t.Fatalf("Error processing graph: %v\n", err)
+	}
+
+	// Both operations have a single consumer, and reuse the source buffer
+	if &out.Pix[0] != &src.Pix[src.PixOffset(1, 1)] {
+		t.Fatalf("Expected the output to share the pixels of the source\n")
+	}
+
+	exp := drawgl.ConvertColor(drawgl.FloatColor{R: 0.25, G: 0.25, B: 0.25, A: 0.25}, drawgl.LinearSRGB, drawgl.SRGB)
+	if c := out.FloatAt(1, 1); !c.ApproxEqual(exp) || out.ColorSpace != drawgl.SRGB {
+		t.Fatalf("Expected %v in %s, got %v in %s\n", exp, drawgl.SRGB, c, out.ColorSpace)
+	}
+
+	// Another consumer of the source keeps the original values
+	src = sourceImage()
+	source = base.NewLinkerNode(sourceNode{Node: base.NewNode(), buf: src})
+
+	convert, err = color.NewColorSpaceLinker(color.ColorSpaceOptions{Space: drawgl.SRGB})
+	if err != nil {
+		t.Fatalf("Error creating a color space linker: %v\n", err)
+	}
+
+	// The other consumer holds on to the source until the conversion is done
+	converted := make(chan struct{})
+	source.Link(convert)
+	source.Link(base.NewLinkerNode(waitNode{Node: base.NewNode(), wait: converted, buf: &orig}))
+	convert.Link(base.NewLinkerNode(captureNode{Node: base.NewNode(), buf: &out}))
+
+	g := drawgl.Graph{Observer: func(e drawgl.Event) {
+		if e.Id == convert.Node().Id() && e.Kind != drawgl.NodeStarted && e.Kind != drawgl.NodeProgress {
+			close(converted)
+		}
+	}}
+
+	if err := g.Process(source); err != nil {
+		t.Fatalf("Error processing graph: %v\n", err)
+	}
+
+	if &out.Pix[0] == &src.Pix[0] || orig.Pix[0] != 0.25 {
+		t.Fatalf("Expected a shared source to be copied, got %v\n", orig.Pix[0])
+	}
+
+	if c := out.FloatAt(0, 0); !c.ApproxEqual(exp) {
+		t.Fatalf("Expected %v, got %v\n", exp, c)
+	}
+}
+
+func sourceImage() *drawgl.FloatImage {
+	img := drawgl.NewFloatImage(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = 0.25
+	}
+
+	return img
+}
@@ -0,0 +1,320 @@
+package drawgl
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/urandom/graph"
+)
+
+// Cache stores the results of processed nodes, so that they may be reused
+// when a node and all of its ancestors are unchanged. Implementations must be
+// safe for concurrent use.
+type Cache interface {
+	// Get returns the result stored under the given key, if any. The returned
+	// buffers must not be shared with the cache.
+	Get(key string) (Result, bool)
+	// Put stores a result under the given key. The cache must not retain the
+	// buffers of the result, as they might be modified afterwards.
+	Put(key string, r Result)
+}
+
+// Hasher is implemented by nodes whose result depends solely on their
+// options and input, and can therefore be cached.
+type Hasher interface {
+	// Hash returns a value that uniquely identifies the node's options. An
+	// empty hash means that the node cannot be cached.
+	Hash() string
+}
+
+// MemoryCache is a Cache that keeps a limited number of results in memory,
+// discarding the least recently used ones.
+type MemoryCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// DirCache is a Cache that stores the results as files in a directory. Any
+// failure to read or write a file is treated as a cache miss.
+type DirCache struct {
+	dir string
+}
+
+type memoryCacheEntry struct {
+	key    string
+	result Result
+}
+
+type cachedResult struct {
+	Buffer       *FloatImage
+	NamedBuffers map[graph.ConnectorName]*FloatImage
+	Meta         Meta
+	Inactive     []graph.ConnectorName
+}
+
+// HashOptions returns a hash of the name and options of a node, suitable for
+// implementing the Hasher interface. Pointers and interfaces are hashed by
+// the values they refer to, such as the pixels of a mask image. An empty hash
+// is returned if the options hold values that cannot be hashed, like
+// functions or channels.
+func HashOptions(name string, opts interface{}) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s:", name)
+
+	if !hashValue(h, reflect.ValueOf(opts), make(map[uintptr]bool)) {
+		return ""
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashValue writes the type and content of the value. The visited pointers
+// guard against cycles, which cannot be hashed.
+func hashValue(w io.Writer, v reflect.Value, visited map[uintptr]bool) bool {
+	if !v.IsValid() {
+		io.WriteString(w, "nil;")
+		return true
+	}
+
+	fmt.Fprintf(w, "%s{", v.Type())
+	defer io.WriteString(w, "}")
+
+	switch v.Kind() {
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return false
+	case reflect.Ptr:
+		if v.IsNil() {
+			io.WriteString(w, "nil")
+			return true
+		}
+
+		p := v.Pointer()
+		if visited[p] {
+			return false
+		}
+
+		visited[p] = true
+		defer delete(visited, p)
+
+		return hashValue(w, v.Elem(), visited)
+	case reflect.Interface:
+		return hashValue(w, v.Elem(), visited)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			fmt.Fprintf(w, "%s:", v.Type().Field(i).Name)
+			if !hashValue(w, v.Field(i), visited) {
+				return false
+			}
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			io.WriteString(w, "nil")
+			return true
+		}
+
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			fmt.Fprintf(w, "%d:", v.Len())
+			w.Write(v.Bytes())
+			return true
+		}
+
+		fallthrough
+	case reflect.Array:
+		fmt.Fprintf(w, "%d:", v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if !hashValue(w, v.Index(i), visited) {
+				return false
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			io.WriteString(w, "nil")
+			return true
+		}
+
+		// Map entries are hashed in the order of their encoded keys
+		entries := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			var b bytes.Buffer
+			if !hashValue(&b, k, visited) || !hashValue(&b, v.MapIndex(k), visited) {
+				return false
+			}
+			entries = append(entries, b.String())
+		}
+
+		sort.Strings(entries)
+		for _, e := range entries {
+			io.WriteString(w, e)
+		}
+	default:
+		fmt.Fprintf(w, "%v", v)
+	}
+
+	return true
+}
+
+// NewMemoryCache creates a new in-memory cache, holding at most size results.
+func NewMemoryCache(size int) *MemoryCache {
+	if size <= 0 {
+		size = 1
+	}
+
+	return &MemoryCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *MemoryCache) Get(key string) (Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return Result{}, false
+	}
+
+	c.order.MoveToFront(e)
+
+	return copyResult(e.Value.(memoryCacheEntry).result), true
+}
+
+func (c *MemoryCache) Put(key string, r Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := memoryCacheEntry{key: key, result: copyResult(r)}
+	if e, ok := c.entries[key]; ok {
+		e.Value = entry
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.size {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.entries, e.Value.(memoryCacheEntry).key)
+	}
+}
+
+// NewDirCache creates a new cache, storing its results in the given
+// directory. The directory is created if it doesn't exist.
+func NewDirCache(dir string) (*DirCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &DirCache{dir: dir}, nil
+}
+
+func (c *DirCache) Get(key string) (r Result, ok bool) {
+	f, err := os.Open(c.path(key))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var cr cachedResult
+	if err := gob.NewDecoder(f).Decode(&cr); err != nil {
+		return
+	}
+
+	return Result{Buffer: cr.Buffer, NamedBuffers: cr.NamedBuffers, Meta: cr.Meta, Inactive: cr.Inactive}, true
+}
+
+func (c *DirCache) Put(key string, r Result) {
+	f, err := ioutil.TempFile(c.dir, key)
+	if err != nil {
+		return
+	}
+
+	cr := cachedResult{Buffer: r.Buffer, NamedBuffers: r.NamedBuffers, Meta: r.Meta, Inactive: r.Inactive}
+	err = gob.NewEncoder(f).Encode(cr)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), c.path(key))
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+func (c *DirCache) path(key string) string {
+	return filepath.Join(c.dir, key+".gob")
+}
+
+// cacheKey computes the key of a node from its own hash, and the keys of its
+// parents. An empty key is returned if the node, or any of its ancestors,
+// cannot be cached.
+func cacheKey(wd graph.WalkData, keys map[graph.Id]string) string {
+	hasher, ok := wd.Node.(Hasher)
+	if !ok {
+		return ""
+	}
+
+	hash := hasher.Hash()
+	if hash == "" {
+		return ""
+	}
+
+	parents := make([]string, len(wd.Parents))
+	for i, p := range wd.Parents {
+		key := keys[p.Node.Id()]
+		if key == "" {
+			return ""
+		}
+
+		parents[i] = fmt.Sprintf("%s:%s:%s", p.To, p.From, key)
+	}
+
+	sort.Strings(parents)
+
+	h := sha256.New()
+	fmt.Fprintln(h, hash)
+	for _, p := range parents {
+		fmt.Fprintln(h, p)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func copyResult(r Result) Result {
+	if r.Buffer != nil {
+		r.Buffer = CopyImage(r.Buffer)
+	}
+
+	if r.NamedBuffers != nil {
+		named := make(map[graph.ConnectorName]*FloatImage, len(r.NamedBuffers))
+		for k, v := range r.NamedBuffers {
+			if v != nil {
+				v = CopyImage(v)
+			}
+			named[k] = v
+		}
+		r.NamedBuffers = named
+	}
+
+	r.Meta = copyMeta(r.Meta)
+
+	return r
+}
@@ -0,0 +1,115 @@
+package drawgl_test
+
+import (
+	"image"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/urandom/drawgl"
+)
+
+func TestMemoryCache(t *testing.T) {
+	c := drawgl.NewMemoryCache(2)
+
+	buf := drawgl.NewFloatImage(image.Rect(0, 0, 2, 2))
+	buf.SetColor(1, 1, drawgl.FloatColor{R: 1, A: 1})
+
+	c.Put("a", drawgl.Result{Buffer: buf})
+	c.Put("b", drawgl.Result{Buffer: buf})
+
+	buf.SetColor(1, 1, drawgl.FloatColor{G: 1, A: 1})
+
+	r, ok := c.Get("a")
+	if !ok {
+		t.Fatalf("Expected a cached result for 'a'\n")
+	}
+
+	if c := r.Buffer.FloatAt(1, 1); c != (drawgl.FloatColor{R: 1, A: 1}) {
+		t.Fatalf("Expected the cached buffer to be a copy, got %v\n", c)
+	}
+
+	c.Put("c", drawgl.Result{Buffer: buf})
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatalf("Expected 'b' to be evicted\n")
+	}
+
+	if _, ok := c.Get("a"); !ok {
+		t.Fatalf("Expected 'a' to remain cached\n")
+	}
+}
+
+func TestDirCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drawgl-cache")
+	if err != nil {
+		t.Fatalf("Error creating a temporary dir: %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := drawgl.NewDirCache(dir)
+	if err != nil {
+		t.Fatalf("Error creating a dir cache: %v\n", err)
+	}
+
+	if _, ok := c.Get("a"); ok {
+		t.Fatalf("Expected an empty cache\n")
+	}
+
+	buf := drawgl.NewFloatImage(image.Rect(0, 0, 2, 2))
+	buf.SetColor(1, 0, drawgl.FloatColor{B: 0.5, A: 1})
+
+	c.Put("a", drawgl.Result{Buffer: buf, Meta: drawgl.Meta{"input-path": "foo.png"}})
+
+	r, ok := c.Get("a")
+	if !ok {
+		t.Fatalf("Expected a cached result for 'a'\n")
+	}
+
+	if r.Buffer.Rect != buf.Rect || r.Buffer.FloatAt(1, 0) != buf.FloatAt(1, 0) {
+		t.Fatalf("Cached buffer %v doesn't match %v\n", r.Buffer, buf)
+	}
+
+	if r.Meta["input-path"] != "foo.png" {
+		t.Fatalf("Unexpected cached meta %v\n", r.Meta)
+	}
+}
+
+func TestHashOptions(t *testing.T) {
+	type options struct {
+		Mask  drawgl.Mask
+		Scale *float64
+	}
+
+	mask := func(v uint8) drawgl.Mask {
+		img := image.NewAlpha(image.Rect(0, 0, 2, 2))
+		img.Pix[3] = v
+		return drawgl.NewMask(img, image.Rect(0, 0, 2, 2))
+	}
+
+	scale := func(v float64) *float64 {
+		return &v
+	}
+
+	// Equal content in separate allocations hashes the same
+	h := drawgl.HashOptions("test", options{Mask: mask(128), Scale: scale(2)})
+	if h == "" || h != drawgl.HashOptions("test", options{Mask: mask(128), Scale: scale(2)}) {
+		t.Fatalf("Expected equal options to have the same hash\n")
+	}
+
+	if h == drawgl.HashOptions("test", options{Mask: mask(64), Scale: scale(2)}) {
+		t.Fatalf("Expected a different mask image to change the hash\n")
+	}
+
+	if h == drawgl.HashOptions("test", options{Mask: mask(128), Scale: scale(3)}) {
+		t.Fatalf("Expected a different pointed-to value to change the hash\n")
+	}
+
+	if h == drawgl.HashOptions("other", options{Mask: mask(128), Scale: scale(2)}) {
+		t.Fatalf("Expected the name to change the hash\n")
+	}
+
+	if h := drawgl.HashOptions("test", struct{ Fn func() }{func() {}}); h != "" {
+		t.Fatalf("Expected options with a function not to be hashable, got %s\n", h)
+	}
+}
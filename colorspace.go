@@ -0,0 +1,299 @@
+package drawgl
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// ColorSpace identifies the primaries and the transfer function that the
+// values of an image are encoded with. The zero value is LinearSRGB, in
+// which FloatColor math operates by default.
+type ColorSpace int
+
+const (
+	// LinearSRGB holds linear light with the sRGB primaries
+	LinearSRGB ColorSpace = iota
+	// SRGB holds values encoded with the sRGB transfer function, as
+	// decoded from most image files
+	SRGB
+	// DisplayP3 holds values with the Display P3 primaries, encoded with
+	// the sRGB transfer function
+	DisplayP3
+	// Rec2020 holds values with the ITU-R BT.2020 primaries, encoded with
+	// its transfer function
+	Rec2020
+)
+
+// colorSpaceNames holds the names of the color spaces in JSON definitions.
+var colorSpaceNames = map[ColorSpace]string{
+	LinearSRGB: "linear-srgb",
+	SRGB:       "srgb",
+	DisplayP3:  "display-p3",
+	Rec2020:    "rec2020",
+}
+
+// ColorSpaceNames lists the names of the color spaces, as used in JSON.
+var ColorSpaceNames = []string{"linear-srgb", "srgb", "display-p3", "rec2020"}
+
+// Matrices converting linear RGB values to CIE XYZ, with a D65 white point.
+var (
+	srgbToXYZ = [3][3]float64{
+		{0.4124564, 0.3575761, 0.1804375},
+		{0.2126729, 0.7151522, 0.0721750},
+		{0.0193339, 0.1191920, 0.9503041},
+	}
+	displayP3ToXYZ = [3][3]float64{
+		{0.4865709, 0.2656677, 0.1982173},
+		{0.2289746, 0.6917385, 0.0792869},
+		{0.0000000, 0.0451134, 1.0439444},
+	}
+	rec2020ToXYZ = [3][3]float64{
+		{0.6369580, 0.1446169, 0.1688810},
+		{0.2627002, 0.6779981, 0.0593017},
+		{0.0000000, 0.0280727, 1.0609851},
+	}
+)
+
+// Constants of the BT.2020 transfer function.
+const (
+	rec2020Alpha = 1.09929682680944
+	rec2020Beta  = 0.018053968510807
+)
+
+func (cs ColorSpace) String() string {
+	if name, ok := colorSpaceNames[cs]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("ColorSpace(%d)", int(cs))
+}
+
+// Valid reports whether the color space is known.
+func (cs ColorSpace) Valid() bool {
+	_, ok := colorSpaceNames[cs]
+	return ok
+}
+
+// Linear reports whether the values of the color space are linear light.
+func (cs ColorSpace) Linear() bool {
+	return cs == LinearSRGB
+}
+
+// ParseColorSpace returns the color space with the given name.
+func ParseColorSpace(name string) (ColorSpace, error) {
+	for cs, n := range colorSpaceNames {
+		if n == name {
+			return cs, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown color space %q", name)
+}
+
+func (cs ColorSpace) MarshalJSON() ([]byte, error) {
+	if !cs.Valid() {
+		return nil, fmt.Errorf("unknown color space %d", int(cs))
+	}
+
+	return json.Marshal(cs.String())
+}
+
+func (cs *ColorSpace) UnmarshalJSON(b []byte) (err error) {
+	var name string
+	if err = json.Unmarshal(b, &name); err == nil {
+		*cs, err = ParseColorSpace(name)
+	}
+
+	return
+}
+
+// ConvertColorSpace returns the image, converted into the given color
+// space. The image itself is returned if it already is in that space,
+// otherwise a converted copy, keeping the alpha mode of the image.
+func ConvertColorSpace(img *FloatImage, cs ColorSpace) *FloatImage {
+	if img.ColorSpace == cs {
+		return img
+	}
+
+	dst := CopyImage(img)
+	ConvertColorSpaceInPlace(dst, cs)
+
+	return dst
+}
+
+// ConvertColorSpaceInPlace converts the values of the image into the given
+// color space, keeping its alpha mode.
+func ConvertColorSpaceInPlace(img *FloatImage, cs ColorSpace) {
+	if img.ColorSpace == cs {
+		return
+	}
+
+	conv := newColorConverter(img.ColorSpace, cs).convert
+	if img.Alpha == Straight {
+		conv = newColorConverter(img.ColorSpace, cs).convertStraight
+	}
+
+	img.ColorSpace = cs
+
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		i := img.PixOffset(img.Rect.Min.X, y)
+		row := img.Pix[i : i+4*img.Rect.Dx()]
+
+		for j := 0; j < len(row); j += 4 {
+			c := conv(FloatColor{R: row[j], G: row[j+1], B: row[j+2], A: row[j+3]})
+			row[j], row[j+1], row[j+2], row[j+3] = c.R, c.G, c.B, c.A
+		}
+	}
+}
+
+// ConvertColor converts an alpha-premultiplied color from one color space
+// into another.
+func ConvertColor(c FloatColor, from, to ColorSpace) FloatColor {
+	if from == to {
+		return c
+	}
+
+	return newColorConverter(from, to).convert(c)
+}
+
+// colorConverter converts colors between two color spaces, through linear
+// light.
+type colorConverter struct {
+	from, to ColorSpace
+	// matrix converts between the linear values of both spaces, and is nil
+	// if they share their primaries
+	matrix *[3][3]float64
+}
+
+func newColorConverter(from, to ColorSpace) colorConverter {
+	c := colorConverter{from: from, to: to}
+
+	src, dst := from.toXYZ(), to.toXYZ()
+	if src != dst {
+		m := multiply3(invert3(dst), src)
+		c.matrix = &m
+	}
+
+	return c
+}
+
+// convert converts a premultiplied color.
+func (c colorConverter) convert(col FloatColor) FloatColor {
+	if col.A == 0 {
+		return col
+	}
+
+	// The transfer functions apply to straight colors
+	return c.convertStraight(col.Unpremultiply()).Premultiply()
+}
+
+// convertStraight converts a straight color.
+func (c colorConverter) convertStraight(col FloatColor) FloatColor {
+	rgb := [3]float64{float64(col.R), float64(col.G), float64(col.B)}
+
+	for i := range rgb {
+		rgb[i] = c.from.decode(rgb[i])
+	}
+
+	if m := c.matrix; m != nil {
+		rgb = [3]float64{
+			m[0][0]*rgb[0] + m[0][1]*rgb[1] + m[0][2]*rgb[2],
+			m[1][0]*rgb[0] + m[1][1]*rgb[1] + m[1][2]*rgb[2],
+			m[2][0]*rgb[0] + m[2][1]*rgb[1] + m[2][2]*rgb[2],
+		}
+	}
+
+	for i := range rgb {
+		rgb[i] = c.to.encode(rgb[i])
+	}
+
+	return FloatColor{R: ColorValue(rgb[0]), G: ColorValue(rgb[1]), B: ColorValue(rgb[2]), A: col.A}
+}
+
+func (cs ColorSpace) toXYZ() [3][3]float64 {
+	switch cs {
+	case DisplayP3:
+		return displayP3ToXYZ
+	case Rec2020:
+		return rec2020ToXYZ
+	default:
+		return srgbToXYZ
+	}
+}
+
+// decode converts an encoded value of the color space into linear light.
+// Values outside of the [0, 1] range are mirrored around 0.
+func (cs ColorSpace) decode(v float64) float64 {
+	if v < 0 {
+		return -cs.decode(-v)
+	}
+
+	switch cs {
+	case SRGB, DisplayP3:
+		if v <= 0.04045 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	case Rec2020:
+		if v < 4.5*rec2020Beta {
+			return v / 4.5
+		}
+		return math.Pow((v+rec2020Alpha-1)/rec2020Alpha, 1/0.45)
+	default:
+		return v
+	}
+}
+
+// encode converts a linear light value into the encoding of the color
+// space.
+func (cs ColorSpace) encode(v float64) float64 {
+	if v < 0 {
+		return -cs.encode(-v)
+	}
+
+	switch cs {
+	case SRGB, DisplayP3:
+		if v <= 0.0031308 {
+			return v * 12.92
+		}
+		return 1.055*math.Pow(v, 1/2.4) - 0.055
+	case Rec2020:
+		if v < rec2020Beta {
+			return v * 4.5
+		}
+		return rec2020Alpha*math.Pow(v, 0.45) - (rec2020Alpha - 1)
+	default:
+		return v
+	}
+}
+
+func multiply3(a, b [3][3]float64) (m [3][3]float64) {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+
+	return
+}
+
+func invert3(a [3][3]float64) (m [3][3]float64) {
+	det := a[0][0]*(a[1][1]*a[2][2]-a[1][2]*a[2][1]) -
+		a[0][1]*(a[1][0]*a[2][2]-a[1][2]*a[2][0]) +
+		a[0][2]*(a[1][0]*a[2][1]-a[1][1]*a[2][0])
+
+	m[0][0] = (a[1][1]*a[2][2] - a[1][2]*a[2][1]) / det
+	m[0][1] = (a[0][2]*a[2][1] - a[0][1]*a[2][2]) / det
+	m[0][2] = (a[0][1]*a[1][2] - a[0][2]*a[1][1]) / det
+	m[1][0] = (a[1][2]*a[2][0] - a[1][0]*a[2][2]) / det
+	m[1][1] = (a[0][0]*a[2][2] - a[0][2]*a[2][0]) / det
+	m[1][2] = (a[0][2]*a[1][0] - a[0][0]*a[1][2]) / det
+	m[2][0] = (a[1][0]*a[2][1] - a[1][1]*a[2][0]) / det
+	m[2][1] = (a[0][1]*a[2][0] - a[0][0]*a[2][1]) / det
+	m[2][2] = (a[0][0]*a[1][1] - a[0][1]*a[1][0]) / det
+
+	return
+}
@@ -0,0 +1,97 @@
+package drawgl_test
+
+import (
+	"encoding/json"
+	"image"
+	"math"
+	"testing"
+
+	"github.com/urandom/drawgl"
+)
+
+func TestConvertColor(t *testing.T) {
+	c := drawgl.ConvertColor(drawgl.FloatColor{R: 0.5, G: 1, B: 0, A: 1}, drawgl.SRGB, drawgl.LinearSRGB)
+	if math.Abs(float64(c.R)-0.214) > 0.001 || c.G != 1 || c.B != 0 || c.A != 1 {
+		t.Fatalf("Unexpected linear color %v\n", c)
+	}
+
+	// Premultiplied values are decoded as straight colors
+	c = drawgl.ConvertColor(drawgl.FloatColor{R: 0.25, A: 0.5}, drawgl.SRGB, drawgl.LinearSRGB)
+	if math.Abs(float64(c.R)-0.107) > 0.001 || c.A != 0.5 {
+		t.Fatalf("Unexpected premultiplied linear color %v\n", c)
+	}
+
+	spaces := []drawgl.ColorSpace{drawgl.LinearSRGB, drawgl.SRGB, drawgl.DisplayP3, drawgl.Rec2020}
+	colors := []drawgl.FloatColor{
+		{R: 0.2, G: 0.4, B: 0.6, A: 1},
+		{R: 0.01, G: 0.002, B: 0.3, A: 0.5},
+		{R: 1, G: 1, B: 1, A: 1},
+		{},
+	}
+
+	for _, from := range spaces {
+		for _, to := range spaces {
+			for _, c := range colors {
+				if r := drawgl.ConvertColor(drawgl.ConvertColor(c, from, to), to, from); !r.ApproxEqual(c) {
+					t.Fatalf("Converting %v from %s to %s and back returned %v\n", c, from, to, r)
+				}
+			}
+		}
+	}
+
+	// White is shared by all spaces
+	for _, cs := range spaces {
+		if c := drawgl.ConvertColor(drawgl.FloatColor{R: 1, G: 1, B: 1, A: 1}, drawgl.SRGB, cs); !c.ApproxEqual(drawgl.FloatColor{R: 1, G: 1, B: 1, A: 1}) {
+			t.Fatalf("Expected white in %s, got %v\n", cs, c)
+		}
+	}
+}
+
+func TestConvertColorSpace(t *testing.T) {
+	img := drawgl.NewFloatImage(image.Rect(0, 0, 2, 2))
+	img.ColorSpace = drawgl.SRGB
+	img.UnsafeSetColor(1, 1, drawgl.FloatColor{R: 0.5, G: 0.5, B: 0.5, A: 1})
+
+	if drawgl.ConvertColorSpace(img, drawgl.SRGB) != img {
+		t.Fatalf("Expected the image itself\n")
+	}
+
+	linear := drawgl.ConvertColorSpace(img, drawgl.LinearSRGB)
+	if linear.ColorSpace != drawgl.LinearSRGB {
+		t.Fatalf("Expected a linear image, got %s\n", linear.ColorSpace)
+	}
+
+	if c := linear.FloatAt(1, 1); math.Abs(float64(c.G)-0.214) > 0.001 {
+		t.Fatalf("Unexpected linear color %v\n", c)
+	}
+
+	if c := img.FloatAt(1, 1); c.G != 0.5 {
+		t.Fatalf("Expected the source to be intact, got %v\n", c)
+	}
+
+	if sub := linear.SubImage(image.Rect(1, 1, 2, 2)).(*drawgl.FloatImage); sub.ColorSpace != drawgl.LinearSRGB {
+		t.Fatalf("Expected the sub image to keep the color space, got %s\n", sub.ColorSpace)
+	}
+
+	if conv := drawgl.ConvertImage(image.NewRGBA(image.Rect(0, 0, 1, 1))); conv.ColorSpace != drawgl.SRGB {
+		t.Fatalf("Expected converted images to be sRGB encoded, got %s\n", conv.ColorSpace)
+	}
+}
+
+func TestColorSpaceJSON(t *testing.T) {
+	for _, name := range drawgl.ColorSpaceNames {
+		var cs drawgl.ColorSpace
+		if err := json.Unmarshal([]byte(`"`+name+`"`), &cs); err != nil {
+			t.Fatalf("Error decoding %s: %v\n", name, err)
+		}
+
+		if b, err := json.Marshal(cs); err != nil || string(b) != `"`+name+`"` {
+			t.Fatalf("Expected %s to be encoded back, got %s: %v\n", name, b, err)
+		}
+	}
+
+	var cs drawgl.ColorSpace
+	if err := json.Unmarshal([]byte(`"cmyk"`), &cs); err == nil {
+		t.Fatalf("Expected an error for an unknown color space\n")
+	}
+}
@@ -0,0 +1,175 @@
+package drawgl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/urandom/graph"
+	"github.com/urandom/graph/base"
+)
+
+// deferredNode stands in for a node whose options contain expressions. The
+// actual node is constructed by the graph at process time, once the
+// expressions are evaluated against the node's input.
+type deferredNode struct {
+	base.Node
+	name    string
+	options json.RawMessage
+	factory LinkerFactory
+}
+
+// resolver is implemented by nodes that are replaced by another processor,
+// constructed from the buffers of their parents. The graph maps the results
+// of the returned processor, sent with the returned id, back to the node.
+type resolver interface {
+	resolve(buffers map[graph.ConnectorName]Result) (Processor, graph.Id, error)
+}
+
+// newDeferredLinker returns a linker for a node whose options contain
+// expressions, or false if there are none.
+func newDeferredLinker(name string, options json.RawMessage, factory LinkerFactory) (graph.Linker, bool, error) {
+	if len(options) == 0 {
+		return nil, false, nil
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(options, &v); err != nil {
+		return nil, false, err
+	}
+
+	found := false
+	err := walkExpressions(v, func(s string, e expression) (interface{}, error) {
+		found = true
+		return s, nil
+	})
+	if err != nil || !found {
+		return nil, false, err
+	}
+
+	return base.NewLinkerNode(deferredNode{
+		Node:    base.NewNode(),
+		name:    name,
+		options: options,
+		factory: factory,
+	}), true, nil
+}
+
+// evaluatesExpressions reports whether the operation registered under the
+// given name has an ExpressionOption, and thus evaluates the expressions in
+// its options itself, such as conditions. The construction of such nodes is
+// never deferred.
+func evaluatesExpressions(name string) bool {
+	d, ok := Describe(name)
+	if !ok {
+		return false
+	}
+
+	var has func(opts []OptionDescriptor) bool
+	has = func(opts []OptionDescriptor) bool {
+		for _, o := range opts {
+			if o.Type == ExpressionOption || has(o.Fields) {
+				return true
+			}
+			if o.Items != nil && has([]OptionDescriptor{*o.Items}) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return has(d.Options)
+}
+
+// Process is only called when the node is processed outside of a Graph, which
+// has to construct the actual node.
+func (n deferredNode) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]Result, output chan<- Result) {
+	output <- Result{Id: n.Id(), Error: errors.New("options with expressions are only evaluated by drawgl.Graph")}
+
+	wd.Close()
+}
+
+func (n deferredNode) Definition() (string, interface{}) {
+	return n.name, n.options
+}
+
+// resolve evaluates the expressions against the main input, and constructs
+// the actual node, returning its processor and id.
+func (n deferredNode) resolve(buffers map[graph.ConnectorName]Result) (Processor, graph.Id, error) {
+	env := newExprEnv(buffers[graph.InputName])
+
+	var v interface{}
+	if err := json.Unmarshal(n.options, &v); err != nil {
+		return nil, "", err
+	}
+
+	v, err := replaceExpressions(v, func(s string, e expression) (interface{}, error) {
+		r, err := e.eval(env)
+		if err != nil {
+			return nil, fmt.Errorf("evaluating %q: %v", s, err)
+		}
+		return r, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	options, err := json.Marshal(v)
+	if err != nil {
+		return nil, "", err
+	}
+
+	l, err := n.factory(options)
+	if err != nil {
+		return nil, "", fmt.Errorf("constructing %s with %s: %v", n.name, options, err)
+	}
+
+	p, ok := l.Node().(Processor)
+	if !ok {
+		return nil, "", fmt.Errorf("node %s is not a processor", n.name)
+	}
+
+	return p, l.Node().Id(), nil
+}
+
+// walkExpressions calls fn for every string within the JSON value that is an
+// expression.
+func walkExpressions(v interface{}, fn func(s string, e expression) (interface{}, error)) error {
+	_, err := replaceExpressions(v, fn)
+	return err
+}
+
+// replaceExpressions replaces every string within the JSON value that is an
+// expression with the value returned by fn.
+func replaceExpressions(v interface{}, fn func(s string, e expression) (interface{}, error)) (interface{}, error) {
+	switch t := v.(type) {
+	case string:
+		e, err := parseExpression(t)
+		if err == errNotExpression {
+			return t, nil
+		} else if err != nil {
+			return nil, err
+		}
+		return fn(t, e)
+	case []interface{}:
+		for i := range t {
+			r, err := replaceExpressions(t[i], fn)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = r
+		}
+	case map[string]interface{}:
+		for k := range t {
+			r, err := replaceExpressions(t[k], fn)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = r
+		}
+	}
+
+	return v, nil
+}
@@ -0,0 +1,97 @@
+package drawgl
+
+import "github.com/urandom/graph"
+
+// OptionType is the type of an operation option, as it is written in a JSON
+// graph definition.
+type OptionType string
+
+const (
+	StringOption  OptionType = "string"
+	IntegerOption OptionType = "integer"
+	NumberOption  OptionType = "number"
+	BooleanOption OptionType = "boolean"
+	// LengthOption holds a Length, either a number of pixels, or a string
+	// such as "50%"
+	LengthOption OptionType = "length"
+	// ChannelOption holds a Channel, such as "RGB" or "RGA"
+	ChannelOption OptionType = "channel"
+	// MaskOption holds the rectangle of a Mask
+	MaskOption OptionType = "mask"
+	// EdgeHandlerOption holds an EdgeHandler, either one of EdgeNames, a
+	// constant color such as {"Constant": [1, 1, 1, 1]}, or one of the
+	// deprecated integer values
+	EdgeHandlerOption OptionType = "edge"
+	// ExpressionOption holds an expression, evaluated by the node itself
+	ExpressionOption OptionType = "expression"
+	ArrayOption      OptionType = "array"
+	ObjectOption     OptionType = "object"
+	// AnyOption holds any JSON value
+	AnyOption OptionType = "any"
+)
+
+// Descriptor documents an operation that can be used in JSON graph
+// definitions.
+type Descriptor struct {
+	Name string
+	// Doc describes the operation. Its first line is used as a summary.
+	Doc     string
+	Inputs  []ConnectorDescriptor
+	Outputs []ConnectorDescriptor
+	Options []OptionDescriptor
+}
+
+// ConnectorDescriptor documents an input or output of an operation.
+type ConnectorDescriptor struct {
+	Name graph.ConnectorName
+	Doc  string
+}
+
+// OptionDescriptor documents an option of an operation, or a field or
+// element of another option.
+type OptionDescriptor struct {
+	Name string `json:",omitempty"`
+	Type OptionType
+	Doc  string `json:",omitempty"`
+	// Default holds the value used when the option is not given, if any
+	Default  interface{} `json:",omitempty"`
+	Required bool        `json:",omitempty"`
+	// Enum holds the accepted values of a string option
+	Enum []string `json:",omitempty"`
+	// Items describes the elements of an array option, or the values of an
+	// object option without Fields. Size, if positive, is the exact number
+	// of elements of an array.
+	Items *OptionDescriptor `json:",omitempty"`
+	Size  int               `json:",omitempty"`
+	// Fields describes the fields of an object option
+	Fields []OptionDescriptor `json:",omitempty"`
+}
+
+// CommonOptions returns the descriptors of the Channel, Mask and Linear
+// options, shared by most operations that modify an image.
+func CommonOptions() []OptionDescriptor {
+	return []OptionDescriptor{
+		{Name: "Channel", Type: ChannelOption, Default: "RGB", Doc: "the channels that are modified"},
+		{Name: "Mask", Type: MaskOption, Doc: "limits the operation to the given rectangle"},
+		{Name: "Linear", Type: BooleanOption, Default: false, Doc: "process the pixels sequentially, instead of in parallel"},
+	}
+}
+
+// EdgeOption returns the descriptor of the Edge option, of operations that
+// read the neighborhood of a pixel.
+func EdgeOption() OptionDescriptor {
+	return OptionDescriptor{
+		Name: "Edge", Type: EdgeHandlerOption, Default: "extend",
+		Doc: "how the points beyond the sides of the image are colored",
+	}
+}
+
+// MainInput returns the descriptor of the main input of an operation.
+func MainInput() ConnectorDescriptor {
+	return ConnectorDescriptor{Name: graph.InputName, Doc: "the image to process"}
+}
+
+// MainOutput returns the descriptor of the main output of an operation.
+func MainOutput() ConnectorDescriptor {
+	return ConnectorDescriptor{Name: graph.OutputName, Doc: "the processed image"}
+}
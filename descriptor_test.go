@@ -0,0 +1,149 @@
+package drawgl_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/urandom/drawgl"
+	_ "github.com/urandom/drawgl/operation"
+)
+
+func TestDescriptors(t *testing.T) {
+	registered := map[string]bool{}
+	for _, name := range drawgl.LinkerNames() {
+		registered[name] = true
+	}
+
+	for _, name := range []string{
+		"BoxBlur", "ColorSpace", "Convolution", "CopyExif", "Crop", "Group", "If", "Load",
+		"Rotate", "Save", "Scale", "Switch", "Transform", "Translate",
+	} {
+		if _, ok := drawgl.Describe(name); !ok {
+			t.Fatalf("Expected %s to be described\n", name)
+		}
+	}
+
+	for _, d := range drawgl.Descriptors() {
+		if !registered[d.Name] {
+			t.Fatalf("Expected %s to be registered\n", d.Name)
+		}
+
+		if d.Doc == "" {
+			t.Fatalf("Expected %s to be documented\n", d.Name)
+		}
+
+		// The factory must accept every described option
+		opts := map[string]interface{}{}
+		for _, o := range d.Options {
+			opts[o.Name] = sampleOption(o)
+		}
+
+		b, err := json.Marshal(map[string]interface{}{"Name": d.Name, "Options": opts})
+		if err != nil {
+			t.Fatalf("Error encoding the options of %s: %v\n", d.Name, err)
+		}
+
+		if err := drawgl.ValidateJSON(strings.NewReader(string(b)), nil); err != nil && strings.Contains(err.Error(), "unknown field") {
+			t.Fatalf("Expected the options of %s to be known: %v\n", d.Name, err)
+		}
+	}
+
+	if _, ok := drawgl.Describe("Unknown"); ok {
+		t.Fatalf("Expected no descriptor for an unknown linker\n")
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	b, err := drawgl.JSONSchema()
+	if err != nil {
+		t.Fatalf("Error generating the schema: %v\n", err)
+	}
+
+	var schema struct {
+		Definitions struct {
+			Node struct {
+				Properties struct {
+					Name struct{ Enum []string }
+				}
+				AllOf []struct {
+					Then struct {
+						Properties struct {
+							Options struct {
+								Properties map[string]json.RawMessage
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if err := json.Unmarshal(b, &schema); err != nil {
+		t.Fatalf("Error decoding the schema: %v\n", err)
+	}
+
+	node := schema.Definitions.Node
+	if len(node.Properties.Name.Enum) != len(drawgl.LinkerNames()) {
+		t.Fatalf("Expected all linker names in the schema, got %v\n", node.Properties.Name.Enum)
+	}
+
+	if len(node.AllOf) != len(drawgl.Descriptors()) {
+		t.Fatalf("Expected a condition for every descriptor, got %d\n", len(node.AllOf))
+	}
+
+	found := false
+	for _, c := range node.AllOf {
+		if _, ok := c.Then.Properties.Options.Properties["Interpolator"]; ok {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatalf("Expected the Interpolator option in the schema\n")
+	}
+}
+
+// sampleOption returns a value of the option's type.
+func sampleOption(o drawgl.OptionDescriptor) interface{} {
+	switch o.Type {
+	case drawgl.StringOption:
+		if len(o.Enum) > 0 {
+			return o.Enum[0]
+		}
+		return "value"
+	case drawgl.IntegerOption, drawgl.NumberOption:
+		return 1
+	case drawgl.BooleanOption:
+		return false
+	case drawgl.LengthOption:
+		return "1"
+	case drawgl.ChannelOption:
+		return "RGB"
+	case drawgl.EdgeHandlerOption:
+		return "mirror"
+	case drawgl.ExpressionOption:
+		return "true"
+	case drawgl.ArrayOption:
+		size := o.Size
+		if size == 0 {
+			size = 1
+		}
+
+		items := make([]interface{}, size)
+		for i := range items {
+			if o.Items != nil {
+				items[i] = sampleOption(*o.Items)
+			}
+		}
+		return items
+	case drawgl.ObjectOption:
+		fields := map[string]interface{}{}
+		for _, f := range o.Fields {
+			fields[f.Name] = sampleOption(f)
+		}
+		return fields
+	default:
+		return nil
+	}
+}
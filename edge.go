@@ -0,0 +1,182 @@
+package drawgl
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+)
+
+// EdgeHandler determines the colors of the points outside of an image,
+// which operations reading the neighborhood of a pixel may require. The
+// zero value is Extend.
+type EdgeHandler struct {
+	mode  edgeMode
+	color FloatColor
+}
+
+type edgeMode int
+
+const (
+	extendEdge edgeMode = iota
+	wrapEdge
+	mirrorEdge
+	constantEdge
+)
+
+var (
+	// Extend repeats the nearest pixel of the image
+	Extend = EdgeHandler{mode: extendEdge}
+	// Wrap tiles the image, continuing from its opposite side
+	Wrap = EdgeHandler{mode: wrapEdge}
+	// Mirror reflects the image along its sides, repeating the pixels of
+	// the sides themselves
+	Mirror = EdgeHandler{mode: mirrorEdge}
+	// Transparent treats the points outside of the image as transparent
+	Transparent = Constant(FloatColor{})
+)
+
+var edgeNames = map[edgeMode]string{
+	extendEdge: "extend",
+	wrapEdge:   "wrap",
+	mirrorEdge: "mirror",
+}
+
+// EdgeNames lists the names of the edge handlers, as used in JSON. A
+// constant color is given as {"Constant": [r, g, b, a]} instead. The former
+// integer values, 0 for extend and 1 for wrap, are also accepted.
+var EdgeNames = []string{"extend", "wrap", "mirror", "transparent"}
+
+// Constant returns an edge handler that treats the points outside of the
+// image as having the given premultiplied color.
+func Constant(c FloatColor) EdgeHandler {
+	return EdgeHandler{mode: constantEdge, color: c}
+}
+
+func (h EdgeHandler) String() string {
+	switch {
+	case h == Transparent:
+		return "transparent"
+	case h.mode == constantEdge:
+		return fmt.Sprintf("constant%v", h.color)
+	default:
+		return edgeNames[h.mode]
+	}
+}
+
+// ParseEdgeHandler returns the edge handler with the given name.
+func ParseEdgeHandler(name string) (EdgeHandler, error) {
+	if name == "transparent" {
+		return Transparent, nil
+	}
+
+	for mode, n := range edgeNames {
+		if n == name {
+			return EdgeHandler{mode: mode}, nil
+		}
+	}
+
+	return EdgeHandler{}, fmt.Errorf("unknown edge handler %q", name)
+}
+
+func (h EdgeHandler) MarshalJSON() ([]byte, error) {
+	if h.mode == constantEdge && h != Transparent {
+		c := h.color
+		return json.Marshal(struct{ Constant [4]ColorValue }{[4]ColorValue{c.R, c.G, c.B, c.A}})
+	}
+
+	return json.Marshal(h.String())
+}
+
+// legacyEdges holds the edge handlers by their former integer values, which
+// older definitions may still use.
+var legacyEdges = []EdgeHandler{Extend, Wrap}
+
+func (h *EdgeHandler) UnmarshalJSON(b []byte) (err error) {
+	var name string
+	if err = json.Unmarshal(b, &name); err == nil {
+		*h, err = ParseEdgeHandler(name)
+		return
+	}
+
+	var n int
+	if err = json.Unmarshal(b, &n); err == nil {
+		if n < 0 || n >= len(legacyEdges) {
+			return fmt.Errorf("unknown edge handler %s", b)
+		}
+
+		*h = legacyEdges[n]
+		return nil
+	}
+
+	var constant struct{ Constant *[4]ColorValue }
+	if err = json.Unmarshal(b, &constant); err != nil || constant.Constant == nil {
+		return fmt.Errorf("unknown edge handler %s", b)
+	}
+
+	c := constant.Constant
+	*h = Constant(FloatColor{R: c[0], G: c[1], B: c[2], A: c[3]})
+
+	return nil
+}
+
+// Whole reports whether the edge handler may read any point of the image,
+// regardless of how close the requested points are.
+func (h EdgeHandler) Whole() bool {
+	return h.mode == wrapEdge
+}
+
+// TranslateCoords maps the point to one within the bounds, according to
+// the edge handler. Points of constant handlers, including Transparent, are
+// returned as they are, as they have no corresponding point; EdgeColor
+// provides their color.
+func TranslateCoords(x, y int, b image.Rectangle, h EdgeHandler) (mx, my int) {
+	return translateCoord(x, b.Min.X, b.Max.X, h.mode), translateCoord(y, b.Min.Y, b.Max.Y, h.mode)
+}
+
+func translateCoord(v, min, max int, mode edgeMode) int {
+	if v >= min && v < max || min >= max {
+		return v
+	}
+
+	size := max - min
+
+	switch mode {
+	case wrapEdge:
+		v = (v - min) % size
+		if v < 0 {
+			v += size
+		}
+		return min + v
+	case mirrorEdge:
+		v = (v - min) % (2 * size)
+		if v < 0 {
+			v += 2 * size
+		}
+		if v >= size {
+			v = 2*size - 1 - v
+		}
+		return min + v
+	case extendEdge:
+		if v < min {
+			return min
+		}
+		return max - 1
+	default:
+		return v
+	}
+}
+
+// EdgeColor returns the color of the point of the image, mapping points
+// outside of the bounds b with the edge handler. The image has to contain
+// the mapped points.
+func EdgeColor(img *FloatImage, x, y int, b image.Rectangle, h EdgeHandler) FloatColor {
+	if !(image.Point{x, y}).In(b) {
+		if h.mode == constantEdge {
+			return h.color
+		}
+
+		x, y = TranslateCoords(x, y, b, h)
+	}
+
+	return img.UnsafeFloatAt(x, y)
+}
@@ -0,0 +1,117 @@
+package drawgl_test
+
+import (
+	"encoding/json"
+	"image"
+	"testing"
+
+	"github.com/urandom/drawgl"
+)
+
+func TestTranslateCoords(t *testing.T) {
+	b := image.Rect(2, 2, 6, 6)
+
+	cases := []struct {
+		edge     drawgl.EdgeHandler
+		in, want []int
+	}{
+		{drawgl.Extend, []int{-7, 1, 2, 5, 6, 20}, []int{2, 2, 2, 5, 5, 5}},
+		{drawgl.Wrap, []int{-7, -3, 1, 2, 5, 6, 11, 20}, []int{5, 5, 5, 2, 5, 2, 3, 4}},
+		{drawgl.Mirror, []int{-6, -3, -2, 0, 1, 2, 5, 6, 9, 10, 11, 20}, []int{2, 5, 5, 3, 2, 2, 5, 5, 2, 2, 3, 4}},
+		{drawgl.Transparent, []int{-7, 1, 2, 5, 6, 20}, []int{-7, 1, 2, 5, 6, 20}},
+	}
+
+	for _, c := range cases {
+		for i, v := range c.in {
+			if x, y := drawgl.TranslateCoords(v, 3, b, c.edge); x != c.want[i] || y != 3 {
+				t.Fatalf("%s: expected %d to map to %d:3, got %d:%d\n", c.edge, v, c.want[i], x, y)
+			}
+
+			if x, y := drawgl.TranslateCoords(4, v, b, c.edge); x != 4 || y != c.want[i] {
+				t.Fatalf("%s: expected %d to map to 4:%d, got %d:%d\n", c.edge, v, c.want[i], x, y)
+			}
+		}
+	}
+}
+
+func TestEdgeColor(t *testing.T) {
+	b := image.Rect(0, 0, 3, 1)
+	img := drawgl.NewFloatImage(b)
+	for x := 0; x < 3; x++ {
+		img.UnsafeSetColor(x, 0, drawgl.FloatColor{R: drawgl.ColorValue(x+1) / 4, A: 1})
+	}
+
+	red := drawgl.FloatColor{R: 0.5, A: 0.5}
+
+	cases := []struct {
+		edge drawgl.EdgeHandler
+		x    int
+		want drawgl.FloatColor
+	}{
+		{drawgl.Extend, -2, img.FloatAt(0, 0)},
+		{drawgl.Wrap, -2, img.FloatAt(1, 0)},
+		{drawgl.Mirror, -2, img.FloatAt(1, 0)},
+		{drawgl.Transparent, -2, drawgl.FloatColor{}},
+		{drawgl.Constant(red), 3, red},
+		{drawgl.Constant(red), 2, img.FloatAt(2, 0)},
+	}
+
+	for _, c := range cases {
+		if col := drawgl.EdgeColor(img, c.x, 0, b, c.edge); col != c.want {
+			t.Fatalf("%s: expected %v at %d, got %v\n", c.edge, c.want, c.x, col)
+		}
+	}
+}
+
+func TestEdgeHandlerJSON(t *testing.T) {
+	for _, name := range drawgl.EdgeNames {
+		var h drawgl.EdgeHandler
+		if err := json.Unmarshal([]byte(`"`+name+`"`), &h); err != nil {
+			t.Fatalf("Error decoding %s: %v\n", name, err)
+		}
+
+		if h.String() != name {
+			t.Fatalf("Expected %s, got %s\n", name, h)
+		}
+
+		if b, err := json.Marshal(h); err != nil || string(b) != `"`+name+`"` {
+			t.Fatalf("Unexpected encoding of %s: %s, %v\n", name, b, err)
+		}
+	}
+
+	var h drawgl.EdgeHandler
+	if err := json.Unmarshal([]byte(`{"Constant": [0.5, 0, 0.25, 0.5]}`), &h); err != nil {
+		t.Fatalf("Error decoding a constant: %v\n", err)
+	}
+
+	if h != drawgl.Constant(drawgl.FloatColor{R: 0.5, B: 0.25, A: 0.5}) {
+		t.Fatalf("Unexpected constant %s\n", h)
+	}
+
+	b, err := json.Marshal(h)
+	if err != nil {
+		t.Fatalf("Error encoding a constant: %v\n", err)
+	}
+
+	var decoded drawgl.EdgeHandler
+	if err := json.Unmarshal(b, &decoded); err != nil || decoded != h {
+		t.Fatalf("Expected %s to round trip, got %s, %v\n", b, decoded, err)
+	}
+
+	// Definitions written when the edge handler was an integer
+	for in, want := range map[string]drawgl.EdgeHandler{`0`: drawgl.Extend, `1`: drawgl.Wrap} {
+		if err := json.Unmarshal([]byte(in), &h); err != nil || h != want {
+			t.Fatalf("Expected %s to decode to %s, got %s, %v\n", in, want, h, err)
+		}
+	}
+
+	for _, in := range []string{`"clamp"`, `{"Color": [0, 0, 0, 0]}`, `3`, `-1`, `1.5`} {
+		if err := json.Unmarshal([]byte(in), &h); err == nil {
+			t.Fatalf("Expected an error decoding %s\n", in)
+		}
+	}
+
+	if _, err := drawgl.ParseEdgeHandler(""); err == nil {
+		t.Fatalf("Expected an empty name to be rejected\n")
+	}
+}
@@ -0,0 +1,41 @@
+package drawgl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urandom/graph"
+)
+
+// NodeError is returned when a graph node fails to process its input.
+type NodeError struct {
+	Id graph.Id
+	// Name is the name of the failed node
+	Name string
+	Err  error
+}
+
+// Errors holds multiple errors, produced when a graph continues processing
+// after a node has failed.
+type Errors []error
+
+func (e *NodeError) Error() string {
+	return fmt.Sprintf("processing node %v (%s): %v", e.Id, e.Name, e.Err)
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i := range e {
+		msgs[i] = e[i].Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+func (e Errors) Unwrap() []error {
+	return e
+}
@@ -0,0 +1,158 @@
+package drawgl
+
+import (
+	"context"
+	"image"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/urandom/graph"
+)
+
+type EventKind int
+
+const (
+	NodeStarted EventKind = iota
+	NodeProgress
+	NodeFinished
+	NodeFailed
+	NodeSkipped
+)
+
+// Event describes a change in the processing state of a single graph node.
+type Event struct {
+	Kind EventKind
+	Id   graph.Id
+	// Name is the name of the node, which by convention is the same as the
+	// one its linker is registered with
+	Name string
+	// Duration is the time elapsed since the node was started
+	Duration time.Duration
+	// Bounds holds the bounds of the output buffer of a finished node
+	Bounds image.Rectangle
+	// Progress is an estimate of the fraction of pixels that have been
+	// processed by the node, in the range 0-1
+	Progress float64
+	// Error is the error a failed node produced
+	Error error
+}
+
+// Observer receives events from a processing graph. Since nodes are processed
+// concurrently, it may be called from multiple goroutines at the same time.
+type Observer func(e Event)
+
+type progressKey struct{}
+
+// progress tracks the number of pixels a node's iterators have processed.
+// Nodes with several passes only announce the pixels of a pass once it
+// starts, so the fraction may drop; the reported one never does.
+type progress struct {
+	sync.Mutex
+	total, done int
+	reported    float64
+	notify      func(fraction float64)
+}
+
+const progressStep = 0.01
+
+// NodeName returns the name of the given node, which is the name of its
+// linker for nodes implementing Definer, or the name of its underlying type
+// otherwise.
+func NodeName(n graph.Node) string {
+	if d, ok := n.(Definer); ok {
+		name, _ := d.Definition()
+		return name
+	}
+
+	return reflect.Indirect(reflect.ValueOf(n)).Type().Name()
+}
+
+func (k EventKind) String() string {
+	switch k {
+	case NodeStarted:
+		return "started"
+	case NodeProgress:
+		return "progress"
+	case NodeFinished:
+		return "finished"
+	case NodeFailed:
+		return "failed"
+	case NodeSkipped:
+		return "skipped"
+	}
+
+	return "unknown"
+}
+
+func withProgress(ctx context.Context, p *progress) context.Context {
+	return context.WithValue(ctx, progressKey{}, p)
+}
+
+func progressFromContext(ctx context.Context) *progress {
+	p, _ := ctx.Value(progressKey{}).(*progress)
+	return p
+}
+
+// expect adds a number of pixels that are going to be processed
+func (p *progress) expect(pixels int) {
+	if p == nil {
+		return
+	}
+
+	p.Lock()
+	p.total += pixels
+	p.Unlock()
+}
+
+// advance adds a number of pixels that have been processed
+func (p *progress) advance(pixels int) {
+	if p == nil {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	p.done += pixels
+	f := p.fractionLocked()
+	if p.notify != nil && f > p.reported && (f-p.reported >= progressStep || f == 1) {
+		p.reported = f
+		p.notify(f)
+	}
+}
+
+// pixels returns the number of processed pixels
+func (p *progress) pixels() int64 {
+	if p == nil {
+		return 0
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	return int64(p.done)
+}
+
+func (p *progress) fraction() float64 {
+	if p == nil {
+		return 0
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if f := p.fractionLocked(); f > p.reported {
+		return f
+	}
+
+	return p.reported
+}
+
+func (p *progress) fractionLocked() float64 {
+	if p.total == 0 {
+		return 0
+	}
+
+	return float64(p.done) / float64(p.total)
+}
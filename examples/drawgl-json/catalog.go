@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urandom/drawgl"
+)
+
+// printList prints the registered linkers, along with the summary of the
+// described ones.
+func printList(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, name := range drawgl.LinkerNames() {
+		summary := ""
+		if d, ok := drawgl.Describe(name); ok {
+			summary = strings.SplitN(d.Doc, "\n", 2)[0]
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\n", name, summary)
+	}
+
+	return tw.Flush()
+}
+
+// printDescriptor prints the documentation of a linker, with its connectors
+// and options.
+func printDescriptor(w io.Writer, name string) error {
+	d, ok := drawgl.Describe(name)
+	if !ok {
+		for _, n := range drawgl.LinkerNames() {
+			if n == name {
+				return fmt.Errorf("Linker %q is not described", name)
+			}
+		}
+		return fmt.Errorf("Unknown linker %q", name)
+	}
+
+	fmt.Fprintf(w, "%s\n\n%s\n", d.Name, d.Doc)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, c := range []struct {
+		title      string
+		connectors []drawgl.ConnectorDescriptor
+	}{{"Inputs", d.Inputs}, {"Outputs", d.Outputs}} {
+		if len(c.connectors) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(tw, "\n%s:\n", c.title)
+		for _, conn := range c.connectors {
+			fmt.Fprintf(tw, "  %s\t%s\n", conn.Name, conn.Doc)
+		}
+	}
+
+	if len(d.Options) > 0 {
+		fmt.Fprintln(tw, "\nOptions:")
+		printOptions(tw, d.Options, "  ")
+	}
+
+	return tw.Flush()
+}
+
+func printOptions(w io.Writer, opts []drawgl.OptionDescriptor, indent string) {
+	for _, o := range opts {
+		doc := o.Doc
+		if o.Required {
+			doc += " [required]"
+		}
+		if o.Default != nil {
+			if b, err := json.Marshal(o.Default); err == nil {
+				doc += fmt.Sprintf(" [default %s]", b)
+			}
+		}
+		if len(o.Enum) > 0 {
+			doc += " [one of " + strings.Join(o.Enum, ", ") + "]"
+		}
+
+		fmt.Fprintf(w, "%s%s\t%s\t%s\n", indent, o.Name, optionType(o), doc)
+
+		fields := o.Fields
+		if len(fields) == 0 && o.Items != nil {
+			fields = o.Items.Fields
+		}
+		printOptions(w, fields, indent+"  ")
+	}
+}
+
+// optionType formats the type of an option, including the type of its
+// elements.
+func optionType(o drawgl.OptionDescriptor) string {
+	t := string(o.Type)
+
+	if o.Items != nil && len(o.Items.Fields) == 0 {
+		switch o.Type {
+		case drawgl.ArrayOption:
+			if o.Size > 0 {
+				return fmt.Sprintf("[%d]%s", o.Size, optionType(*o.Items))
+			}
+			return "[]" + optionType(*o.Items)
+		case drawgl.ObjectOption:
+			return "{}" + optionType(*o.Items)
+		}
+	}
+
+	return t
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCatalog(t *testing.T) {
+	var buf bytes.Buffer
+	if err := printList(&buf); err != nil {
+		t.Fatalf("Error listing linkers: %v\n", err)
+	}
+
+	for _, name := range []string{"Load", "Save", "Scale", "Group"} {
+		if !strings.Contains(buf.String(), name) {
+			t.Fatalf("Expected %s in the list:\n%s\n", name, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := printDescriptor(&buf, "Rotate"); err != nil {
+		t.Fatalf("Error describing Rotate: %v\n", err)
+	}
+
+	for _, s := range []string{"Degrees", "[2]length", "Interpolator", "Lanczos", "Input", "Output"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Fatalf("Expected %q in the description:\n%s\n", s, buf.String())
+		}
+	}
+
+	if err := printDescriptor(&buf, "Unknown"); err == nil {
+		t.Fatalf("Expected an error for an unknown linker\n")
+	}
+}
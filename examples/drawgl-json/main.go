@@ -1,24 +1,82 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"runtime"
 	"runtime/pprof"
+	"text/tabwriter"
+	"time"
 
 	"github.com/urandom/drawgl"
 	_ "github.com/urandom/drawgl/operation"
+	"github.com/urandom/drawgl/operation/group"
 	"github.com/urandom/graph"
 )
 
 var (
 	cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 	jsonfile   = flag.String("json", "-", "read graph definition from json file [defaults to standard input]")
+	cacheDir   = flag.String("cache", "", "cache the node results in the given directory")
+	keepGoing  = flag.Bool("continue", false, "continue processing independent nodes when a node fails")
+	tileSize   = flag.Int("tile", 0, "process the images in tiles of the given size")
+	roi        = flag.Bool("roi", false, "compute only the regions of the images that are required by the following nodes")
+	timeout    = flag.Duration("timeout", 0, "abort the processing after the given duration")
+	maxNodes   = flag.Int("nodes", 0, "maximum number of nodes processed at the same time")
+	memory     = flag.Int64("memory", 0, "soft limit on the memory used by the running nodes, in megabytes")
+	report     = flag.String("report", "", "print per-node statistics after processing, as a \"table\" or \"json\"")
+	dotfile    = flag.String("dot", "", "write the graph in the Graphviz DOT language to the given file [- for standard output], instead of processing it")
+	exportfile = flag.String("export", "", "write the parsed graph definition as json to the given file [- for standard output], instead of processing it")
+	validate   = flag.Bool("validate", false, "only check the graph definition for problems, without processing it")
+	batch      = flag.String("batch", "", "process the graph once for every file matching the given glob, or within the given directory")
+	outTmpl    = flag.String("out", "", "template of the output path in batch mode, such as 'out/{{.Name}}.png', passed to the graph as its second argument")
+	workers    = flag.Int("workers", 0, "number of files, or requests in server mode, processed at the same time [defaults to the number of CPUs]")
+	serve      = flag.String("serve", "", "serve http requests on the given address, processing uploaded images with posted graphs, instead of processing a graph")
+	maxRequest = flag.Int64("max-request", 32, "maximum size of a request in server mode, in megabytes")
+	maxPixels  = flag.Int64("max-pixels", 64<<20, "maximum number of pixels of an uploaded image in server mode [0 for no limit]")
+	queue      = flag.Duration("queue", 10*time.Second, "maximum time a request waits for a free worker in server mode, before it is rejected")
+	watch      = flag.Bool("watch", false, "process the graph again whenever the json file, or any loaded file, changes, reusing the results of unchanged nodes")
+	poll       = flag.Duration("poll", 500*time.Millisecond, "interval between checks for changes in watch mode")
+	list       = flag.Bool("list", false, "list the available linkers, instead of processing a graph")
+	describe   = flag.String("describe", "", "print the inputs, outputs and options of the given linker, instead of processing a graph")
+	schemafile = flag.String("schema", "", "write a JSON Schema of graph definitions to the given file [- for standard output], instead of processing a graph")
+	overrides  overrideFlag
 )
 
+// overrideFlag collects the values of the repeatable -set flag.
+type overrideFlag []drawgl.Override
+
+func (f *overrideFlag) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *overrideFlag) Set(value string) error {
+	o, err := drawgl.ParseOverride(value)
+	if err != nil {
+		return err
+	}
+
+	*f = append(*f, o)
+	return nil
+}
+
+// watchCacheSize is the number of node results kept between runs in watch
+// mode, when no cache directory is given.
+const watchCacheSize = 64
+
+func init() {
+	flag.Var(&overrides, "set", "override a node option, as Target.Option=Value, where the target is a node id or name [may be repeated]")
+}
+
 func main() {
 	flag.Parse()
 	if *cpuprofile != "" {
@@ -30,6 +88,29 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	switch {
+	case *list:
+		exitWithError(printList(os.Stdout))
+		return
+	case *describe != "":
+		exitWithError(printDescriptor(os.Stdout, *describe))
+		return
+	case *schemafile != "":
+		exitWithError(writeFile(*schemafile, func(w io.Writer) error {
+			b, err := drawgl.JSONSchema()
+			if err == nil {
+				_, err = fmt.Fprintf(w, "%s\n", b)
+			}
+			return err
+		}))
+		return
+	}
+
+	if *serve != "" {
+		runServer()
+		return
+	}
+
 	var jsonReader io.Reader
 	if *jsonfile == "" {
 		exitWithError(errors.New("No input json file given"))
@@ -43,19 +124,57 @@ func main() {
 		} else {
 			exitWithError(err)
 		}
+
+		// Groups include files relative to the definition
+		o, err := group.IncludedFrom(*jsonfile)
+		if err != nil {
+			exitWithError(err)
+		}
+		overrides = append(overrides, o)
 	}
 
 	args := flag.Args()
 
-	var err error
-	var roots []graph.Linker
-
+	var data *graph.JSONTemplateData
 	if len(args) > 0 {
-		roots, err = graph.ProcessJSON(jsonReader, &graph.JSONTemplateData{Args: args})
-	} else {
-		roots, err = graph.ProcessJSON(jsonReader, nil)
+		data = &graph.JSONTemplateData{Args: args}
+	}
+
+	if *batch != "" {
+		if *validate || *dotfile != "" || *exportfile != "" {
+			exitWithError(errors.New("-batch cannot be combined with -validate, -dot or -export"))
+		}
+
+		runBatch(jsonReader, args)
+		return
+	}
+
+	if *watch {
+		if *jsonfile == "-" || *validate || *dotfile != "" || *exportfile != "" {
+			exitWithError(errors.New("-watch requires a -json file, and cannot be combined with -validate, -dot or -export"))
+		}
+
+		runWatch(data)
+		return
+	}
+
+	if *validate {
+		if err := drawgl.ValidateJSON(jsonReader, data, overrides...); err != nil {
+			if errs, ok := err.(drawgl.Errors); ok {
+				for _, err := range errs {
+					fmt.Fprintln(os.Stderr, err)
+				}
+				os.Exit(1)
+			}
+			exitWithError(err)
+		}
+
+		fmt.Println("JSON definition is valid")
+		return
 	}
 
+	roots, err := drawgl.ProcessJSON(jsonReader, data, overrides...)
+
 	if err != nil {
 		exitWithError(err)
 	}
@@ -64,16 +183,243 @@ func main() {
 		exitWithError(errors.New("Input file contains no node roots"))
 	}
 
-	graph := drawgl.Graph{}
-	err = graph.Process(roots[0])
+	if *dotfile != "" || *exportfile != "" {
+		if *dotfile != "" {
+			exitWithError(writeFile(*dotfile, func(w io.Writer) error {
+				return drawgl.WriteDOT(w, roots...)
+			}))
+		}
+
+		if *exportfile != "" {
+			exitWithError(writeFile(*exportfile, func(w io.Writer) error {
+				b, err := drawgl.MarshalGraph(roots...)
+				if err == nil {
+					_, err = fmt.Fprintf(w, "%s\n", b)
+				}
+				return err
+			}))
+		}
+
+		return
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	graph, err := newGraph()
+	if err != nil {
+		exitWithError(err)
+	}
+
+	errs := graph.ProcessRoots(ctx, roots...)
+
+	failed := false
+	for i, err := range errs {
+		if err != nil {
+			failed = true
+			fmt.Fprintf(os.Stderr, "Error processing json root %d: %v\n", i, err)
+		}
+	}
+
+	if graph.Report != nil {
+		if err := printReport(os.Stdout, graph.Report, *report); err != nil {
+			exitWithError(err)
+		}
+	}
 
-	if err == nil {
+	if !failed {
 		fmt.Println("JSON processing done")
-	} else {
-		fmt.Fprintf(os.Stderr, "Error processing json: %v\n", err)
 	}
 }
 
+// newGraph configures a graph from the command line flags.
+func newGraph() (drawgl.Graph, error) {
+	graph := drawgl.Graph{
+		ContinueOnError:    *keepGoing,
+		TileSize:           *tileSize,
+		RegionOfInterest:   *roi,
+		MaxConcurrentNodes: *maxNodes,
+		MemoryBudget:       *memory << 20,
+	}
+
+	switch *report {
+	case "":
+	case "table", "json":
+		graph.Report = &drawgl.Report{}
+	default:
+		return graph, fmt.Errorf("Unknown report format %q", *report)
+	}
+
+	if *cacheDir != "" {
+		var err error
+		if graph.Cache, err = drawgl.NewDirCache(*cacheDir); err != nil {
+			return graph, err
+		}
+	}
+
+	return graph, nil
+}
+
+// runBatch processes the graph definition for every file matched by the
+// -batch flag, and prints a summary of the failures.
+func runBatch(jsonReader io.Reader, args []string) {
+	if *outTmpl == "" {
+		exitWithError(errors.New("-batch requires an -out template"))
+	}
+
+	def, err := ioutil.ReadAll(jsonReader)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	inputs, err := drawgl.BatchInputs(*batch)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	if len(inputs) == 0 {
+		exitWithError(fmt.Errorf("No files match %q", *batch))
+	}
+
+	graph, err := newGraph()
+	if err != nil {
+		exitWithError(err)
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	b := drawgl.Batch{
+		Definition: def,
+		Output:     *outTmpl,
+		Args:       args,
+		Overrides:  overrides,
+		Workers:    *workers,
+		Graph:      graph,
+	}
+
+	summary, err := b.Run(ctx, inputs)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	if graph.Report != nil {
+		if err := printReport(os.Stdout, graph.Report, *report); err != nil {
+			exitWithError(err)
+		}
+	}
+
+	fmt.Printf("Processed %d files, %d failed\n", summary.Processed, len(summary.Failures))
+	if len(summary.Failures) > 0 {
+		for _, f := range summary.Failures {
+			fmt.Fprintf(os.Stderr, "\t%s: %v\n", f.Item.Path, f.Err)
+		}
+		os.Exit(1)
+	}
+}
+
+// runWatch processes the graph whenever its files change, until the
+// program is interrupted.
+func runWatch(data *graph.JSONTemplateData) {
+	graph, err := newGraph()
+	if err != nil {
+		exitWithError(err)
+	}
+
+	if graph.Cache == nil {
+		graph.Cache = drawgl.NewMemoryCache(watchCacheSize)
+	}
+
+	w := watcher{
+		path:      *jsonfile,
+		data:      data,
+		overrides: overrides,
+		graph:     graph,
+		interval:  *poll,
+		timeout:   *timeout,
+		out:       os.Stdout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	w.run(ctx)
+}
+
+// runServer serves http requests until the server fails.
+func runServer() {
+	graph, err := newGraph()
+	if err != nil {
+		exitWithError(err)
+	}
+	// Reports would only grow with every request
+	graph.Report = nil
+
+	concurrency := *workers
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	log.Printf("Serving on %s", *serve)
+	exitWithError(http.ListenAndServe(*serve, newServer(graph, *maxRequest<<20, *maxPixels, concurrency, *timeout, *queue)))
+}
+
+func printReport(w io.Writer, report *drawgl.Report, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+
+		return enc.Encode(report)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Linker\tId\tTime\tPixels\tBuffers\tPeak bytes\t")
+	for _, s := range report.Nodes() {
+		name := s.Name
+		switch {
+		case s.Cached:
+			name += " (cached)"
+		case s.Deferred:
+			name += " (deferred)"
+		case s.Skipped:
+			name += " (skipped)"
+		case s.Error != "":
+			name += " (failed)"
+		}
+
+		fmt.Fprintf(tw, "%s\t%v\t%v\t%d\t%d\t%d\t\n",
+			name, s.Id, s.Duration, s.Pixels, s.Buffers, s.PeakBytes)
+	}
+
+	return tw.Flush()
+}
+
+func writeFile(path string, fn func(w io.Writer) error) error {
+	if path == "-" {
+		return fn(os.Stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err = fn(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
 func exitWithError(err error) {
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
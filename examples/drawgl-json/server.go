@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/urandom/drawgl"
+	dio "github.com/urandom/drawgl/operation/io"
+	"github.com/urandom/graph"
+)
+
+// server processes uploaded images with posted graph definitions.
+//
+// POST /process expects a multipart form, with the image in the "image"
+// file, and the graph definition in the "graph" field or file. The roots of
+// the graph receive the decoded image, and the result of its only leaf, or
+// of the node whose Id is given in the "output" field, is encoded in the
+// "format" field's type, png by default, and streamed back. Each "set" field
+// overrides a node option, as the -set flag does. Without a graph, the image
+// is only converted. Graphs can only contain the nodes in allowed. Images
+// with more than maxPixels pixels are rejected before they are decoded. A
+// request that finds every worker busy waits for at most queue before it is
+// rejected.
+//
+// GET /health reports whether the server is up, along with the number of
+// requests being processed.
+type server struct {
+	graph     drawgl.Graph
+	maxBytes  int64
+	maxPixels int64
+	timeout   time.Duration
+	queue     time.Duration
+	slots     chan struct{}
+	running   int32
+}
+
+// allowed holds the nodes that posted graphs can use. They only process the
+// image they receive, unlike the ones that access the server's files or run
+// its programs.
+var allowed = map[string]bool{
+	"BoxBlur": true, "ColorSpace": true, "Convolution": true, "Crop": true,
+	"If": true, "Rotate": true, "Scale": true, "Switch": true,
+	"Transform": true, "Translate": true,
+}
+
+type httpError struct {
+	status int
+	err    error
+}
+
+// responseWriter sets the headers of the response on the first write, so
+// that errors that occur before any output can still be reported.
+type responseWriter struct {
+	http.ResponseWriter
+	contentType string
+	written     bool
+}
+
+func newServer(g drawgl.Graph, maxBytes, maxPixels int64, concurrency int, timeout, queue time.Duration) http.Handler {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	s := &server{
+		graph:     g,
+		maxBytes:  maxBytes,
+		maxPixels: maxPixels,
+		timeout:   timeout,
+		queue:     queue,
+		slots:     make(chan struct{}, concurrency),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", s.health)
+	mux.HandleFunc("/process", s.process)
+
+	return mux
+}
+
+func (s *server) health(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Status   string
+		Running  int32
+		Capacity int
+	}{"ok", atomic.LoadInt32(&s.running), cap(s.slots)})
+}
+
+func (s *server) process(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	if !s.acquire(ctx) {
+		http.Error(w, "server busy", http.StatusServiceUnavailable)
+		return
+	}
+	defer func() { <-s.slots }()
+
+	atomic.AddInt32(&s.running, 1)
+	defer atomic.AddInt32(&s.running, -1)
+
+	if s.maxBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxBytes)
+	}
+
+	rw := &responseWriter{ResponseWriter: w}
+	if herr := s.run(ctx, rw, r); herr != nil {
+		if rw.written {
+			// The status has already been sent
+			log.Printf("Error processing request: %v", herr.err)
+			return
+		}
+
+		http.Error(w, herr.err.Error(), herr.status)
+	}
+}
+
+// acquire takes a free slot, waiting for at most the queue duration, or
+// until the context is done.
+func (s *server) acquire(ctx context.Context) bool {
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if s.queue <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(s.queue)
+	defer timer.Stop()
+
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// run builds the graph of the request, and processes it, writing the
+// encoded result to w.
+func (s *server) run(ctx context.Context, w *responseWriter, r *http.Request) *httpError {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return &httpError{http.StatusRequestEntityTooLarge, err}
+		}
+		return &httpError{http.StatusBadRequest, err}
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	upload, _, err := r.FormFile("image")
+	if err != nil {
+		return &httpError{http.StatusBadRequest, fmt.Errorf("reading image: %v", err)}
+	}
+	defer upload.Close()
+
+	// A small file may declare huge dimensions, which would only be found
+	// out once the whole image is allocated
+	config, _, err := image.DecodeConfig(upload)
+	if err != nil {
+		return &httpError{http.StatusUnprocessableEntity, fmt.Errorf("decoding image: %v", err)}
+	}
+
+	if pixels := int64(config.Width) * int64(config.Height); s.maxPixels > 0 && pixels > s.maxPixels {
+		return &httpError{http.StatusRequestEntityTooLarge,
+			fmt.Errorf("the image has %dx%d pixels, more than the limit of %d", config.Width, config.Height, s.maxPixels)}
+	}
+
+	if _, err := upload.Seek(0, io.SeekStart); err != nil {
+		return &httpError{http.StatusInternalServerError, err}
+	}
+
+	var def io.Reader
+	if f, _, err := r.FormFile("graph"); err == nil {
+		defer f.Close()
+		def = f
+	} else if v := r.FormValue("graph"); v != "" {
+		def = strings.NewReader(v)
+	}
+
+	var overrides []drawgl.Override
+	for _, v := range r.MultipartForm.Value["set"] {
+		o, err := drawgl.ParseOverride(v)
+		if err != nil {
+			return &httpError{http.StatusBadRequest, err}
+		}
+		overrides = append(overrides, o)
+	}
+
+	format := r.FormValue("format")
+	switch format {
+	case "":
+		format = "png"
+	case "png", "jpeg", "gif":
+	default:
+		return &httpError{http.StatusBadRequest, fmt.Errorf("unknown format %q", format)}
+	}
+	w.contentType = "image/" + format
+
+	load, err := dio.NewLoadLinker(dio.LoadOptions{Reader: upload})
+	if err != nil {
+		return &httpError{http.StatusInternalServerError, err}
+	}
+
+	save, err := dio.NewSaveLinker(dio.SaveOptions{Writer: w, Type: format})
+	if err != nil {
+		return &httpError{http.StatusInternalServerError, err}
+	}
+
+	out := load
+	if def != nil {
+		g, err := drawgl.ReadJSON(def, nil, overrides...)
+		if err != nil {
+			return &httpError{http.StatusBadRequest, err}
+		}
+
+		for _, l := range g.Linkers {
+			if name := drawgl.NodeName(l.Node()); !allowed[name] {
+				return &httpError{http.StatusBadRequest, fmt.Errorf("%s nodes are not allowed", name)}
+			}
+		}
+
+		// The leaves have to be found before the graph is connected to the
+		// image
+		if out, err = outputNode(g, r.FormValue("output")); err != nil {
+			return &httpError{http.StatusBadRequest, err}
+		}
+
+		for _, root := range g.Roots {
+			if err := load.Link(root, graph.OutputName, graph.InputName); err != nil {
+				return &httpError{http.StatusBadRequest, err}
+			}
+		}
+	}
+
+	if err := out.Link(save, graph.OutputName, graph.InputName); err != nil {
+		return &httpError{http.StatusBadRequest, err}
+	}
+
+	if err := s.graph.ProcessContext(ctx, load); err != nil {
+		status := http.StatusUnprocessableEntity
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		}
+		return &httpError{status, err}
+	}
+
+	return nil
+}
+
+// outputNode returns the node with the given id, or the only leaf of the
+// graph if no id is given.
+func outputNode(g drawgl.JSONGraph, id string) (graph.Linker, error) {
+	if id != "" {
+		l, ok := g.Nodes[id]
+		if !ok {
+			return nil, fmt.Errorf("unknown output node id %q", id)
+		}
+		return l, nil
+	}
+
+	parents := make(map[graph.Id]bool)
+	for _, root := range g.Roots {
+		for wd := range graph.NewWalker(root).Walk() {
+			for _, p := range wd.Parents {
+				parents[p.Node.Id()] = true
+			}
+
+			wd.Close()
+		}
+	}
+
+	var leaves []graph.Linker
+	for _, l := range g.Linkers {
+		if !parents[l.Node().Id()] {
+			leaves = append(leaves, l)
+		}
+	}
+
+	if len(leaves) != 1 {
+		return nil, fmt.Errorf("the graph has %d leaves, select the output node by its id", len(leaves))
+	}
+
+	return leaves[0], nil
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.written = true
+		w.Header().Set("Content-Type", w.contentType)
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
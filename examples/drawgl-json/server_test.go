@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	_ "image/gif"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/operation/tests"
+)
+
+func TestServer(t *testing.T) {
+	img, err := ioutil.ReadFile(filepath.Join(tests.TestDataDir(), "test.png"))
+	if err != nil {
+		t.Fatalf("Error reading test image: %v\n", err)
+	}
+
+	ts := httptest.NewServer(newServer(drawgl.Graph{}, 1<<20, 1<<20, 2, 0, time.Second))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/health")
+	if err != nil {
+		t.Fatalf("Error requesting health: %v\n", err)
+	}
+
+	var health struct{ Status string }
+	err = json.NewDecoder(resp.Body).Decode(&health)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK || health.Status != "ok" {
+		t.Fatalf("Unexpected health response %d %v: %v\n", resp.StatusCode, health, err)
+	}
+
+	cases := []struct {
+		fields map[string]string
+		image  []byte
+		status int
+		format string
+		size   image.Point
+	}{
+		{
+			fields: map[string]string{"graph": `{"Name": "BoxBlur", "Outputs": {"Output": {"Name": "Scale", "Options": {"Width": 2, "Crop": true}}}}`},
+			image:  img, status: http.StatusOK, format: "png", size: image.Pt(2, 2),
+		},
+		{
+			fields: map[string]string{"format": "gif"},
+			image:  img, status: http.StatusOK, format: "gif", size: image.Pt(4, 4),
+		},
+		{
+			fields: map[string]string{
+				"graph":  `{"Name": "BoxBlur", "Outputs": {"Output": [{"Id": "small", "Name": "Scale", "Options": {"Width": 1, "Crop": true}}, {"Name": "BoxBlur"}]}}`,
+				"output": "small",
+			},
+			image: img, status: http.StatusOK, format: "png", size: image.Pt(1, 1),
+		},
+		{
+			fields: map[string]string{"graph": `{"Name": "BoxBlur", "Outputs": {"Output": [{"Name": "BoxBlur"}, {"Name": "BoxBlur"}]}}`},
+			image:  img, status: http.StatusBadRequest,
+		},
+		{
+			fields: map[string]string{"graph": `{"Name": "Save", "Options": {"Path": "/tmp/out.png"}}`},
+			image:  img, status: http.StatusBadRequest,
+		},
+		{
+			fields: map[string]string{"graph": `{"Name": "CopyExif", "Options": {"Executable": "true", "OutputPath": "/tmp/out.png"}}`},
+			image:  img, status: http.StatusBadRequest,
+		},
+		{
+			fields: map[string]string{"graph": `{"Name": "Unknown"}`},
+			image:  img, status: http.StatusBadRequest,
+		},
+		{
+			fields: map[string]string{},
+			image:  []byte("not an image"), status: http.StatusUnprocessableEntity,
+		},
+		{
+			fields: map[string]string{},
+			image:  bytes.Repeat(img, (1<<20)/len(img)+1), status: http.StatusRequestEntityTooLarge,
+		},
+		{
+			// A 13 byte gif declaring 65535x65535 pixels
+			fields: map[string]string{},
+			image:  []byte("GIF89a\xff\xff\xff\xff\x00\x00\x00"), status: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for i, c := range cases {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for k, v := range c.fields {
+			mw.WriteField(k, v)
+		}
+
+		fw, _ := mw.CreateFormFile("image", "test.png")
+		fw.Write(c.image)
+		mw.Close()
+
+		resp, err := http.Post(ts.URL+"/process", mw.FormDataContentType(), &body)
+		if err != nil {
+			t.Fatalf("Case %d: error posting: %v\n", i, err)
+		}
+
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != c.status {
+			t.Fatalf("Case %d: expected status %d, got %d: %s\n", i, c.status, resp.StatusCode, b)
+		}
+
+		if c.status != http.StatusOK {
+			continue
+		}
+
+		if ct := resp.Header.Get("Content-Type"); ct != "image/"+c.format {
+			t.Fatalf("Case %d: expected image/%s, got %s\n", i, c.format, ct)
+		}
+
+		config, format, err := image.DecodeConfig(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("Case %d: error decoding the response: %v\n", i, err)
+		}
+
+		if format != c.format || config.Width != c.size.X || config.Height != c.size.Y {
+			t.Fatalf("Case %d: expected a %v %s, got %dx%d %s\n", i, c.size, c.format, config.Width, config.Height, format)
+		}
+	}
+
+	resp, err = http.Get(ts.URL + "/process")
+	if err != nil {
+		t.Fatalf("Error requesting process: %v\n", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected GET /process to be rejected, got %d\n", resp.StatusCode)
+	}
+}
+
+func TestServerQueue(t *testing.T) {
+	ts := httptest.NewServer(newServer(drawgl.Graph{}, 1<<20, 1<<20, 1, 0, 50*time.Millisecond))
+	defer ts.Close()
+
+	// A slow upload holds the only worker
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	go func() {
+		resp, err := http.Post(ts.URL+"/process", "multipart/form-data; boundary=x", pr)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	pw.Write([]byte("--x\r\n"))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(ts.URL + "/health")
+		if err != nil {
+			t.Fatalf("Error requesting health: %v\n", err)
+		}
+
+		var health struct{ Running int32 }
+		err = json.NewDecoder(resp.Body).Decode(&health)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Error decoding health: %v\n", err)
+		}
+
+		if health.Running == 1 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the slow upload to take the worker\n")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	resp, err := http.Post(ts.URL+"/process", "multipart/form-data; boundary=x", bytes.NewReader(nil))
+	if err != nil {
+		t.Fatalf("Error posting: %v\n", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected a busy server to reply with %d, got %d\n", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Expected the request to be rejected after the queue wait, took %v\n", elapsed)
+	}
+}
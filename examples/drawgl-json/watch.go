@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/operation/group"
+	dio "github.com/urandom/drawgl/operation/io"
+	"github.com/urandom/graph"
+)
+
+// watcher processes a graph definition file whenever it, or any of the
+// files read by its nodes, changes. The graph is expected to have a cache,
+// so that the nodes whose inputs did not change are not processed again.
+type watcher struct {
+	path      string
+	data      *graph.JSONTemplateData
+	overrides []drawgl.Override
+	graph     drawgl.Graph
+	interval  time.Duration
+	timeout   time.Duration
+	out       io.Writer
+	// done, if not nil, is called after every attempt to process the graph
+	done func(err error)
+}
+
+// stamp identifies a version of a file.
+type stamp struct {
+	size    int64
+	modTime time.Time
+	missing bool
+}
+
+// run processes the graph, and then polls its files, until the context is
+// done. Errors are printed to the output.
+func (w watcher) run(ctx context.Context) {
+	var inputs []string
+	for {
+		// The inputs of the last valid definition are watched while the
+		// definition is invalid
+		if read, ok := w.process(ctx); ok {
+			inputs = read
+		}
+		files := append([]string{w.path}, inputs...)
+
+		stamps := make(map[string]stamp, len(files))
+		for _, f := range files {
+			stamps[f] = fileStamp(f)
+		}
+
+		fmt.Fprintf(w.out, "Watching %d files for changes\n", len(files))
+
+	poll:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(w.interval):
+			}
+
+			for f, s := range stamps {
+				if fileStamp(f) != s {
+					fmt.Fprintf(w.out, "%s changed\n", f)
+					break poll
+				}
+			}
+		}
+	}
+}
+
+// process processes the graph once, returning the files read by its nodes,
+// or false if the definition could not be read.
+func (w watcher) process(ctx context.Context) ([]string, bool) {
+	var inputs []string
+
+	roots, err := w.read()
+	ok := err == nil
+	if ok {
+		inputs = inputFiles(roots)
+
+		if w.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, w.timeout)
+			defer cancel()
+		}
+
+		g := w.graph
+		if g.Report != nil {
+			g.Report = &drawgl.Report{}
+		}
+
+		var errs drawgl.Errors
+		for i, rerr := range g.ProcessRoots(ctx, roots...) {
+			if rerr != nil {
+				errs = append(errs, fmt.Errorf("Error processing json root %d: %v", i, rerr))
+			}
+		}
+
+		if g.Report != nil {
+			if rerr := printReport(w.out, g.Report, *report); rerr != nil {
+				errs = append(errs, rerr)
+			}
+		}
+
+		if len(errs) > 0 {
+			err = errs
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintln(w.out, err)
+	} else {
+		fmt.Fprintln(w.out, "JSON processing done")
+	}
+
+	if w.done != nil {
+		w.done(err)
+	}
+
+	return inputs, ok
+}
+
+func (w watcher) read() ([]graph.Linker, error) {
+	b, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		return nil, err
+	}
+
+	return drawgl.ProcessJSON(bytes.NewReader(b), w.data, w.overrides...)
+}
+
+// inputFiles returns the sorted paths of the files read by the nodes of the
+// graphs, including the nodes of the inner graphs of groups.
+func inputFiles(roots []graph.Linker) []string {
+	seen := make(map[string]bool)
+	addInputFiles(roots, seen)
+
+	files := make([]string, 0, len(seen))
+	for f := range seen {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+
+	return files
+}
+
+func addInputFiles(roots []graph.Linker, seen map[string]bool) {
+	for _, root := range roots {
+		for wd := range graph.NewWalker(root).Walk() {
+			if d, ok := wd.Node.(drawgl.Definer); ok {
+				switch _, opts := d.Definition(); o := opts.(type) {
+				case dio.LoadOptions:
+					if o.Path != "" {
+						seen[o.Path] = true
+					}
+				case group.GroupOptions:
+					if o.Include != "" {
+						seen[o.IncludePath()] = true
+					}
+				}
+			}
+
+			// An inner graph that can no longer be read is still watched
+			// through its include
+			if g, ok := wd.Node.(group.Group); ok {
+				if inner, err := g.InnerGraph(); err == nil {
+					addInputFiles(inner.Roots, seen)
+				}
+			}
+
+			wd.Close()
+		}
+	}
+}
+
+func fileStamp(path string) stamp {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return stamp{missing: true}
+	}
+
+	return stamp{size: fi.Size(), modTime: fi.ModTime()}
+}
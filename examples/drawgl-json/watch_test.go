@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/operation/group"
+	"github.com/urandom/drawgl/operation/tests"
+)
+
+type countingCache struct {
+	drawgl.Cache
+	hits int32
+}
+
+func (c *countingCache) Get(key string) (drawgl.Result, bool) {
+	r, ok := c.Cache.Get(key)
+	if ok {
+		atomic.AddInt32(&c.hits, 1)
+	}
+	return r, ok
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+
+	img, err := ioutil.ReadFile(filepath.Join(tests.TestDataDir(), "test.png"))
+	if err != nil {
+		t.Fatalf("Error reading test image: %v\n", err)
+	}
+
+	in := filepath.Join(dir, "in.png")
+	out := filepath.Join(dir, "out.png")
+	def := filepath.Join(dir, "graph.json")
+
+	if err := ioutil.WriteFile(in, img, 0644); err != nil {
+		t.Fatalf("Error writing the input: %v\n", err)
+	}
+
+	mtime := time.Now()
+	write := func(content string) {
+		if err := ioutil.WriteFile(def, []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing the definition: %v\n", err)
+		}
+
+		// Make sure the change is noticed, regardless of the timestamp
+		// resolution of the file system
+		mtime = mtime.Add(time.Minute)
+		if err := os.Chtimes(def, mtime, mtime); err != nil {
+			t.Fatalf("Error changing the definition's times: %v\n", err)
+		}
+	}
+
+	graph := func(radius string) string {
+		return `{
+			"Name": "Load",
+			"Options": {"Path": "` + in + `"},
+			"Outputs": {
+				"Output": {
+					"Name": "BoxBlur",
+					"Options": {"Radius": ` + radius + `},
+					"Outputs": {"Output": {"Name": "Save", "Options": {"Path": "` + out + `"}}}
+				}
+			}
+		}`
+	}
+
+	write(graph("1"))
+
+	cache := &countingCache{Cache: drawgl.NewMemoryCache(64)}
+	done := make(chan error)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+
+	go func() {
+		watcher{
+			path:     def,
+			graph:    drawgl.Graph{Cache: cache},
+			interval: 10 * time.Millisecond,
+			out:      ioutil.Discard,
+			done:     func(err error) { done <- err },
+		}.run(ctx)
+		close(stopped)
+	}()
+
+	wait := func() error {
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Timed out waiting for the graph to be processed\n")
+		}
+		return nil
+	}
+
+	if err := wait(); err != nil {
+		t.Fatalf("Error processing the graph: %v\n", err)
+	}
+
+	if _, err := os.Stat(out); err != nil {
+		t.Fatalf("Expected output %s: %v\n", out, err)
+	}
+
+	write(graph("2"))
+	if err := wait(); err != nil {
+		t.Fatalf("Error processing the changed graph: %v\n", err)
+	}
+
+	if atomic.LoadInt32(&cache.hits) == 0 {
+		t.Fatalf("Expected the unchanged Load node to be cached\n")
+	}
+
+	write("{ invalid")
+	if err := wait(); err == nil {
+		t.Fatalf("Expected an error for the invalid definition\n")
+	}
+
+	// The inputs of the last valid definition are still watched
+	mtime = mtime.Add(time.Minute)
+	if err := os.Chtimes(in, mtime, mtime); err != nil {
+		t.Fatalf("Error changing the input's times: %v\n", err)
+	}
+
+	if err := wait(); err == nil {
+		t.Fatalf("Expected an error for the invalid definition\n")
+	}
+
+	write(graph("1"))
+	if err := wait(); err != nil {
+		t.Fatalf("Error processing the fixed graph: %v\n", err)
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Timed out waiting for the watcher to stop\n")
+	}
+}
+
+func TestWatchNestedInclude(t *testing.T) {
+	dir := t.TempDir()
+
+	in := filepath.Join(tests.TestDataDir(), "test.png")
+	def := filepath.Join(dir, "graph.json")
+	inner := filepath.Join(dir, "inner.json")
+
+	files := map[string]string{
+		def:   `{"Name": "Group", "Options": {"$include": "outer.json"}}`,
+		inner: `{"Id": "load", "Name": "Load", "Options": {"Path": "` + in + `"}}`,
+		filepath.Join(dir, "outer.json"): `{
+			"Graph": {"Id": "inner", "Name": "Group", "Options": {"$include": "inner.json", "Outputs": {"Output": "load"}}},
+			"Outputs": {"Output": "inner"}
+		}`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing %s: %v\n", name, err)
+		}
+	}
+
+	// The includes are relative to the files holding them
+	t.Chdir(t.TempDir())
+
+	o, err := group.IncludedFrom(def)
+	if err != nil {
+		t.Fatalf("Error creating the include override: %v\n", err)
+	}
+
+	w := watcher{
+		path:      def,
+		overrides: []drawgl.Override{o},
+		graph:     drawgl.Graph{Cache: drawgl.NewMemoryCache(64)},
+		interval:  10 * time.Millisecond,
+		out:       ioutil.Discard,
+	}
+
+	roots, err := w.read()
+	if err != nil {
+		t.Fatalf("Error reading the graph: %v\n", err)
+	}
+
+	expected := []string{filepath.Join(dir, "inner.json"), filepath.Join(dir, "outer.json"), in}
+	sort.Strings(expected)
+	if inputs := inputFiles(roots); !reflect.DeepEqual(inputs, expected) {
+		t.Fatalf("Expected inputs %v, got %v\n", expected, inputs)
+	}
+
+	done := make(chan error)
+	w.done = func(err error) { done <- err }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go w.run(ctx)
+
+	wait := func() error {
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Timed out waiting for the graph to be processed\n")
+		}
+		return nil
+	}
+
+	if err := wait(); err != nil {
+		t.Fatalf("Error processing the graph: %v\n", err)
+	}
+
+	// Changing the nested include processes the graph again
+	mtime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(inner, mtime, mtime); err != nil {
+		t.Fatalf("Error changing the include's times: %v\n", err)
+	}
+
+	if err := wait(); err != nil {
+		t.Fatalf("Error processing the graph again: %v\n", err)
+	}
+}
@@ -0,0 +1,223 @@
+package drawgl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/urandom/graph"
+)
+
+// Definer is implemented by nodes that can be written as part of a JSON graph
+// definition.
+type Definer interface {
+	// Definition returns the name of the node's registered linker, along
+	// with its options, which have to encode into the JSON form accepted by
+	// the linker factory.
+	Definition() (name string, opts interface{})
+}
+
+type definitionNode struct {
+	Id      string                              `json:",omitempty"`
+	Name    string                              `json:",omitempty"`
+	Options json.RawMessage                     `json:",omitempty"`
+	Outputs map[graph.ConnectorName]interface{} `json:",omitempty"`
+	Ref     string                              `json:",omitempty"`
+	To      graph.ConnectorName                 `json:",omitempty"`
+}
+
+// structure holds the nodes reachable from a set of roots, in walking order,
+// along with the connections between them.
+type structure struct {
+	nodes    []graph.Node
+	parents  map[graph.Id][]graph.Parent
+	children map[graph.Id][]edge
+	// labels holds the JSON ids of the nodes that have more than one parent
+	labels map[graph.Id]string
+}
+
+type edge struct {
+	graph.Parent
+	child graph.Node
+}
+
+// WriteDOT writes the graphs of the given roots in the Graphviz DOT language.
+// Each node is labelled with its name and the options that differ from their
+// zero values, and each edge with the connectors it joins.
+func WriteDOT(w io.Writer, roots ...graph.Linker) error {
+	s := walkStructure(roots)
+
+	var b bytes.Buffer
+	b.WriteString("digraph drawgl {\n")
+	b.WriteString("\tnode [shape=box];\n")
+
+	for _, n := range s.nodes {
+		fmt.Fprintf(&b, "\t%s [label=%s];\n", dotQuote(string(n.Id())), dotQuote(dotLabel(n)))
+	}
+
+	for _, n := range s.nodes {
+		for _, p := range s.parents[n.Id()] {
+			fmt.Fprintf(&b, "\t%s -> %s [label=%s];\n",
+				dotQuote(string(p.Node.Id())), dotQuote(string(n.Id())),
+				dotQuote(fmt.Sprintf("%s → %s", p.From, p.To)))
+		}
+	}
+
+	b.WriteString("}\n")
+
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// MarshalGraph encodes the graphs of the given roots in the JSON format read
+// by ProcessJSON. Every node has to implement Definer. A single root is
+// encoded as an object, while multiple ones as an array. A node with more
+// than one parent is nested within the first one, and labelled with an Id,
+// so that the others can reference it.
+func MarshalGraph(roots ...graph.Linker) ([]byte, error) {
+	s := walkStructure(roots)
+
+	var defs []*definitionNode
+	for _, root := range roots {
+		def, err := s.definition(root.Node())
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+
+	if len(defs) == 1 {
+		return json.MarshalIndent(defs[0], "", "\t")
+	}
+
+	return json.MarshalIndent(defs, "", "\t")
+}
+
+// walkStructure collects the nodes and edges of the union of the graphs of
+// the given roots, so that a node reachable from several roots keeps the
+// parents from all of them.
+func walkStructure(roots []graph.Linker) structure {
+	rg := newRootsGraph(roots)
+	s := structure{
+		parents:  rg.parents,
+		children: make(map[graph.Id][]edge),
+		labels:   make(map[graph.Id]string),
+	}
+
+	for _, l := range rg.linkers {
+		n := l.Node()
+		s.nodes = append(s.nodes, n)
+
+		for _, c := range l.Connectors() {
+			s.children[n.Id()] = append(s.children[n.Id()], edge{
+				Parent: graph.Parent{Node: n, From: c.Name, To: c.TargetName},
+				child:  c.Target.Node(),
+			})
+		}
+	}
+
+	return s
+}
+
+func (s structure) definition(n graph.Node) (*definitionNode, error) {
+	d, ok := n.(Definer)
+	if !ok {
+		return nil, fmt.Errorf("node %v (%s) does not provide a definition", n.Id(), NodeName(n))
+	}
+
+	name, opts := d.Definition()
+	b, err := json.Marshal(opts)
+	if err != nil {
+		return nil, fmt.Errorf("encoding the options of node %v (%s): %v", n.Id(), name, err)
+	}
+
+	def := &definitionNode{Name: name, Options: b}
+	if len(s.parents[n.Id()]) > 1 {
+		def.Id = s.label(n.Id())
+	}
+
+	outputs := make(map[graph.ConnectorName][]*definitionNode)
+	for _, e := range s.children[n.Id()] {
+		var child *definitionNode
+
+		if first := s.parents[e.child.Id()][0]; first.Node.Id() == n.Id() && first.From == e.From && first.To == e.To {
+			if child, err = s.definition(e.child); err != nil {
+				return nil, err
+			}
+		} else {
+			child = &definitionNode{Ref: s.label(e.child.Id())}
+		}
+
+		if e.To != graph.InputName {
+			child.To = e.To
+		}
+
+		outputs[e.From] = append(outputs[e.From], child)
+	}
+
+	for output, children := range outputs {
+		if def.Outputs == nil {
+			def.Outputs = make(map[graph.ConnectorName]interface{})
+		}
+
+		if len(children) == 1 {
+			def.Outputs[output] = children[0]
+		} else {
+			def.Outputs[output] = children
+		}
+	}
+
+	return def, nil
+}
+
+// label returns the JSON id of a node, which is independent of the node's
+// graph.Id, so that encoding a decoded graph produces the same document.
+func (s structure) label(id graph.Id) string {
+	l, ok := s.labels[id]
+	if !ok {
+		l = fmt.Sprintf("node%d", len(s.labels)+1)
+		s.labels[id] = l
+	}
+
+	return l
+}
+
+// dotLabel returns the name of a node, followed by a line for each of its
+// options that is not empty.
+func dotLabel(n graph.Node) string {
+	d, ok := n.(Definer)
+	if !ok {
+		return NodeName(n)
+	}
+
+	name, opts := d.Definition()
+	lines := []string{name}
+
+	var fields map[string]json.RawMessage
+	if b, err := json.Marshal(opts); err == nil && json.Unmarshal(b, &fields) == nil {
+		keys := make([]string, 0, len(fields))
+		for k, v := range fields {
+			switch string(v) {
+			case "null", "false", "0", `""`, "[]", "{}":
+				continue
+			}
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			lines = append(lines, fmt.Sprintf("%s: %s", k, fields[k]))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+	return `"` + r.Replace(s) + `"`
+}
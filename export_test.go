@@ -0,0 +1,199 @@
+package drawgl_test
+
+import (
+	"bytes"
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/operation/convolution"
+	"github.com/urandom/drawgl/operation/io"
+	"github.com/urandom/drawgl/operation/transform"
+	"github.com/urandom/graph"
+	"github.com/urandom/graph/base"
+)
+
+func TestMarshalGraph(t *testing.T) {
+	root := exportGraph(t)
+
+	b, err := drawgl.MarshalGraph(root)
+	if err != nil {
+		t.Fatalf("Error encoding graph: %v\n", err)
+	}
+
+	roots, err := drawgl.ProcessJSON(bytes.NewReader(b), nil)
+	if err != nil {
+		t.Fatalf("Error decoding graph %s: %v\n", b, err)
+	}
+
+	if len(roots) != 1 {
+		t.Fatalf("Expected 1 root, got %d\n", len(roots))
+	}
+
+	rt, err := drawgl.MarshalGraph(roots[0])
+	if err != nil {
+		t.Fatalf("Error encoding decoded graph: %v\n", err)
+	}
+
+	if !bytes.Equal(b, rt) {
+		t.Fatalf("Expected the round trip to produce\n%s\ngot\n%s\n", b, rt)
+	}
+
+	var out bytes.Buffer
+	save, err := io.NewSaveLinker(io.SaveOptions{Writer: &out})
+	if err != nil {
+		t.Fatalf("Error creating a save linker: %v\n", err)
+	}
+	roots[0].Link(save)
+
+	if _, err := drawgl.MarshalGraph(roots[0]); err == nil {
+		t.Fatalf("Expected an error for a save writer\n")
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	var b bytes.Buffer
+	if err := drawgl.WriteDOT(&b, exportGraph(t)); err != nil {
+		t.Fatalf("Error writing graph: %v\n", err)
+	}
+
+	dot := b.String()
+	for _, s := range []string{"digraph", "Kernel: [0,-1,0,-1,4,-1,0,-1,0]", `Transform\nChannel: \"RGBA\"\nOperator: \"rotate-90\"`, "Output → Input", "->"} {
+		if !strings.Contains(dot, s) {
+			t.Fatalf("Expected %q in\n%s\n", s, dot)
+		}
+	}
+}
+
+func TestMarshalGraphRoots(t *testing.T) {
+	roots := multiRootGraph(t)
+
+	b, err := drawgl.MarshalGraph(roots...)
+	if err != nil {
+		t.Fatalf("Error encoding graph: %v\n", err)
+	}
+
+	for _, s := range []string{`"Id": "node1"`, `"Ref": "node1"`, `"To": "Background"`, `"To": "Foreground"`} {
+		if !strings.Contains(string(b), s) {
+			t.Fatalf("Expected %s in\n%s\n", s, b)
+		}
+	}
+
+	decoded, err := drawgl.ProcessJSON(bytes.NewReader(b), nil)
+	if err != nil {
+		t.Fatalf("Error decoding graph %s: %v\n", b, err)
+	}
+
+	if len(decoded) != 2 {
+		t.Fatalf("Expected 2 roots, got %d\n", len(decoded))
+	}
+
+	for i, root := range decoded {
+		if len(root.Connectors()) != 1 {
+			t.Fatalf("Expected root %d to have 1 connector, got %d\n", i, len(root.Connectors()))
+		}
+	}
+
+	if decoded[0].Connectors()[0].Target.Node().Id() != decoded[1].Connectors()[0].Target.Node().Id() {
+		t.Fatalf("Expected both roots to feed the same node in\n%s\n", b)
+	}
+
+	rt, err := drawgl.MarshalGraph(decoded...)
+	if err != nil {
+		t.Fatalf("Error encoding decoded graph: %v\n", err)
+	}
+
+	if !bytes.Equal(b, rt) {
+		t.Fatalf("Expected the round trip to produce\n%s\ngot\n%s\n", b, rt)
+	}
+}
+
+func TestWriteDOTRoots(t *testing.T) {
+	roots := multiRootGraph(t)
+
+	var b bytes.Buffer
+	if err := drawgl.WriteDOT(&b, roots...); err != nil {
+		t.Fatalf("Error writing graph: %v\n", err)
+	}
+
+	dot := b.String()
+	for _, s := range []string{"Output → Background", "Output → Foreground", "Output → Input"} {
+		if !strings.Contains(dot, s) {
+			t.Fatalf("Expected %q in\n%s\n", s, dot)
+		}
+	}
+
+	if n := strings.Count(dot, "->"); n != 3 {
+		t.Fatalf("Expected 3 edges, got %d in\n%s\n", n, dot)
+	}
+}
+
+// multiRootGraph returns two loads feeding the background and foreground of
+// a single compositor.
+func multiRootGraph(t *testing.T) []graph.Linker {
+	bg, err := io.NewLoadLinker(io.LoadOptions{Path: "bg.png"})
+	if err != nil {
+		t.Fatalf("Error creating a load linker: %v\n", err)
+	}
+
+	fg, err := io.NewLoadLinker(io.LoadOptions{Path: "fg.png"})
+	if err != nil {
+		t.Fatalf("Error creating a load linker: %v\n", err)
+	}
+
+	comp := base.NewLinkerNode(compositeNode{Node: base.NewNode()})
+
+	save, err := io.NewSaveLinker(io.SaveOptions{Path: "out.png"})
+	if err != nil {
+		t.Fatalf("Error creating a save linker: %v\n", err)
+	}
+
+	bg.Link(comp, graph.OutputName, "Background")
+	fg.Link(comp, graph.OutputName, "Foreground")
+	comp.Link(save)
+
+	return []graph.Linker{bg, fg}
+}
+
+func exportGraph(t *testing.T) graph.Linker {
+	load, err := io.NewLoadLinker(io.LoadOptions{Path: "in.png"})
+	if err != nil {
+		t.Fatalf("Error creating a load linker: %v\n", err)
+	}
+
+	kernel, err := convolution.NewKernel([]float32{0, -1, 0, -1, 4, -1, 0, -1, 0})
+	if err != nil {
+		t.Fatalf("Error creating a kernel: %v\n", err)
+	}
+
+	conv, err := convolution.NewConvolutionLinker(convolution.ConvolutionOptions{
+		Kernel: kernel,
+		Mask:   drawgl.NewMask(nil, image.Rect(1, 1, 10, 10)),
+	})
+	if err != nil {
+		t.Fatalf("Error creating a convolution linker: %v\n", err)
+	}
+
+	scale, err := transform.NewScaleLinker(transform.ScaleOptions{Width: 10, HeightPercent: 0.5, Interpolator: "Lanczos"})
+	if err != nil {
+		t.Fatalf("Error creating a scale linker: %v\n", err)
+	}
+
+	tr, err := transform.NewTransformLinker(transform.TransformOptions{Operator: transform.Rotate90Operator})
+	if err != nil {
+		t.Fatalf("Error creating a transform linker: %v\n", err)
+	}
+
+	save, err := io.NewSaveLinker(io.SaveOptions{Path: "out.png"})
+	if err != nil {
+		t.Fatalf("Error creating a save linker: %v\n", err)
+	}
+
+	load.Link(conv)
+	conv.Link(scale)
+	scale.Link(tr)
+	tr.Link(save)
+
+	return load
+}
@@ -0,0 +1,614 @@
+package drawgl
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expression is a parsed expression over the metadata and the bounds of a
+// node's main input. Expressions are made of numbers, quoted strings, true
+// and false, the variables input.width, input.height, input.x and input.y,
+// holding the bounds of the input buffer, meta.<key> or meta['<key>']
+// variables, holding the values of its metadata, the + - * / % arithmetic
+// operators, the == != < <= > >= comparisons, the && || ! logical operators
+// and parentheses. A missing metadata value fails arithmetic, but may be
+// compared: it is only equal to another missing value, and is never ordered.
+type Expression struct {
+	src string
+	e   expression
+}
+
+type expression interface {
+	eval(env exprEnv) (interface{}, error)
+}
+
+// exprEnv holds the values that expressions are evaluated against.
+type exprEnv struct {
+	bounds image.Rectangle
+	meta   Meta
+}
+
+type exprNumber float64
+
+type exprString string
+
+type exprBool bool
+
+type exprVariable string
+
+type exprUnary struct {
+	op string
+	x  expression
+}
+
+type exprBinary struct {
+	op   string
+	x, y expression
+}
+
+type exprParser struct {
+	tokens []string
+	pos    int
+	vars   int
+}
+
+// missingMeta is returned when evaluating a metadata variable that is not
+// present.
+type missingMeta string
+
+var errNotExpression = errors.New("not an expression")
+
+// ParseExpression parses an expression.
+func ParseExpression(s string) (Expression, error) {
+	e, _, err := parse(s)
+	if err != nil {
+		return Expression{}, fmt.Errorf("parsing expression %q: %v", s, err)
+	}
+
+	return Expression{src: s, e: e}, nil
+}
+
+// Evaluate evaluates the expression against the metadata and the bounds of
+// the result's buffer. The returned value is either a float64, a string, a
+// bool, or a metadata value that is none of those.
+func (e Expression) Evaluate(r Result) (interface{}, error) {
+	if e.e == nil {
+		return nil, errors.New("empty expression")
+	}
+
+	v, err := e.e.eval(newExprEnv(r))
+	if err != nil {
+		return nil, fmt.Errorf("evaluating %q: %v", e.src, err)
+	}
+
+	return v, nil
+}
+
+func (e Expression) String() string {
+	return e.src
+}
+
+// ExpressionPrefix marks the option values that are expressions, as in
+// "=input.width / 2". Other values are never evaluated.
+const ExpressionPrefix = "="
+
+// parseExpression parses an option value as an expression. Values without
+// the ExpressionPrefix are not expressions, and errNotExpression is returned
+// for them.
+func parseExpression(s string) (expression, error) {
+	if !strings.HasPrefix(s, ExpressionPrefix) {
+		return nil, errNotExpression
+	}
+
+	e, _, err := parse(strings.TrimPrefix(s, ExpressionPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("parsing expression %q: %v", s, err)
+	}
+
+	return e, nil
+}
+
+// parse parses an expression, returning the number of variables it
+// references.
+func parse(s string) (expression, int, error) {
+	tokens, err := tokenizeExpression(s)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, 0, errors.New("empty expression")
+	}
+
+	p := &exprParser{tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if p.pos != len(p.tokens) {
+		return nil, 0, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+
+	return e, p.vars, nil
+}
+
+func newExprEnv(r Result) exprEnv {
+	env := exprEnv{meta: r.Meta}
+	if r.Buffer != nil {
+		env.bounds = r.Buffer.Bounds()
+	} else if r.tiles != nil {
+		env.bounds = r.tiles.bounds
+	}
+
+	return env
+}
+
+func tokenizeExpression(s string) ([]string, error) {
+	var tokens []string
+
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case i+1 < len(s) && isOperator(s[i:i+2]):
+			tokens = append(tokens, s[i:i+2])
+			i += 2
+		case strings.ContainsRune("+-*/%()[]<>!", c):
+			tokens = append(tokens, string(c))
+			i++
+		case c == '\'' || c == '"':
+			j := strings.IndexByte(s[i+1:], s[i])
+			if j == -1 {
+				return nil, errors.New("unterminated string")
+			}
+			tokens = append(tokens, s[i:i+j+2])
+			i += j + 2
+		case c == '.' || unicode.IsDigit(c):
+			j := i
+			for j < len(s) && (s[j] == '.' || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		case c == '_' || unicode.IsLetter(c):
+			j := i
+			for j < len(s) && (s[j] == '_' || s[j] == '.' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+
+	return tokens, nil
+}
+
+func isOperator(s string) bool {
+	switch s {
+	case "==", "!=", "<=", ">=", "&&", "||":
+		return true
+	}
+
+	return false
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+
+	return ""
+}
+
+func (p *exprParser) parseOr() (expression, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "||" {
+		p.pos++
+
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = exprBinary{op: "||", x: x, y: y}
+	}
+
+	return x, nil
+}
+
+func (p *exprParser) parseAnd() (expression, error) {
+	x, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "&&" {
+		p.pos++
+
+		y, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		x = exprBinary{op: "&&", x: x, y: y}
+	}
+
+	return x, nil
+}
+
+func (p *exprParser) parseComparison() (expression, error) {
+	x, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	switch op := p.peek(); op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.pos++
+
+		y, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		x = exprBinary{op: op, x: x, y: y}
+	}
+
+	return x, nil
+}
+
+func (p *exprParser) parseSum() (expression, error) {
+	x, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+
+	for op := p.peek(); op == "+" || op == "-"; op = p.peek() {
+		p.pos++
+
+		y, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		x = exprBinary{op: op, x: x, y: y}
+	}
+
+	return x, nil
+}
+
+func (p *exprParser) parseProduct() (expression, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for op := p.peek(); op == "*" || op == "/" || op == "%"; op = p.peek() {
+		p.pos++
+
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		x = exprBinary{op: op, x: x, y: y}
+	}
+
+	return x, nil
+}
+
+func (p *exprParser) parseUnary() (expression, error) {
+	if op := p.peek(); op == "-" || op == "+" || op == "!" {
+		p.pos++
+
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return exprUnary{op: op, x: x}, nil
+	}
+
+	return p.parseOperand()
+}
+
+func (p *exprParser) parseOperand() (expression, error) {
+	t := p.peek()
+	p.pos++
+
+	switch {
+	case t == "":
+		return nil, errors.New("unexpected end of expression")
+	case t == "(":
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.peek() != ")" {
+			return nil, errors.New("missing closing parenthesis")
+		}
+		p.pos++
+
+		return x, nil
+	case t[0] == '.' || unicode.IsDigit(rune(t[0])):
+		f, err := strconv.ParseFloat(t, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		return exprNumber(f), nil
+	case t[0] == '\'' || t[0] == '"':
+		return exprString(t[1 : len(t)-1]), nil
+	case t == "true" || t == "false":
+		return exprBool(t == "true"), nil
+	case t == "meta" && p.peek() == "[":
+		p.pos++
+
+		key := p.peek()
+		if key == "" || key[0] != '\'' && key[0] != '"' || p.pos+1 >= len(p.tokens) || p.tokens[p.pos+1] != "]" {
+			return nil, errors.New("expected a quoted metadata key")
+		}
+		p.pos += 2
+		p.vars++
+
+		return exprVariable("meta." + key[1:len(key)-1]), nil
+	case strings.HasPrefix(t, "meta.") && len(t) > len("meta."):
+		p.vars++
+		return exprVariable(t), nil
+	}
+
+	switch t {
+	case "input.width", "input.height", "input.x", "input.y":
+		p.vars++
+		return exprVariable(t), nil
+	}
+
+	return nil, fmt.Errorf("unknown identifier %q", t)
+}
+
+func (e exprNumber) eval(env exprEnv) (interface{}, error) {
+	return float64(e), nil
+}
+
+func (e exprString) eval(env exprEnv) (interface{}, error) {
+	return string(e), nil
+}
+
+func (e exprBool) eval(env exprEnv) (interface{}, error) {
+	return bool(e), nil
+}
+
+func (e exprVariable) eval(env exprEnv) (interface{}, error) {
+	switch e {
+	case "input.width":
+		return float64(env.bounds.Dx()), nil
+	case "input.height":
+		return float64(env.bounds.Dy()), nil
+	case "input.x":
+		return float64(env.bounds.Min.X), nil
+	case "input.y":
+		return float64(env.bounds.Min.Y), nil
+	}
+
+	key := strings.TrimPrefix(string(e), "meta.")
+	v, ok := env.meta[key]
+	if !ok {
+		return nil, missingMeta(key)
+	}
+
+	if f, ok := exprFloat(v); ok {
+		return f, nil
+	}
+
+	return v, nil
+}
+
+func (e exprUnary) eval(env exprEnv) (interface{}, error) {
+	v, err := e.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.op == "!" {
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a boolean", v)
+		}
+
+		return !b, nil
+	}
+
+	f, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%v is not a number", v)
+	}
+
+	if e.op == "-" {
+		f = -f
+	}
+
+	return f, nil
+}
+
+func (e exprBinary) eval(env exprEnv) (interface{}, error) {
+	switch e.op {
+	case "&&", "||":
+		return e.logical(env)
+	case "==", "!=", "<", "<=", ">", ">=":
+		return e.compare(env)
+	}
+
+	var operands [2]float64
+	for i, x := range []expression{e.x, e.y} {
+		v, err := x.eval(env)
+		if err != nil {
+			return nil, err
+		}
+
+		f, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a number", v)
+		}
+		operands[i] = f
+	}
+
+	x, y := operands[0], operands[1]
+	switch e.op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		if y == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return x / y, nil
+	default:
+		if y == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return math.Mod(x, y), nil
+	}
+}
+
+func (e exprBinary) logical(env exprEnv) (interface{}, error) {
+	x, err := evalBool(e.x, env)
+	if err != nil {
+		return nil, err
+	}
+
+	// The second operand is only evaluated when it decides the result
+	if x == (e.op == "||") {
+		return x, nil
+	}
+
+	return evalBool(e.y, env)
+}
+
+func (e exprBinary) compare(env exprEnv) (interface{}, error) {
+	var operands [2]interface{}
+	for i, x := range []expression{e.x, e.y} {
+		v, err := x.eval(env)
+		if _, ok := err.(missingMeta); ok {
+			v, err = nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		operands[i] = v
+	}
+
+	x, y := operands[0], operands[1]
+	if x == nil || y == nil {
+		switch e.op {
+		case "==":
+			return x == y, nil
+		case "!=":
+			return x != y, nil
+		default:
+			return false, nil
+		}
+	}
+
+	var c int
+	switch a := x.(type) {
+	case float64:
+		b, ok := y.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %v with %v", x, y)
+		}
+		c = compareOrdered(a < b, a > b)
+	case string:
+		b, ok := y.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %q with %v", a, y)
+		}
+		c = strings.Compare(a, b)
+	case bool:
+		b, ok := y.(bool)
+		if !ok || e.op != "==" && e.op != "!=" {
+			return nil, fmt.Errorf("cannot compare %v with %v using %s", x, y, e.op)
+		}
+		c = compareOrdered(false, a != b)
+	default:
+		return nil, fmt.Errorf("cannot compare %v with %v", x, y)
+	}
+
+	switch e.op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func evalBool(e expression, env exprEnv) (bool, error) {
+	v, err := e.eval(env)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%v is not a boolean", v)
+	}
+
+	return b, nil
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+
+	return 0
+}
+
+func (e missingMeta) Error() string {
+	return fmt.Sprintf("no metadata for %q", string(e))
+}
+
+func exprFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	}
+
+	return 0, false
+}
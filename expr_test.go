@@ -0,0 +1,81 @@
+package drawgl_test
+
+import (
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/urandom/drawgl"
+)
+
+func TestExpression(t *testing.T) {
+	r := drawgl.Result{
+		Buffer: drawgl.NewFloatImage(image.Rect(2, 4, 12, 24)),
+		Meta:   drawgl.Meta{"orientation": 6, "input-format": "gif"},
+	}
+
+	cases := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{"input.width / 2", 5.0},
+		{"-input.x + input.y * (input.height % 7)", 22.0},
+		{"meta.orientation", 6.0},
+		{"meta['input-format'] == 'gif'", true},
+		{`meta["input-format"] != "gif" || input.width >= 10`, true},
+		{"!(meta.orientation > 1) && meta.missing", false},
+		{"meta.missing == 1", false},
+		{"meta.missing != 1", true},
+		{"meta.missing < 1", false},
+		{"'abc' < 'abd'", true},
+		{"true == (1 < 2)", true},
+	}
+
+	for _, c := range cases {
+		e, err := drawgl.ParseExpression(c.expr)
+		if err != nil {
+			t.Fatalf("Error parsing %q: %v\n", c.expr, err)
+		}
+
+		v, err := e.Evaluate(r)
+		if err != nil {
+			t.Fatalf("Error evaluating %q: %v\n", c.expr, err)
+		}
+
+		if v != c.expected {
+			t.Fatalf("Expected %q to evaluate to %v, got %v\n", c.expr, c.expected, v)
+		}
+	}
+
+	for _, s := range []string{"", "input.width /", "(1", "unknown > 1", "meta[orientation]", "'open"} {
+		if _, err := drawgl.ParseExpression(s); err == nil {
+			t.Fatalf("Expected an error parsing %q\n", s)
+		}
+	}
+
+	errs := map[string]string{
+		"meta.missing + 1":  "no metadata",
+		"input.width / 0":   "division by zero",
+		"'a' < 1":           "cannot compare",
+		"input.width && 1":  "not a boolean",
+		"meta.orientation:": "",
+	}
+
+	for s, msg := range errs {
+		e, err := drawgl.ParseExpression(s)
+		if msg == "" {
+			if err == nil {
+				t.Fatalf("Expected an error parsing %q\n", s)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Error parsing %q: %v\n", s, err)
+		}
+
+		if _, err := e.Evaluate(r); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Fatalf("Expected an error mentioning %q evaluating %q, got %v\n", msg, s, err)
+		}
+	}
+}
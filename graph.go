@@ -1,12 +1,48 @@
 package drawgl
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"sync"
+	"time"
 
 	"github.com/urandom/graph"
 )
 
 type Graph struct {
+	// Observer, if not nil, receives the lifecycle and progress events of
+	// every processed node
+	Observer Observer
+	// ContinueOnError keeps processing the nodes that do not depend on a
+	// failed node, instead of stopping at the first error
+	ContinueOnError bool
+	// Cache, if not nil, is used to store the results of nodes implementing
+	// the Hasher interface, and to reuse them when neither the nodes nor their
+	// ancestors have changed
+	Cache Cache
+	// TileSize, if positive, enables tiled processing. Chains of nodes
+	// implementing the TileProcessor interface produce their output in tiles
+	// of the given size only when a node that requires a whole buffer is
+	// reached, without allocating buffers for the intermediate nodes. Only
+	// the nodes with several children keep their whole output, so that it
+	// is not computed again for each of them.
+	TileSize int
+	// RegionOfInterest defers the processing of chains of TileProcessor
+	// nodes, as in tiled processing, so that only the regions that are
+	// required by the following nodes are computed. It is implied by a
+	// positive TileSize.
+	RegionOfInterest bool
+	// MaxConcurrentNodes, if positive, limits the number of nodes that are
+	// processed at the same time. Nodes that are ready to be processed wait
+	// for running ones to finish.
+	MaxConcurrentNodes int
+	// MemoryBudget, if positive, is a soft limit, in bytes, on the memory
+	// used by the running nodes, as estimated from the sizes of their input
+	// buffers. A node that does not fit waits for running ones to finish,
+	// unless nothing else is running.
+	MemoryBudget int64
+	// Report, if not nil, receives the statistics of every processed node
+	Report *Report
 }
 
 type Result struct {
@@ -15,56 +51,609 @@ type Result struct {
 	NamedBuffers map[graph.ConnectorName]*FloatImage
 	Meta         Meta
 	Error        error
+	// Inactive lists the outputs that a branching node did not take. The
+	// nodes connected to them are skipped, along with their descendants.
+	Inactive []graph.ConnectorName
+
+	tiles *tileSource
 }
 
 type Processor interface {
-	Process(wd graph.WalkData, buffers map[graph.ConnectorName]Result, output chan<- Result)
+	// Process processes the buffers received from the node's parents, and
+	// sends exactly one Result to the output channel. Implementations should
+	// stop working as soon as possible once the context is done.
+	//
+	// The received buffers may be shared with other nodes, and must not be
+	// modified. The result's buffer may be one of the received ones, as long
+	// as it is not modified either.
+	Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]Result, output chan<- Result)
+}
+
+// InPlaceProcessor is implemented by processors that write their output into
+// the buffer of their main input, instead of allocating a new one. If
+// InPlace returns true, the buffer of the main input is not shared with any
+// other node, as it is copied whenever other nodes still need the original.
+type InPlaceProcessor interface {
+	Processor
+	InPlace() bool
 }
 
 type Meta map[string]interface{}
 
+type graphKey struct{}
+
+// GraphFromContext returns the Graph processing the node that received the
+// context, so that nodes processing inner graphs, such as groups, can use
+// the same configuration. The inner graphs have their own limits on
+// concurrent nodes and memory.
+func GraphFromContext(ctx context.Context) (Graph, bool) {
+	g, ok := ctx.Value(graphKey{}).(Graph)
+	return g, ok
+}
+
+// Process walks the graph, starting from the given linker, and processes each
+// node that implements the Processor interface.
 func (g Graph) Process(start graph.Linker) error {
-	walker := graph.NewWalker(start)
-	data := walker.Walk()
+	return g.ProcessContext(context.Background(), start)
+}
+
+// ProcessContext is like Process, but stops scheduling new nodes once the
+// context is done. The nodes that are already running are waited upon before
+// the context's error is returned.
+func (g Graph) ProcessContext(ctx context.Context, start graph.Linker) error {
+	return g.ProcessRoots(ctx, start)[0]
+}
+
+// ProcessRoots processes the graphs starting from each of the given roots
+// concurrently. The returned slice holds the error for each corresponding
+// root, or nil if all of its nodes were processed successfully. An error in
+// one root does not stop the processing of the others. The roots are walked
+// as a single graph, so a node that is reachable from more than one root,
+// such as one combining the images of two roots, is processed once, and its
+// error is reported for each of those roots.
+//
+// The error of a root is a *NodeError, or, if the graph continues on error
+// and more than one node has failed, an Errors value holding a *NodeError for
+// each failed node. If the context ends before a root is fully processed,
+// and none of its nodes have failed, the context's error is returned.
+func (g Graph) ProcessRoots(ctx context.Context, roots ...graph.Linker) []error {
+	ctx = context.WithValue(ctx, graphKey{}, g)
+
+	rg := newRootsGraph(roots)
+	data := rg.walk()
 
 	output := make(chan Result)
 	resultSet := make(map[graph.Id]Result)
+	nodeRoots := make(map[graph.Id][]int)
+	running := make(map[graph.Id]*nodeState)
+	failed := make(map[graph.Id]bool)
+	keys := make(map[graph.Id]string)
+	cached := make(map[graph.Id]bool)
+	aliases := make(map[graph.Id]graph.Id)
+	skipped := make(map[graph.Id]bool)
+
+	failures := make([][]error, len(roots))
+	cancelled := make([]bool, len(roots))
+	pending := 0
 
-	for {
+	sched := newScheduler(g.MaxConcurrentNodes, g.MemoryBudget)
+	refs := newBufferRefs(rg)
+
+	var puts sync.WaitGroup
+	defer puts.Wait()
+
+	for data != nil || pending > 0 {
 		select {
-		case wd, open := <-data:
-			if open {
-				if p, ok := wd.Node.(Processor); ok {
-					pb := make(map[graph.ConnectorName]Result)
-
-					for _, p := range wd.Parents {
-						r := resultSet[p.Node.Id()]
-						if p.From != graph.OutputName {
-							// If the image buffer comes from a secondary output, clone it
-							if nb, ok := r.NamedBuffers[p.From]; ok && nb != nil {
-								r.Buffer = CopyImage(nb)
-							} else if r.Buffer != nil {
-								r.Buffer = CopyImage(r.Buffer)
-							}
-						}
-						r.Meta = copyMeta(r.Meta)
-						pb[p.To] = r
+		case rwd, open := <-data:
+			if !open {
+				data = nil
+				continue
+			}
+
+			wd := rwd.WalkData
+			if ctx.Err() != nil {
+				for _, root := range rwd.roots {
+					cancelled[root] = true
+				}
+			}
+
+			if g.stopped(rwd.roots, cancelled, failures) {
+				// Let the walker reach the end of the graph, without
+				// processing the remaining nodes
+				wd.Close()
+				continue
+			}
+
+			if hasFailedParent(wd, failed) {
+				// The node is missing some of its input, skip it as well as
+				// any of its descendants
+				failed[wd.Node.Id()] = true
+				wd.Close()
+				continue
+			}
+
+			if hasInactiveParent(wd, skipped, resultSet) {
+				// The node is on a branch that was not taken, release its
+				// inputs as if it was processed
+				skipped[wd.Node.Id()] = true
+
+				_, released := refs.take(wd, parentBuffers(wd, resultSet), false)
+				for _, id := range released {
+					delete(resultSet, id)
+				}
+				refs.release(wd.Node.Id())
+
+				g.skipNode(wd.Node)
+				wd.Close()
+				continue
+			}
+
+			if p, ok := wd.Node.(Processor); ok {
+				state := newNodeState(wd.Node)
+
+				pending++
+				nodeRoots[wd.Node.Id()] = rwd.roots
+				running[wd.Node.Id()] = state
+
+				pb := parentBuffers(wd, resultSet)
+
+				var resolveErr error
+				if res, ok := p.(resolver); ok {
+					// Nodes whose options depend on their input are only
+					// constructed once the input is available
+					var id graph.Id
+					if p, id, resolveErr = res.resolve(pb); resolveErr == nil {
+						aliases[id] = wd.Node.Id()
 					}
+				}
+
+				ip, ok := p.(InPlaceProcessor)
+				copyInput, released := refs.take(wd, pb, ok && ip.InPlace())
+				for _, id := range released {
+					delete(resultSet, id)
+				}
+
+				if resolveErr != nil {
+					g.startNode(state)
 
-					go p.Process(wd, pb, output)
-				} else {
-					wd.Close()
+					go sendResult(Result{Id: wd.Node.Id(), Error: resolveErr}, wd, output)
+					continue
 				}
+
+				if g.Cache != nil {
+					key := cacheKey(wd, keys)
+					keys[wd.Node.Id()] = key
+
+					if r, ok := g.cachedResult(key); ok {
+						r.Id = wd.Node.Id()
+						cached[r.Id] = true
+						state.cached = true
+
+						g.startNode(state)
+
+						go sendResult(r, wd, output)
+						continue
+					}
+				}
+
+				if r, ok := g.tileResult(wd, p, pb, refs.children(wd.Node.Id()) > 1); ok {
+					refs.pin(pb[graph.InputName].Buffer)
+					g.startNode(state)
+
+					go sendResult(r, wd, output)
+					continue
+				}
+
+				state.track(pb, copyInput)
+				sched.add(wd.Node.Id(), estimateSize(pb), func() {
+					g.startNode(state)
+
+					if ctx.Err() != nil {
+						// The node was waiting for a while, there is no need
+						// to start it anymore
+						go sendResult(Result{Id: wd.Node.Id(), Error: ctx.Err()}, wd, output)
+						return
+					}
+
+					go g.process(withProgress(ctx, state.progress), p, wd, pb, copyInput, output)
+				})
 			} else {
-				return nil
+				wd.Close()
 			}
 		case r := <-output:
+			if id, ok := aliases[r.Id]; ok {
+				delete(aliases, r.Id)
+				r.Id = id
+			}
+
+			pending--
+			state := running[r.Id]
+			g.finishNode(state, r)
+			delete(running, r.Id)
+
 			if r.Error != nil {
-				return fmt.Errorf("Error processing node %v: %v\n", r.Id, r.Error)
+				failed[r.Id] = true
+				interrupted := ctx.Err() != nil && errors.Is(r.Error, ctx.Err())
+				nodeErr := &NodeError{Id: r.Id, Name: state.name, Err: r.Error}
+
+				for _, root := range nodeRoots[r.Id] {
+					if interrupted {
+						// The node was interrupted, rather than failed
+						cancelled[root] = true
+					} else if g.ContinueOnError || len(failures[root]) == 0 {
+						failures[root] = append(failures[root], nodeErr)
+					}
+				}
+			}
+			delete(nodeRoots, r.Id)
+			if key := keys[r.Id]; key != "" && r.Error == nil && r.tiles == nil && !cached[r.Id] {
+				// The result is stored in the background, its buffers
+				// must not be handed over to nodes writing in place
+				refs.pin(r.Buffer)
+				for _, buf := range r.NamedBuffers {
+					refs.pin(buf)
+				}
+
+				puts.Add(1)
+				go func(key string, r Result) {
+					defer puts.Done()
+					g.Cache.Put(key, r)
+				}(key, r)
 			}
+
 			resultSet[r.Id] = r
+			refs.produced(r)
+			refs.release(r.Id)
+			sched.done(r.Id)
+		}
+	}
+
+	// The failures of the nodes take precedence over a cancellation that
+	// may have come afterwards
+	errs := make([]error, len(roots))
+	for i := range errs {
+		switch {
+		case len(failures[i]) == 1:
+			errs[i] = failures[i][0]
+		case len(failures[i]) > 1:
+			errs[i] = Errors(failures[i])
+		case cancelled[i]:
+			errs[i] = ctx.Err()
+		}
+	}
+
+	return errs
+}
+
+// parentBuffers collects the results of a node's parents, keyed by the
+// node's input connectors. The buffers are shared with the parents.
+func parentBuffers(wd graph.WalkData, resultSet map[graph.Id]Result) map[graph.ConnectorName]Result {
+	pb := make(map[graph.ConnectorName]Result)
+
+	for _, p := range wd.Parents {
+		r := resultSet[p.Node.Id()]
+		r.Buffer = outputBuffer(r, p.From)
+		r.Meta = copyMeta(r.Meta)
+		pb[p.To] = r
+	}
+
+	return pb
+}
+
+// process materializes any tiled input buffers, and copies the main input
+// buffer if requested, before passing them to the processor.
+func (g Graph) process(ctx context.Context, p Processor, wd graph.WalkData, buffers map[graph.ConnectorName]Result, copyInput bool, output chan<- Result) {
+	for name, r := range buffers {
+		if r.tiles == nil {
+			if copyInput && name == graph.InputName && r.Buffer != nil {
+				r.Buffer = CopyImage(r.Buffer)
+				buffers[name] = r
+			}
+			continue
+		}
+
+		buf, err := r.tiles.materialize(ctx, g.TileSize)
+		if err != nil {
+			sendResult(Result{Id: wd.Node.Id(), Error: err}, wd, output)
+			return
+		}
+
+		if copyInput && name == graph.InputName {
+			buf = CopyImage(buf)
 		}
+
+		r.Buffer, r.tiles = buf, nil
+		buffers[name] = r
+	}
+
+	p.Process(ctx, wd, buffers, output)
+}
+
+// tileResult returns a lazy result for tile processors when processing in
+// tiles, which will only be computed once it is required by another node. The
+// output of a node with several children is computed once for all of them.
+func (g Graph) tileResult(wd graph.WalkData, p Processor, buffers map[graph.ConnectorName]Result, shared bool) (Result, bool) {
+	if g.TileSize <= 0 && !g.RegionOfInterest || len(wd.Parents) != 1 {
+		return Result{}, false
 	}
+
+	tp, ok := p.(TileProcessor)
+	if !ok {
+		return Result{}, false
+	}
+
+	in, ok := buffers[graph.InputName]
+	if !ok {
+		return Result{}, false
+	}
+
+	var input *tileSource
+	if in.tiles != nil {
+		input = in.tiles
+	} else if in.Buffer != nil {
+		input = bufferTileSource(in.Buffer)
+	} else {
+		return Result{}, false
+	}
+
+	tiles := newTileSource(tp, input)
+	if shared {
+		tiles = sharedTileSource(tp, input, g.TileSize)
+	}
+
+	return Result{Id: wd.Node.Id(), Meta: in.Meta, tiles: tiles}, true
+}
+
+func sendResult(r Result, wd graph.WalkData, output chan<- Result) {
+	output <- r
+	wd.Close()
+}
+
+func (g Graph) cachedResult(key string) (Result, bool) {
+	if key == "" {
+		return Result{}, false
+	}
+
+	return g.Cache.Get(key)
+}
+
+func hasFailedParent(wd graph.WalkData, failed map[graph.Id]bool) bool {
+	for _, p := range wd.Parents {
+		if failed[p.Node.Id()] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasInactiveParent reports whether any of the node's inputs comes from a
+// skipped node, or from an output that its node did not take.
+func hasInactiveParent(wd graph.WalkData, skipped map[graph.Id]bool, resultSet map[graph.Id]Result) bool {
+	for _, p := range wd.Parents {
+		if skipped[p.Node.Id()] {
+			return true
+		}
+
+		for _, c := range resultSet[p.Node.Id()].Inactive {
+			if c == p.From {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+type nodeState struct {
+	id       graph.Id
+	name     string
+	start    time.Time
+	progress *progress
+
+	// inputs, and any buffers allocated by the graph on behalf of the node,
+	// for the node's statistics
+	inputs  []*FloatImage
+	buffers int
+	bytes   int64
+	cached  bool
+}
+
+func newNodeState(n graph.Node) *nodeState {
+	return &nodeState{
+		id:       n.Id(),
+		name:     NodeName(n),
+		progress: &progress{},
+	}
+}
+
+// track records the input buffers of a node, along with the ones that the
+// graph is going to allocate for it.
+func (state *nodeState) track(buffers map[graph.ConnectorName]Result, copyInput bool) {
+	for name, r := range buffers {
+		switch {
+		case r.tiles != nil:
+			state.buffers++
+			state.bytes += imageSize(r.tiles.bounds)
+		case r.Buffer != nil:
+			state.inputs = append(state.inputs, r.Buffer)
+			if copyInput && name == graph.InputName {
+				state.buffers++
+				state.bytes += imageSize(r.Buffer.Rect)
+			}
+		}
+	}
+}
+
+// startNode marks the node as started, notifying the observer.
+func (g Graph) startNode(state *nodeState) {
+	state.start = time.Now()
+
+	if g.Observer != nil {
+		state.progress.notify = func(f float64) {
+			g.Observer(Event{
+				Kind:     NodeProgress,
+				Id:       state.id,
+				Name:     state.name,
+				Duration: time.Since(state.start),
+				Progress: f,
+			})
+		}
+
+		g.Observer(Event{Kind: NodeStarted, Id: state.id, Name: state.name})
+	}
+}
+
+func (g Graph) skipNode(n graph.Node) {
+	if g.Report != nil {
+		g.Report.add(NodeStats{Id: n.Id(), Name: NodeName(n), Skipped: true})
+	}
+
+	if g.Observer != nil {
+		g.Observer(Event{Kind: NodeSkipped, Id: n.Id(), Name: NodeName(n)})
+	}
+}
+
+func (g Graph) finishNode(state *nodeState, r Result) {
+	if state == nil {
+		return
+	}
+
+	if g.Report != nil {
+		g.Report.add(nodeStats(state, r))
+	}
+
+	if g.Observer == nil {
+		return
+	}
+
+	e := Event{
+		Kind:     NodeFinished,
+		Id:       state.id,
+		Name:     state.name,
+		Duration: time.Since(state.start),
+		Progress: state.progress.fraction(),
+		Error:    r.Error,
+	}
+
+	if r.Buffer != nil {
+		e.Bounds = r.Buffer.Bounds()
+	} else if r.tiles != nil {
+		e.Bounds = r.tiles.bounds
+	}
+
+	if r.Error != nil {
+		e.Kind = NodeFailed
+	} else {
+		e.Progress = 1
+	}
+
+	g.Observer(e)
+}
+
+// stopped reports whether all the roots a node is reachable from have been
+// cancelled, or have failed without the graph continuing on error.
+func (g Graph) stopped(roots []int, cancelled []bool, failures [][]error) bool {
+	for _, root := range roots {
+		if !cancelled[root] && (g.ContinueOnError || len(failures[root]) == 0) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type rootWalkData struct {
+	graph.WalkData
+	// roots holds the indices of the roots the node is reachable from
+	roots []int
+}
+
+// rootsGraph is the union of the graphs of several roots.
+type rootsGraph struct {
+	linkers []graph.Linker
+	parents map[graph.Id][]graph.Parent
+	roots   map[graph.Id][]int
+}
+
+func newRootsGraph(roots []graph.Linker) *rootsGraph {
+	rg := &rootsGraph{
+		parents: make(map[graph.Id][]graph.Parent),
+		roots:   make(map[graph.Id][]int),
+	}
+
+	linked := make(map[graph.Id]bool)
+	for i, root := range roots {
+		visited := make(map[graph.Id]bool)
+
+		var visit func(l graph.Linker)
+		visit = func(l graph.Linker) {
+			id := l.Node().Id()
+			if visited[id] {
+				return
+			}
+			visited[id] = true
+			rg.roots[id] = append(rg.roots[id], i)
+
+			first := !linked[id]
+			if first {
+				linked[id] = true
+				rg.linkers = append(rg.linkers, l)
+			}
+
+			for _, c := range l.Connectors() {
+				if first {
+					target := c.Target.Node().Id()
+					rg.parents[target] = append(rg.parents[target],
+						graph.Parent{Node: l.Node(), From: c.Name, To: c.TargetName})
+				}
+
+				visit(c.Target)
+			}
+		}
+
+		visit(root)
+	}
+
+	return rg
+}
+
+// walk sends the walk data of every node once all of its parents are done,
+// closing the channel once every node is done.
+func (rg *rootsGraph) walk() <-chan rootWalkData {
+	data := make(chan rootWalkData)
+
+	done := make(map[graph.Id]chan struct{}, len(rg.linkers))
+	for _, l := range rg.linkers {
+		done[l.Node().Id()] = make(chan struct{})
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(rg.linkers))
+
+	for _, l := range rg.linkers {
+		go func(l graph.Linker) {
+			defer wg.Done()
+
+			id := l.Node().Id()
+			for _, p := range rg.parents[id] {
+				<-done[p.Node.Id()]
+			}
+
+			wd := graph.NewWalkData(l.Node(), l.Connectors(), done[id])
+			wd.Parents = rg.parents[id]
+
+			data <- rootWalkData{WalkData: wd, roots: rg.roots[id]}
+			<-done[id]
+		}(l)
+	}
+
+	go func() {
+		wg.Wait()
+		close(data)
+	}()
+
+	return data
 }
 
 func copyMeta(meta Meta) (cp Meta) {
@@ -0,0 +1,387 @@
+package drawgl_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/operation/convolution"
+	"github.com/urandom/drawgl/operation/io"
+	"github.com/urandom/drawgl/operation/tests"
+	"github.com/urandom/graph"
+	"github.com/urandom/graph/base"
+)
+
+func TestGraphProcess(t *testing.T) {
+	var out bytes.Buffer
+	load := testGraph(t, &out)
+
+	g := drawgl.Graph{}
+	if err := g.Process(load); err != nil {
+		t.Fatalf("Error processing graph: %v\n", err)
+	}
+
+	if out.Len() == 0 {
+		t.Fatalf("Expected the image to be saved\n")
+	}
+}
+
+func TestGraphProcessContextCancelled(t *testing.T) {
+	var out bytes.Buffer
+	load := testGraph(t, &out)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	g := drawgl.Graph{}
+	if err := g.ProcessContext(ctx, load); err != context.Canceled {
+		t.Fatalf("Expected %v, got %v\n", context.Canceled, err)
+	}
+
+	if out.Len() != 0 {
+		t.Fatalf("Expected the image not to be saved\n")
+	}
+}
+
+func TestGraphProcessRoots(t *testing.T) {
+	var out1, out2 bytes.Buffer
+	load1 := testGraph(t, &out1)
+	load2 := testGraph(t, &out2)
+
+	missing, err := io.NewLoadLinker(io.LoadOptions{Path: tests.TestDataDir() + "/missing.png"})
+	if err != nil {
+		t.Fatalf("Error creating a load linker: %v\n", err)
+	}
+
+	g := drawgl.Graph{}
+	errs := g.ProcessRoots(context.Background(), load1, missing, load2)
+
+	if len(errs) != 3 {
+		t.Fatalf("Expected 3 errors, got %d\n", len(errs))
+	}
+
+	if errs[0] != nil || errs[2] != nil {
+		t.Fatalf("Unexpected errors: %v\n", errs)
+	}
+
+	if errs[1] == nil {
+		t.Fatalf("Expected an error for the missing input\n")
+	}
+
+	if out1.Len() == 0 || out2.Len() == 0 {
+		t.Fatalf("Expected both images to be saved\n")
+	}
+}
+
+func TestGraphObserver(t *testing.T) {
+	var out bytes.Buffer
+	load := testGraph(t, &out)
+
+	var mu sync.Mutex
+	events := map[string][]drawgl.Event{}
+
+	g := drawgl.Graph{Observer: func(e drawgl.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		events[e.Name] = append(events[e.Name], e)
+	}}
+
+	if err := g.Process(load); err != nil {
+		t.Fatalf("Error processing graph: %v\n", err)
+	}
+
+	for _, name := range []string{"Load", "BoxBlur", "Save"} {
+		e := events[name]
+		if len(e) < 2 {
+			t.Fatalf("Expected at least 2 events for %s, got %v\n", name, e)
+		}
+
+		if e[0].Kind != drawgl.NodeStarted {
+			t.Fatalf("Expected the first %s event to be %v, got %v\n", name, drawgl.NodeStarted, e[0].Kind)
+		}
+
+		last := e[len(e)-1]
+		if last.Kind != drawgl.NodeFinished || last.Progress != 1 {
+			t.Fatalf("Expected the last %s event to be a complete %v, got %v\n", name, drawgl.NodeFinished, last)
+		}
+	}
+
+	blur := events["BoxBlur"]
+	if b := blur[len(blur)-1].Bounds; b != image.Rect(0, 0, 4, 4) {
+		t.Fatalf("Unexpected BoxBlur bounds %v\n", b)
+	}
+
+	progress := 0
+	for _, e := range blur {
+		if e.Kind == drawgl.NodeProgress {
+			progress++
+		}
+	}
+
+	if progress == 0 {
+		t.Fatalf("Expected BoxBlur progress events\n")
+	}
+}
+
+// twoPassNode iterates over its input twice, announcing the pixels of the
+// second pass only after the first one is done
+type twoPassNode struct {
+	base.Node
+}
+
+func (n twoPassNode) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+	r := buffers[graph.InputName]
+	it := drawgl.LinearRectangleIterator(r.Buffer.Bounds())
+
+	for pass := 0; pass < 2 && r.Error == nil; pass++ {
+		r.Error = it.IterateSpans(ctx, r.Buffer, drawgl.Mask{}, func(s drawgl.Span) {})
+	}
+
+	output <- drawgl.Result{Id: n.Id(), Buffer: r.Buffer, Error: r.Error}
+
+	wd.Close()
+}
+
+func TestGraphProgressMonotonic(t *testing.T) {
+	load, err := io.NewLoadLinker(io.LoadOptions{Path: tests.TestDataDir() + "/test.png"})
+	if err != nil {
+		t.Fatalf("Error creating a load linker: %v\n", err)
+	}
+
+	passes := base.NewLinkerNode(twoPassNode{Node: base.NewNode()})
+	load.Link(passes)
+
+	var mu sync.Mutex
+	var progress []float64
+
+	g := drawgl.Graph{Observer: func(e drawgl.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if e.Id == passes.Node().Id() && (e.Kind == drawgl.NodeProgress || e.Kind == drawgl.NodeFinished) {
+			progress = append(progress, e.Progress)
+		}
+	}}
+
+	if err := g.Process(load); err != nil {
+		t.Fatalf("Error processing graph: %v\n", err)
+	}
+
+	if len(progress) < 2 {
+		t.Fatalf("Expected progress events, got %v\n", progress)
+	}
+
+	for i := 1; i < len(progress); i++ {
+		if progress[i] < progress[i-1] {
+			t.Fatalf("Expected the progress to never go down, got %v\n", progress)
+		}
+	}
+
+	if last := progress[len(progress)-1]; last != 1 {
+		t.Fatalf("Expected the progress to end at 1, got %v\n", progress)
+	}
+}
+
+func TestGraphNodeError(t *testing.T) {
+	load, err := io.NewLoadLinker(io.LoadOptions{Path: tests.TestDataDir() + "/test.png"})
+	if err != nil {
+		t.Fatalf("Error creating a load linker: %v\n", err)
+	}
+
+	var out bytes.Buffer
+	bad1 := unknownFormatSave(t, &out)
+	bad2 := unknownFormatSave(t, &out)
+
+	blur, err := convolution.NewBoxBlurLinker(convolution.BoxBlurOptions{Radius: 1})
+	if err != nil {
+		t.Fatalf("Error creating a box blur linker: %v\n", err)
+	}
+
+	var good bytes.Buffer
+	save, err := io.NewSaveLinker(io.SaveOptions{Writer: &good, Type: "png"})
+	if err != nil {
+		t.Fatalf("Error creating a save linker: %v\n", err)
+	}
+
+	load.Link(bad1)
+	load.Link(bad2)
+	load.Link(blur)
+	blur.Link(save)
+
+	g := drawgl.Graph{}
+	err = g.Process(load)
+
+	var nodeErr *drawgl.NodeError
+	if !errors.As(err, &nodeErr) {
+		t.Fatalf("Expected a node error, got %v\n", err)
+	}
+
+	if nodeErr.Name != "Save" || (nodeErr.Id != bad1.Node().Id() && nodeErr.Id != bad2.Node().Id()) {
+		t.Fatalf("Unexpected node error %v\n", nodeErr)
+	}
+
+	good.Reset()
+	g.ContinueOnError = true
+	err = g.Process(load)
+
+	var errs drawgl.Errors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("Expected 2 errors, got %v\n", err)
+	}
+
+	if !errors.As(err, &nodeErr) {
+		t.Fatalf("Expected a node error, got %v\n", err)
+	}
+
+	if good.Len() == 0 {
+		t.Fatalf("Expected the independent branch to be saved\n")
+	}
+}
+
+func TestGraphNodeErrorCancelled(t *testing.T) {
+	load, err := io.NewLoadLinker(io.LoadOptions{Path: tests.TestDataDir() + "/test.png"})
+	if err != nil {
+		t.Fatalf("Error creating a load linker: %v\n", err)
+	}
+
+	var out bytes.Buffer
+	bad := unknownFormatSave(t, &out)
+	load.Link(bad)
+
+	// The context ends after the node has failed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	g := drawgl.Graph{Observer: func(e drawgl.Event) {
+		if e.Kind == drawgl.NodeFailed {
+			cancel()
+		}
+	}}
+
+	err = g.ProcessContext(ctx, load)
+
+	var nodeErr *drawgl.NodeError
+	if !errors.As(err, &nodeErr) || nodeErr.Id != bad.Node().Id() {
+		t.Fatalf("Expected the node error to be reported, got %v\n", err)
+	}
+}
+
+func TestGraphCache(t *testing.T) {
+	g := drawgl.Graph{Cache: drawgl.NewMemoryCache(10)}
+
+	var mu sync.Mutex
+	progress := 0
+	g.Observer = func(e drawgl.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if e.Kind == drawgl.NodeProgress && e.Name == "BoxBlur" {
+			progress++
+		}
+	}
+
+	var out1, out2 bytes.Buffer
+	if err := g.Process(testGraph(t, &out1)); err != nil {
+		t.Fatalf("Error processing graph: %v\n", err)
+	}
+
+	if progress == 0 {
+		t.Fatalf("Expected the box blur to be processed\n")
+	}
+
+	progress = 0
+	if err := g.Process(testGraph(t, &out2)); err != nil {
+		t.Fatalf("Error processing graph: %v\n", err)
+	}
+
+	if progress != 0 {
+		t.Fatalf("Expected the box blur result to be cached\n")
+	}
+
+	if !bytes.Equal(out1.Bytes(), out2.Bytes()) {
+		t.Fatalf("Expected the cached output to match the original\n")
+	}
+}
+
+// blockingCache is a cache whose writes block until released
+type blockingCache struct {
+	drawgl.Cache
+	release chan struct{}
+	timeout chan struct{}
+	once    *sync.Once
+}
+
+func (c blockingCache) Put(key string, r drawgl.Result) {
+	select {
+	case <-c.release:
+	case <-time.After(5 * time.Second):
+		c.once.Do(func() { close(c.timeout) })
+	}
+
+	c.Cache.Put(key, r)
+}
+
+func TestGraphCacheSlowPut(t *testing.T) {
+	c := blockingCache{Cache: drawgl.NewMemoryCache(10), release: make(chan struct{}), timeout: make(chan struct{}), once: new(sync.Once)}
+
+	// The cached results are only written once the last node is done,
+	// which requires the nodes to be processed while the writes block
+	var once sync.Once
+	g := drawgl.Graph{Cache: c, Observer: func(e drawgl.Event) {
+		if e.Kind == drawgl.NodeFinished && e.Name == "Save" {
+			once.Do(func() { close(c.release) })
+		}
+	}}
+
+	var out bytes.Buffer
+	if err := g.Process(testGraph(t, &out)); err != nil {
+		t.Fatalf("Error processing graph: %v\n", err)
+	}
+
+	select {
+	case <-c.timeout:
+		t.Fatalf("Expected the graph to be processed while the cache is written\n")
+	default:
+	}
+
+	if out.Len() == 0 {
+		t.Fatalf("Expected the image to be saved\n")
+	}
+}
+
+func unknownFormatSave(t *testing.T, out *bytes.Buffer) graph.Linker {
+	save, err := io.NewSaveLinker(io.SaveOptions{Writer: out, Type: "bmp"})
+	if err != nil {
+		t.Fatalf("Error creating a save linker: %v\n", err)
+	}
+
+	return save
+}
+
+func testGraph(t *testing.T, out *bytes.Buffer) graph.Linker {
+	load, err := io.NewLoadLinker(io.LoadOptions{Path: tests.TestDataDir() + "/test.png"})
+	if err != nil {
+		t.Fatalf("Error creating a load linker: %v\n", err)
+	}
+
+	blur, err := convolution.NewBoxBlurLinker(convolution.BoxBlurOptions{Radius: 1})
+	if err != nil {
+		t.Fatalf("Error creating a box blur linker: %v\n", err)
+	}
+
+	save, err := io.NewSaveLinker(io.SaveOptions{Writer: out, Type: "png"})
+	if err != nil {
+		t.Fatalf("Error creating a save linker: %v\n", err)
+	}
+
+	load.Link(blur)
+	blur.Link(save)
+
+	return load
+}
@@ -1,23 +1,43 @@
 package drawgl
 
 import (
+	"context"
 	"image"
 	"image/color"
 	"image/draw"
 	"runtime"
-	"sync"
 )
 
 type RectangleIterator interface {
 	// Iterate iterates over the image buffer, calling the fn function for each
 	// point. The cycle order is row -> column. Implementations must ensure
-	// that all columns of a given row are received in a single goroutine
-	Iterate(mask Mask, fn func(pt image.Point, factor float32))
+	// that all columns of a given row are received in a single goroutine. The
+	// context is checked between rows, and its error is returned if it is
+	// done before the iteration completes
+	Iterate(ctx context.Context, mask Mask, fn func(pt image.Point, factor float32)) error
 	// VerticalIterate iterates over the image buffer, calling the fn function
 	// for each point. The cycle order is column -> row. Implementations must
 	// ensure that all rows of a given column are received in a single
-	// goroutine
-	VerticalIterate(mask Mask, fn func(pt image.Point, factor float32))
+	// goroutine. The context is checked between columns, and its error is
+	// returned if it is done before the iteration completes
+	VerticalIterate(ctx context.Context, mask Mask, fn func(pt image.Point, factor float32)) error
+	// IterateWorkers iterates as Iterate does, but calls newFn once in every
+	// goroutine the iteration runs in, and calls the returned function for
+	// the points handled by that goroutine. It allows the function to use
+	// state, such as scratch buffers, that cannot be shared between
+	// goroutines.
+	IterateWorkers(ctx context.Context, mask Mask, newFn func() func(pt image.Point, factor float32)) error
+	// IterateSpans iterates over the rows of the image buffer, calling the
+	// fn function with a span for each row, holding the row's pixels in
+	// img, and its mask factors. The rectangle has to lie within the bounds
+	// of img. The rows handed to a single goroutine are in increasing
+	// order. The context is checked between rows, and its error is
+	// returned if it is done before the iteration completes
+	IterateSpans(ctx context.Context, img *FloatImage, mask Mask, fn func(s Span)) error
+	// IterateSpanWorkers iterates as IterateSpans does, but calls newFn
+	// once in every goroutine the iteration runs in, as IterateWorkers
+	// does.
+	IterateSpanWorkers(ctx context.Context, img *FloatImage, mask Mask, newFn func() func(s Span)) error
 }
 
 type ParallelRectangleIterator image.Rectangle
@@ -31,6 +51,12 @@ type FloatImage struct {
 	Stride int
 	// Rect is the image's bounds.
 	Rect image.Rectangle
+	// ColorSpace is the color space of the pixels. Operations expect linear
+	// light, the default.
+	ColorSpace ColorSpace
+	// Alpha declares whether the color channels of the pixels are
+	// premultiplied by alpha, the default, or straight.
+	Alpha AlphaMode
 }
 
 func DefaultRectangleIterator(rect image.Rectangle, forceLinear ...bool) RectangleIterator {
@@ -41,140 +67,136 @@ func DefaultRectangleIterator(rect image.Rectangle, forceLinear ...bool) Rectang
 	return ParallelRectangleIterator(rect)
 }
 
-func (rect ParallelRectangleIterator) Iterate(mask Mask, fn func(pt image.Point, factor float32)) {
+func (rect ParallelRectangleIterator) Iterate(ctx context.Context, mask Mask, fn func(pt image.Point, factor float32)) error {
+	return rect.IterateWorkers(ctx, mask, func() func(pt image.Point, factor float32) { return fn })
+}
+
+func (rect ParallelRectangleIterator) IterateWorkers(ctx context.Context, mask Mask, newFn func() func(pt image.Point, factor float32)) error {
 	count := runtime.GOMAXPROCS(0)
 	if count == 1 {
-		LinearRectangleIterator(rect).Iterate(mask, fn)
-		return
+		return LinearRectangleIterator(rect).IterateWorkers(ctx, mask, newFn)
 	}
 
-	var wg sync.WaitGroup
+	r := image.Rectangle(rect)
 
-	rowchan := make(chan []int)
+	progress := progressFromContext(ctx)
+	progress.expect(r.Dx() * r.Dy())
 
-	go func() {
-		defer close(rowchan)
-
-		capacity := 200
-		i := 0
-		chunk := make([]int, i, capacity)
-		for y := rect.Min.Y; y < rect.Max.Y; y++ {
-			chunk = append(chunk, y)
-
-			if i == cap(chunk) || y == rect.Max.Y-1 {
-				rowchan <- chunk
+	rows := newSpans(r.Min.Y, r.Max.Y, iterateChunk)
+	parallel(count, func() {
+		fn := newFn()
+		for {
+			start, end, ok := rows.next(ctx)
+			if !ok {
+				return
+			}
 
-				if y != rect.Max.Y-1 {
-					i = 0
-					chunk = make([]int, 0, capacity)
+			for y := start; y < end; y++ {
+				for x := r.Min.X; x < r.Max.X; x++ {
+					pt := image.Pt(x, y)
+					f := MaskFactor(pt, mask)
+					fn(pt, f)
 				}
-			} else {
-				i++
 			}
+			progress.advance((end - start) * r.Dx())
 		}
-	}()
-
-	wg.Add(count)
-
-	for i := 0; i < count; i++ {
-		go func() {
-			defer wg.Done()
-			for chunk := range rowchan {
-				for _, y := range chunk {
-					for x := rect.Min.X; x < rect.Max.X; x++ {
-						pt := image.Pt(x, y)
-						f := MaskFactor(pt, mask)
-						fn(pt, f)
-					}
-				}
-			}
-		}()
-	}
+	})
 
-	wg.Wait()
+	return ctx.Err()
 }
 
-func (rect ParallelRectangleIterator) VerticalIterate(mask Mask, fn func(pt image.Point, factor float32)) {
+func (rect ParallelRectangleIterator) VerticalIterate(ctx context.Context, mask Mask, fn func(pt image.Point, factor float32)) error {
 	count := runtime.GOMAXPROCS(0)
 	if count == 1 {
-		LinearRectangleIterator(rect).VerticalIterate(mask, fn)
-		return
+		return LinearRectangleIterator(rect).VerticalIterate(ctx, mask, fn)
 	}
 
-	var wg sync.WaitGroup
-
-	rowchan := make(chan []int)
-
-	go func() {
-		defer close(rowchan)
+	r := image.Rectangle(rect)
 
-		capacity := 200
-		i := 0
-		chunk := make([]int, i, capacity)
-		for x := rect.Min.X; x < rect.Max.X; x++ {
-			chunk = append(chunk, x)
+	progress := progressFromContext(ctx)
+	progress.expect(r.Dx() * r.Dy())
 
-			if i == cap(chunk) || x == rect.Max.X-1 {
-				rowchan <- chunk
+	columns := newSpans(r.Min.X, r.Max.X, iterateChunk)
+	parallel(count, func() {
+		for {
+			start, end, ok := columns.next(ctx)
+			if !ok {
+				return
+			}
 
-				if x != rect.Max.X-1 {
-					i = 0
-					chunk = make([]int, 0, capacity)
+			for x := start; x < end; x++ {
+				for y := r.Min.Y; y < r.Max.Y; y++ {
+					pt := image.Pt(x, y)
+					f := MaskFactor(pt, mask)
+					fn(pt, f)
 				}
-			} else {
-				i++
 			}
+			progress.advance((end - start) * r.Dy())
 		}
-	}()
-
-	wg.Add(count)
-
-	for i := 0; i < count; i++ {
-		go func() {
-			defer wg.Done()
-			for chunk := range rowchan {
-				for _, x := range chunk {
-					for y := rect.Min.Y; y < rect.Max.Y; y++ {
-						pt := image.Pt(x, y)
-						f := MaskFactor(pt, mask)
-						fn(pt, f)
-					}
-				}
-			}
-		}()
-	}
+	})
 
-	wg.Wait()
+	return ctx.Err()
 }
 
-func (rect LinearRectangleIterator) Iterate(mask Mask, fn func(pt image.Point, factor float32)) {
+func (rect LinearRectangleIterator) Iterate(ctx context.Context, mask Mask, fn func(pt image.Point, factor float32)) error {
+	progress := progressFromContext(ctx)
+	progress.expect(image.Rectangle(rect).Dx() * image.Rectangle(rect).Dy())
+
 	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		for x := rect.Min.X; x < rect.Max.X; x++ {
 			pt := image.Pt(x, y)
 			f := MaskFactor(pt, mask)
 			fn(pt, f)
 		}
+		progress.advance(image.Rectangle(rect).Dx())
 	}
+
+	return nil
 }
 
-func (rect LinearRectangleIterator) VerticalIterate(mask Mask, fn func(pt image.Point, factor float32)) {
+func (rect LinearRectangleIterator) IterateWorkers(ctx context.Context, mask Mask, newFn func() func(pt image.Point, factor float32)) error {
+	return rect.Iterate(ctx, mask, newFn())
+}
+
+func (rect LinearRectangleIterator) VerticalIterate(ctx context.Context, mask Mask, fn func(pt image.Point, factor float32)) error {
+	progress := progressFromContext(ctx)
+	progress.expect(image.Rectangle(rect).Dx() * image.Rectangle(rect).Dy())
+
 	for x := rect.Min.X; x < rect.Max.X; x++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		for y := rect.Min.Y; y < rect.Max.Y; y++ {
 			pt := image.Pt(x, y)
 			f := MaskFactor(pt, mask)
 			fn(pt, f)
 		}
+		progress.advance(image.Rectangle(rect).Dy())
 	}
+
+	return nil
 }
 
 func (p *FloatImage) ColorModel() color.Model { return FloatColorModel }
 
 func (p *FloatImage) Bounds() image.Rectangle { return p.Rect }
 
+// At returns the color of the pixel at (x, y), premultiplied as required by
+// color.Color.
 func (p *FloatImage) At(x, y int) color.Color {
+	if p.Alpha == Straight {
+		return p.FloatAt(x, y).Premultiply()
+	}
 	return p.FloatAt(x, y)
 }
 
+// FloatAt returns the color of the pixel at (x, y) as it is stored, in the
+// alpha mode of the image.
 func (p *FloatImage) FloatAt(x, y int) FloatColor {
 	if !(image.Point{x, y}.In(p.Rect)) {
 		return FloatColor{}
@@ -195,12 +217,17 @@ func (p *FloatImage) PixOffset(x, y int) int {
 	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*4
 }
 
+// Set sets the pixel at (x, y) to the premultiplied color, converting it to
+// the alpha mode of the image.
 func (p *FloatImage) Set(x, y int, c color.Color) {
 	if !(image.Point{x, y}.In(p.Rect)) {
 		return
 	}
 	i := p.PixOffset(x, y)
 	c1 := FloatColorModel.Convert(c).(FloatColor)
+	if p.Alpha == Straight {
+		c1 = c1.Unpremultiply()
+	}
 	p.Pix[i] = c1.R
 	p.Pix[i+1] = c1.G
 	p.Pix[i+2] = c1.B
@@ -234,9 +261,11 @@ func (p *FloatImage) SubImage(r image.Rectangle) image.Image {
 	}
 	i := p.PixOffset(r.Min.X, r.Min.Y)
 	return &FloatImage{
-		Pix:    p.Pix[i:],
-		Stride: p.Stride,
-		Rect:   r,
+		Pix:        p.Pix[i:],
+		Stride:     p.Stride,
+		Rect:       r,
+		ColorSpace: p.ColorSpace,
+		Alpha:      p.Alpha,
 	}
 }
 
@@ -258,19 +287,25 @@ func (p *FloatImage) Opaque() bool {
 	return true
 }
 
-// NewFloatImage returns a new FloatImage with the given bounds.
+// NewFloatImage returns a new FloatImage with the given bounds, in linear
+// light.
 func NewFloatImage(r image.Rectangle) *FloatImage {
 	w, h := r.Dx(), r.Dy()
 	pix := make([]ColorValue, 4*w*h)
-	return &FloatImage{pix, 4 * w, r}
+	return &FloatImage{Pix: pix, Stride: 4 * w, Rect: r}
 }
 
+// ConvertImage converts an image into a FloatImage. Images other than
+// FloatImages hold sRGB encoded values, which are kept as they are, so the
+// result is in the SRGB color space. ConvertColorSpace converts it into
+// linear light.
 func ConvertImage(img image.Image) *FloatImage {
 	if d, ok := img.(*FloatImage); ok {
 		return d
 	} else {
 		b := img.Bounds()
 		fi := NewFloatImage(b)
+		fi.ColorSpace = SRGB
 		draw.Draw(fi, b, img, b.Min, draw.Src)
 
 		return fi
@@ -285,3 +320,14 @@ func CopyImage(img *FloatImage) *FloatImage {
 
 	return cp
 }
+
+// CropImage returns a copy of the portion of the image visible through r.
+// Unlike SubImage, the returned image does not share its pixels with the
+// original.
+func CropImage(img *FloatImage, r image.Rectangle) *FloatImage {
+	cp := NewFloatImage(r.Intersect(img.Rect))
+	cp.ColorSpace, cp.Alpha = img.ColorSpace, img.Alpha
+	copyRect(cp, img, cp.Rect)
+
+	return cp
+}
@@ -2,16 +2,18 @@ package interpolator
 
 import (
 	"image"
+	"math"
 
 	"github.com/urandom/drawgl"
 )
 
 type approximateBilinear struct {
 	bias image.Point
+	edge drawgl.EdgeHandler
 }
 
-func newApproximageBilinear(bias image.Point) approximateBilinear {
-	return approximateBilinear{bias: bias}
+func newApproximateBilinear(bias image.Point, edge drawgl.EdgeHandler) approximateBilinear {
+	return approximateBilinear{bias: bias, edge: edge}
 }
 
 // Copy from golang.org/x/image/draw
@@ -21,55 +23,39 @@ func (i approximateBilinear) Get(src *drawgl.FloatImage, fx, fy float64) drawgl.
 	fx -= 0.5
 	fy -= 0.5
 
-	ix0 := int(fx)
-	iy0 := int(fy)
+	ix0 := int(math.Floor(fx))
+	iy0 := int(math.Floor(fy))
 
 	xFrac0 := drawgl.ColorValue(fx - float64(ix0))
 	xFrac1 := drawgl.ColorValue(1 - xFrac0)
 	yFrac0 := drawgl.ColorValue(fy - float64(iy0))
 	yFrac1 := drawgl.ColorValue(1 - yFrac0)
 
+	// The corners beyond the sides of the image are provided by the edge
+	// handler
 	ix0 += i.bias.X
 	ix1 := ix0 + 1
-	if ix0 < b.Min.X {
-		ix0, ix1 = b.Min.X, b.Min.X
-	} else if ix1 >= b.Max.X {
-		ix0, ix1 = b.Max.X-1, b.Max.X-1
-		xFrac0, xFrac1 = 1, 0
-	}
 
 	iy0 += i.bias.Y
 	iy1 := iy0 + 1
-	if iy0 < b.Min.Y {
-		iy0, iy1 = b.Min.Y, b.Min.Y
-	} else if iy1 >= b.Max.Y {
-		iy0, iy1 = b.Max.Y-1, b.Max.Y-1
-		yFrac0, yFrac1 = 1, 0
-	}
 
-	s00i := (iy0-b.Min.Y)*src.Stride + (ix0-b.Min.X)*4
-	s00r := src.Pix[s00i+0]
-	s00g := src.Pix[s00i+1]
-	s00b := src.Pix[s00i+2]
-	s00a := src.Pix[s00i+3]
+	s00 := drawgl.EdgeColor(src, ix0, iy0, b, i.edge)
+	s00r, s00g, s00b, s00a := s00.R, s00.G, s00.B, s00.A
 
-	s10i := (iy0-b.Min.Y)*src.Stride + (ix1-b.Min.X)*4
-	s10r := xFrac0*src.Pix[s10i+0] + xFrac1*s00r
-	s10g := xFrac0*src.Pix[s10i+1] + xFrac1*s00g
-	s10b := xFrac0*src.Pix[s10i+2] + xFrac1*s00b
-	s10a := xFrac0*src.Pix[s10i+3] + xFrac1*s00a
+	s10 := drawgl.EdgeColor(src, ix1, iy0, b, i.edge)
+	s10r := xFrac0*s10.R + xFrac1*s00r
+	s10g := xFrac0*s10.G + xFrac1*s00g
+	s10b := xFrac0*s10.B + xFrac1*s00b
+	s10a := xFrac0*s10.A + xFrac1*s00a
 
-	s01i := (iy1-b.Min.Y)*src.Stride + (ix0-b.Min.X)*4
-	s01r := src.Pix[s01i+0]
-	s01g := src.Pix[s01i+1]
-	s01b := src.Pix[s01i+2]
-	s01a := src.Pix[s01i+3]
+	s01 := drawgl.EdgeColor(src, ix0, iy1, b, i.edge)
+	s01r, s01g, s01b, s01a := s01.R, s01.G, s01.B, s01.A
 
-	s11i := (iy1-b.Min.Y)*src.Stride + (ix1-b.Min.X)*4
-	s11r := xFrac0*src.Pix[s11i+0] + xFrac1*s01r
-	s11g := xFrac0*src.Pix[s11i+1] + xFrac1*s01g
-	s11b := xFrac0*src.Pix[s11i+2] + xFrac1*s01b
-	s11a := xFrac0*src.Pix[s11i+3] + xFrac1*s01a
+	s11 := drawgl.EdgeColor(src, ix1, iy1, b, i.edge)
+	s11r := xFrac0*s11.R + xFrac1*s01r
+	s11g := xFrac0*s11.G + xFrac1*s01g
+	s11b := xFrac0*s11.B + xFrac1*s01b
+	s11a := xFrac0*s11.A + xFrac1*s01a
 
 	return drawgl.FloatColor{
 		R: yFrac0*s11r + yFrac1*s10r,
@@ -8,56 +8,136 @@ import (
 	"github.com/urandom/drawgl/operation/transform/matrix"
 )
 
+// Interpolator samples an image at fractional coordinates. An interpolator
+// may keep scratch state between calls, and must not be used by multiple
+// goroutines at the same time.
 type Interpolator interface {
 	Get(src *drawgl.FloatImage, x, y float64) drawgl.FloatColor
 }
 
+// Factory creates interpolators with the same configuration, so that every
+// goroutine can use its own.
+type Factory func() Interpolator
+
+// Kinds lists the names of the available interpolators. An empty name
+// selects the default, Bilinear.
+var Kinds = []string{"NearestNeighbor", "ApproximateBilinear", "Bilinear", "CatmullRom", "Lanczos"}
+
+// deprecatedKinds maps the old names of interpolators to the current ones.
+var deprecatedKinds = map[string]string{
+	// Deprecated: misspelling of ApproximateBilinear
+	"ApproximageBilinear": "ApproximateBilinear",
+}
+
+// Valid reports whether kind names a known interpolator.
+func Valid(kind string) bool {
+	kind = canonical(kind)
+	if kind == "" {
+		return true
+	}
+
+	for _, k := range Kinds {
+		if k == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Option describes the Interpolator option of the operations that resample
+// images.
+func Option() drawgl.OptionDescriptor {
+	return drawgl.OptionDescriptor{
+		Name:    "Interpolator",
+		Type:    drawgl.StringOption,
+		Enum:    Kinds,
+		Default: "Bilinear",
+		Doc:     "the interpolator used to resample the image",
+	}
+}
+
+// New returns a factory of interpolators of the given kind, for sampling
+// the source image through the transformation matrix. Points beyond the
+// sides of the source are provided by the edge handler.
 func New(
 	kind string,
 	src *drawgl.FloatImage,
 	m matrix.Matrix3,
 	bias image.Point,
-) Interpolator {
+	edge drawgl.EdgeHandler,
+) Factory {
 
-	switch kind {
+	switch canonical(kind) {
 	case "NearestNeighbor":
-		return nearestNeighbor{}
-	case "ApproximageBilinear":
-		return newApproximageBilinear(bias)
+		i := nearestNeighbor{edge: edge}
+		return func() Interpolator { return i }
+	case "ApproximateBilinear":
+		i := newApproximateBilinear(bias, edge)
+		return func() Interpolator { return i }
 	case "CatmullRom":
-		k := newKernel(src, m)
-		k.Support = 2
-		k.At = func(t float64) float64 {
+		k := newKernel(src, m, edge, 2, func(t float64) float64 {
 			if t < 1 {
 				return (1.5*t-2.5)*t*t + 1
 			}
 			return ((-0.5*t+2.5)*t-4)*t + 2
-		}
+		})
 
-		return k
+		return k.factory()
 	case "Lanczos":
-		k := newKernel(src, m)
-		k.Support = 3
-		k.At = func(t float64) float64 {
+		k := newKernel(src, m, edge, 3, func(t float64) float64 {
 			t = math.Abs(t)
 			if t < 3 {
 				return sinc(t) * sinc(t/3)
 			}
 			return 0
-		}
+		})
 
-		return k
+		return k.factory()
 	case "Bilinear":
 		fallthrough
 	default:
-		k := newKernel(src, m)
-		k.Support = 1
-		k.At = func(t float64) float64 {
+		k := newKernel(src, m, edge, 1, func(t float64) float64 {
 			return 1 - t
-		}
+		})
+
+		return k.factory()
+	}
+}
 
+// canonical returns the current name of a deprecated interpolator kind.
+func canonical(kind string) string {
+	if k, ok := deprecatedKinds[kind]; ok {
 		return k
 	}
+
+	return kind
+}
+
+// Padding returns the number of pixels around a source point that an
+// interpolator of the given kind might read, when used with the given
+// transformation matrix.
+func Padding(kind string, m matrix.Matrix3) int {
+	var support float64
+	switch canonical(kind) {
+	case "NearestNeighbor", "ApproximateBilinear":
+		support = 1
+	case "CatmullRom":
+		support = 2
+	case "Lanczos":
+		support = 3
+	default:
+		support = 1
+	}
+
+	scale := 1.0
+	for _, s := range []float64{m[0][0], m[0][1], m[1][0], m[1][1]} {
+		if s := abs(s); s > scale {
+			scale = s
+		}
+	}
+
+	return int(math.Ceil(support*scale)) + 1
 }
 
 func sinc(x float64) float64 {
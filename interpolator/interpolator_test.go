@@ -0,0 +1,247 @@
+package interpolator_test
+
+import (
+	"image"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/interpolator"
+	"github.com/urandom/drawgl/operation/transform/matrix"
+)
+
+func TestConcurrentInterpolators(t *testing.T) {
+	src := drawgl.NewFloatImage(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			v := drawgl.ColorValue((x*7+y*13)%32) / 32
+			src.UnsafeSetColor(x, y, drawgl.FloatColor{R: v, G: 1 - v, B: v / 2, A: 1})
+		}
+	}
+
+	// A downscale widens the kernels, so that their weights span several
+	// pixels
+	m := matrix.New3()
+	m[0][0], m[1][1] = 2.5, 2.5
+
+	samples := make([][2]float64, 0, 31*31)
+	for y := 0.5; y < 31; y++ {
+		for x := 0.5; x < 31; x++ {
+			samples = append(samples, [2]float64{x + 0.25, y + 0.75})
+		}
+	}
+
+	for _, kind := range interpolator.Kinds {
+		factory := interpolator.New(kind, src, m, image.Point{}, drawgl.Extend)
+
+		expected := make([]drawgl.FloatColor, len(samples))
+		i := factory()
+		for j, s := range samples {
+			expected[j] = i.Get(src, s[0], s[1])
+
+			if _, ok := kernels[kind]; !ok {
+				continue
+			}
+
+			if ref := referenceSample(src, kind, 2.5, s[0], s[1]); !expected[j].ApproxEqual(ref) {
+				t.Fatalf("%s: expected %v at %v, got %v\n", kind, ref, s, expected[j])
+			}
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan string, 8)
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+
+				i := factory()
+				// Every goroutine samples the points in a different order
+				for n := range samples {
+					j := (n + w*len(samples)/8) % len(samples)
+					if c := i.Get(src, samples[j][0], samples[j][1]); c != expected[j] {
+						errs <- kind
+						return
+					}
+				}
+			}(w)
+		}
+
+		wg.Wait()
+		close(errs)
+
+		if kind, ok := <-errs; ok {
+			t.Fatalf("Expected concurrent %s interpolators to match the sequential result\n", kind)
+		}
+	}
+}
+
+func TestKernels(t *testing.T) {
+	src := drawgl.NewFloatImage(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			v := drawgl.ColorValue((x*3+y*5)%8) / 8
+			src.UnsafeSetColor(x, y, drawgl.FloatColor{R: v, G: 1 - v, B: v / 2, A: 1})
+		}
+	}
+
+	for kind := range kernels {
+		i := interpolator.New(kind, src, matrix.New3(), image.Point{}, drawgl.Extend)()
+
+		// Sampling a pixel center produces the pixel itself
+		for _, p := range []image.Point{{0, 0}, {3, 0}, {5, 6}, {7, 7}} {
+			exp := src.UnsafeFloatAt(p.X, p.Y)
+			if c := i.Get(src, float64(p.X)+0.5, float64(p.Y)+0.5); !c.ApproxEqual(exp) {
+				t.Fatalf("%s: expected %v at the center of %v, got %v\n", kind, exp, p, c)
+			}
+		}
+
+		for _, s := range [][2]float64{{3, 0.5}, {2.25, 4.75}, {0.1, 7.9}} {
+			if c, ref := i.Get(src, s[0], s[1]), referenceSample(src, kind, 1, s[0], s[1]); !c.ApproxEqual(ref) {
+				t.Fatalf("%s: expected %v at %v, got %v\n", kind, ref, s, c)
+			}
+		}
+	}
+}
+
+func TestEdge(t *testing.T) {
+	src := drawgl.NewFloatImage(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			src.UnsafeSetColor(x, y, drawgl.FloatColor{R: 1, G: 1, B: 1, A: 1})
+		}
+	}
+
+	white := drawgl.FloatColor{R: 1, G: 1, B: 1, A: 1}
+	red := drawgl.FloatColor{R: 1, A: 1}
+
+	for _, kind := range interpolator.Kinds {
+		// Extending the sides of an opaque image keeps it opaque
+		i := interpolator.New(kind, src, matrix.New3(), image.Point{}, drawgl.Extend)()
+		for _, x := range []float64{0.1, 0.25, 3.75, 3.9} {
+			if c := i.Get(src, x, 0.25); !c.ApproxEqual(white) {
+				t.Fatalf("%s: expected white at %v:0.25, got %v\n", kind, x, c)
+			}
+		}
+	}
+
+	// The approximate bilinear interpolator blends the pixels with the
+	// edge colors near the sides
+	for _, edge := range []drawgl.EdgeHandler{drawgl.Transparent, drawgl.Constant(red)} {
+		i := interpolator.New("ApproximateBilinear", src, matrix.New3(), image.Point{}, edge)()
+
+		exp := drawgl.FloatColor{R: 0.75, G: 0.75, B: 0.75, A: 0.75}
+		if edge != drawgl.Transparent {
+			exp = drawgl.FloatColor{R: 1, G: 0.75, B: 0.75, A: 1}
+		}
+
+		if c := i.Get(src, 0.25, 2); !c.ApproxEqual(exp) {
+			t.Fatalf("%s: expected %v, got %v\n", edge, exp, c)
+		}
+
+		if c := i.Get(src, 2, 2); !c.ApproxEqual(white) {
+			t.Fatalf("%s: expected white away from the sides, got %v\n", edge, c)
+		}
+	}
+}
+
+func TestDeprecatedKinds(t *testing.T) {
+	for _, kind := range interpolator.Kinds {
+		if kind == "ApproximageBilinear" {
+			t.Fatalf("Expected the misspelled kind to be left out of the listed kinds\n")
+		}
+	}
+
+	if !interpolator.Valid("ApproximageBilinear") {
+		t.Fatalf("Expected the misspelled kind to remain valid\n")
+	}
+
+	src := drawgl.NewFloatImage(image.Rect(0, 0, 4, 4))
+	for x := 0; x < 4; x++ {
+		src.UnsafeSetColor(x, 1, drawgl.FloatColor{R: drawgl.ColorValue(x) / 4, A: 1})
+	}
+
+	m := matrix.New3()
+	i := interpolator.New("ApproximateBilinear", src, m, image.Point{}, drawgl.Extend)()
+	old := interpolator.New("ApproximageBilinear", src, m, image.Point{}, drawgl.Extend)()
+
+	if c, o := i.Get(src, 1.25, 1.5), old.Get(src, 1.25, 1.5); c != o {
+		t.Fatalf("Expected the misspelled kind to interpolate %v, got %v\n", c, o)
+	}
+
+	if p, o := interpolator.Padding("ApproximateBilinear", m), interpolator.Padding("ApproximageBilinear", m); p != o {
+		t.Fatalf("Expected the misspelled kind to pad by %d, got %d\n", p, o)
+	}
+}
+
+// kernels holds the support and function of each kernel interpolator.
+var kernels = map[string]struct {
+	support float64
+	at      func(t float64) float64
+}{
+	"Bilinear": {1, func(t float64) float64 { return 1 - t }},
+	"CatmullRom": {2, func(t float64) float64 {
+		if t < 1 {
+			return (1.5*t-2.5)*t*t + 1
+		}
+		return ((-0.5*t+2.5)*t-4)*t + 2
+	}},
+	"Lanczos": {3, func(t float64) float64 {
+		if t == 0 {
+			return 1
+		}
+		return 3 * math.Sin(math.Pi*t) * math.Sin(math.Pi*t/3) / (math.Pi * math.Pi * t * t)
+	}},
+}
+
+// referenceSample computes the sample of a kernel at fx:fy directly, as the
+// normalized sum of every pixel of the extended source, with the kernel
+// widened by scale.
+func referenceSample(src *drawgl.FloatImage, kind string, scale, fx, fy float64) drawgl.FloatColor {
+	k := kernels[kind]
+	weight := func(d float64) float64 {
+		if t := math.Abs(d) / scale; t < k.support {
+			return k.at(t)
+		}
+		return 0
+	}
+
+	clamp := func(v, max int) int {
+		if v < 0 {
+			return 0
+		}
+		if v > max {
+			return max
+		}
+		return v
+	}
+
+	b := src.Bounds()
+	r := int(math.Ceil(k.support*scale)) + 1
+
+	var total float64
+	var sum [4]float64
+	for y := int(fy) - r; y <= int(fy)+r; y++ {
+		for x := int(fx) - r; x <= int(fx)+r; x++ {
+			w := weight(fx-0.5-float64(x)) * weight(fy-0.5-float64(y))
+			if w == 0 {
+				continue
+			}
+
+			c := src.UnsafeFloatAt(clamp(x, b.Max.X-1), clamp(y, b.Max.Y-1))
+			sum[0] += float64(c.R) * w
+			sum[1] += float64(c.G) * w
+			sum[2] += float64(c.B) * w
+			sum[3] += float64(c.A) * w
+			total += w
+		}
+	}
+
+	return drawgl.FloatColor{
+		R: drawgl.ColorValue(sum[0] / total),
+		G: drawgl.ColorValue(sum[1] / total),
+		B: drawgl.ColorValue(sum[2] / total),
+		A: drawgl.ColorValue(sum[3] / total),
+	}.ClampPremultiplied()
+}
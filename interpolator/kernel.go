@@ -17,13 +17,18 @@ type kernel struct {
 
 	halfWidth, kernelArgScale [2]float64
 	weights                   [2][]float64
+	edge                      drawgl.EdgeHandler
 }
 
 func newKernel(
 	src *drawgl.FloatImage,
 	m matrix.Matrix3,
+	edge drawgl.EdgeHandler,
+	support float64,
+	at func(t float64) float64,
 ) kernel {
-	i := kernel{}
+	// The support has to be known before the half widths are scaled from it
+	i := kernel{Support: support, At: at, edge: edge}
 
 	xscale := abs(m[0][0])
 	if s := abs(m[0][1]); xscale < s {
@@ -47,97 +52,77 @@ func newKernel(
 		i.kernelArgScale[1] = 1 / yscale
 	}
 
-	i.weights[0] = make([]float64, 1+2*int(math.Ceil(i.halfWidth[0])))
-	i.weights[1] = make([]float64, 1+2*int(math.Ceil(i.halfWidth[1])))
-
 	return i
 }
 
+// factory returns a factory of copies of the kernel, each with its own
+// weights.
+func (i kernel) factory() Factory {
+	return func() Interpolator {
+		k := i
+		k.weights[0] = make([]float64, 1+2*int(math.Ceil(i.halfWidth[0])))
+		k.weights[1] = make([]float64, 1+2*int(math.Ceil(i.halfWidth[1])))
+
+		return k
+	}
+}
+
 // Copy from golang.org/x/image/draw
 // Copyright (c) 2009 The Go Authors. All rights reserved.
 func (i kernel) Get(src *drawgl.FloatImage, fx, fy float64) drawgl.FloatColor {
 	b := src.Bounds()
 
-	totalWeights := [2]float64{}
-
+	// The taps beyond the sides of the image are provided by the edge
+	// handler
 	fx -= 0.5
 	ix := int(math.Floor(fx - i.halfWidth[0]))
-
-	if ix < b.Min.X {
-		ix = b.Min.X
-	}
-
-	jx := int(math.Ceil(fx + i.halfWidth[1]))
-	if jx > b.Max.X {
-		jx = b.Max.X
-	}
-
-	for kx := ix; kx < jx; kx++ {
-		w := 0.0
-		if t := abs((fx - float64(kx)) * i.kernelArgScale[0]); t < i.Support {
-			w = i.At(t)
-		}
-		i.weights[0][kx-ix] = w
-		totalWeights[0] += w
-	}
-
-	for x := range i.weights[0][:jx-ix] {
-		i.weights[0][x] /= totalWeights[0]
-	}
+	jx := int(math.Ceil(fx + i.halfWidth[0]))
+	i.computeWeights(i.weights[0][:jx-ix], fx, ix, i.kernelArgScale[0])
 
 	fy -= 0.5
 	iy := int(math.Floor(fy - i.halfWidth[1]))
-	if iy < b.Min.Y {
-		iy = b.Min.Y
-	}
-
 	jy := int(math.Ceil(fy + i.halfWidth[1]))
-	if jy > b.Max.Y {
-		jy = b.Max.Y
-	}
-
-	for ky := iy; ky < jy; ky++ {
-		w := 0.0
-		if t := abs((fy - float64(ky)) * i.kernelArgScale[1]); t < i.Support {
-			w = i.At(t)
-		}
-
-		i.weights[1][ky-iy] = w
-		totalWeights[1] += w
-	}
-
-	for y := range i.weights[1][:jy-iy] {
-		i.weights[1][y] /= totalWeights[1]
-	}
+	i.computeWeights(i.weights[1][:jy-iy], fy, iy, i.kernelArgScale[1])
 
 	var pr, pg, pb, pa drawgl.ColorValue
 	for ky := iy; ky < jy; ky++ {
 		if yw := i.weights[1][ky-iy]; yw != 0 {
 			for kx := ix; kx < jx; kx++ {
 				if xw := drawgl.ColorValue(i.weights[0][kx-ix] * yw); xw != 0 {
-					pi := (ky-b.Min.Y)*src.Stride + (kx-b.Min.X)*4
-					pr += src.Pix[pi+0] * xw
-					pg += src.Pix[pi+1] * xw
-					pb += src.Pix[pi+2] * xw
-					pa += src.Pix[pi+3] * xw
+					c := drawgl.EdgeColor(src, kx, ky, b, i.edge)
+					pr += c.R * xw
+					pg += c.G * xw
+					pb += c.B * xw
+					pa += c.A * xw
 				}
 			}
 		}
 	}
 
-	if pr > pa {
-		pr = pa
-	}
+	// Negative lobes may overshoot the premultiplied range
+	return drawgl.FloatColor{R: pr, G: pg, B: pb, A: pa}.ClampPremultiplied()
+}
 
-	if pg > pa {
-		pg = pa
+// computeWeights stores the normalized weights of the taps starting at
+// start, for sampling at f.
+func (i kernel) computeWeights(weights []float64, f float64, start int, scale float64) {
+	var total float64
+	for k := range weights {
+		w := 0.0
+		if t := abs((f - float64(start+k)) * scale); t < i.Support {
+			w = i.At(t)
+		}
+		weights[k] = w
+		total += w
 	}
 
-	if pb > pa {
-		pb = pa
+	if total == 0 {
+		return
 	}
 
-	return drawgl.FloatColor{R: pr, G: pg, B: pb, A: pa}
+	for k := range weights {
+		weights[k] /= total
+	}
 }
 
 func abs(x float64) float64 {
@@ -0,0 +1,436 @@
+package drawgl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"text/template"
+
+	"github.com/urandom/graph"
+)
+
+// jsonNode is a node of a JSON graph definition. Besides the format read by
+// graph.ProcessJSON, a node may be labelled with an Id, so that it can be
+// referenced from the outputs of other nodes by an object holding only a
+// Ref, and connected to a named input of its parent with To.
+type jsonNode struct {
+	Id      string                                  `json:",omitempty"`
+	Name    string                                  `json:",omitempty"`
+	Options json.RawMessage                         `json:",omitempty"`
+	Outputs map[graph.ConnectorName]json.RawMessage `json:",omitempty"`
+	Ref     string                                  `json:",omitempty"`
+	To      graph.ConnectorName                     `json:",omitempty"`
+}
+
+// document holds the nodes and connections of a parsed JSON graph
+// definition, along with all the problems found in it.
+type document struct {
+	roots []*documentNode
+	nodes []*documentNode
+	ids   map[string]*documentNode
+	edges []documentEdge
+	errs  Errors
+	// overrides holds the option overrides, and whether each one has
+	// matched a node
+	overrides []Override
+	used      []bool
+}
+
+type documentNode struct {
+	path   string
+	linker graph.Linker
+	edges  []int
+}
+
+// documentEdge connects an output of a node to an input of either a nested
+// node, or a referenced one.
+type documentEdge struct {
+	path     string
+	from     *documentNode
+	output   graph.ConnectorName
+	to       *documentNode
+	ref      string
+	input    graph.ConnectorName
+	resolved bool
+}
+
+// JSONGraph holds the linkers of a JSON graph definition.
+type JSONGraph struct {
+	Roots []graph.Linker
+	// Nodes holds the linkers of the nodes that are labelled with an Id
+	Nodes map[string]graph.Linker
+	// Linkers holds the linkers of all nodes, in the order they appear in
+	// the definition
+	Linkers []graph.Linker
+}
+
+// ProcessJSON reads a JSON graph definition, in the format of
+// graph.ProcessJSON, extended with node ids and references. A node labelled
+// with "Id" may be connected to the outputs of other nodes with a reference
+// such as {"Ref": "bg", "To": "Background"}, while "To" on a nested node
+// selects the input it is connected to. Outputs may also hold an array of
+// nodes. Problems, including dangling references and cycles, are returned as
+// a *ValidationError, or as Errors if there is more than one.
+//
+// Option values may also be expressions, marked with the ExpressionPrefix,
+// such as "=input.width / 2", which are evaluated against the node's main
+// input when the graph is processed by a Graph. The given overrides replace
+// options of the matching nodes before they are constructed.
+func ProcessJSON(r io.Reader, data *graph.JSONTemplateData, overrides ...Override) ([]graph.Linker, error) {
+	g, err := ReadJSON(r, data, overrides...)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.Roots, nil
+}
+
+// ReadJSON is like ProcessJSON, but also returns the linkers of the nodes
+// that are labelled with an Id.
+func ReadJSON(r io.Reader, data *graph.JSONTemplateData, overrides ...Override) (JSONGraph, error) {
+	doc, err := parseJSON(r, data, overrides)
+	if err != nil {
+		return JSONGraph{}, err
+	}
+
+	if err := doc.err(); err != nil {
+		return JSONGraph{}, err
+	}
+
+	for _, e := range doc.edges {
+		if err := e.from.linker.Link(e.to.linker, e.output, e.input); err != nil {
+			return JSONGraph{}, &ValidationError{Path: e.path, Err: err}
+		}
+	}
+
+	g := JSONGraph{
+		Roots: make([]graph.Linker, len(doc.roots)),
+		Nodes: make(map[string]graph.Linker, len(doc.ids)),
+	}
+	for i, n := range doc.roots {
+		g.Roots[i] = n.linker
+	}
+	for id, n := range doc.ids {
+		g.Nodes[id] = n.linker
+	}
+	for _, n := range doc.nodes {
+		g.Linkers = append(g.Linkers, n.linker)
+	}
+
+	return g, nil
+}
+
+func parseJSON(r io.Reader, data *graph.JSONTemplateData, overrides []Override) (*document, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if data != nil {
+		t, err := template.New("json").Parse(string(b))
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+
+		b = buf.Bytes()
+	}
+
+	raw, err := splitNodes(b)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &document{
+		ids:       make(map[string]*documentNode),
+		overrides: overrides,
+		used:      make([]bool, len(overrides)),
+	}
+	for i := range raw {
+		path := fmt.Sprintf("[%d]", i)
+
+		var n jsonNode
+		if err := decodeNode(raw[i], &n); err != nil {
+			doc.addError(path, err)
+			continue
+		}
+
+		if n.Ref != "" || n.To != "" {
+			doc.addError(path, fmt.Errorf("a root node cannot have a Ref or To"))
+			continue
+		}
+
+		if root := doc.parseNode(n, path); root != nil {
+			doc.roots = append(doc.roots, root)
+		}
+	}
+
+	for i, o := range doc.overrides {
+		if !doc.used[i] && !o.Optional {
+			doc.addError(o.String(), fmt.Errorf("no node matches the override"))
+		}
+	}
+
+	doc.resolve()
+	doc.checkCycles()
+
+	return doc, nil
+}
+
+// parseNode constructs the linker of the node and its nested nodes,
+// recording the connections between them. It returns nil if the node
+// itself is invalid.
+func (d *document) parseNode(n jsonNode, path string) *documentNode {
+	if n.Name == "" {
+		d.addError(path, fmt.Errorf("missing node name"))
+		return nil
+	}
+
+	path += n.Name
+	if n.Id != "" {
+		path += "#" + n.Id
+	}
+
+	options, err := d.applyOverrides(n)
+	if err != nil {
+		d.addError(path, err)
+		return nil
+	}
+
+	var node *documentNode
+	if factory, ok := linkerFactory(n.Name); !ok {
+		d.addError(path, fmt.Errorf("unknown node %q", n.Name))
+	} else if l, err := newNodeLinker(n.Name, options, factory); err != nil {
+		d.addError(path, err)
+	} else {
+		node = &documentNode{path: path, linker: l}
+		d.nodes = append(d.nodes, node)
+	}
+
+	if n.Id != "" {
+		if _, ok := d.ids[n.Id]; ok {
+			d.addError(path, fmt.Errorf("duplicate node id %q", n.Id))
+		} else {
+			// Invalid nodes are registered as well, so that their references
+			// are not reported as dangling
+			d.ids[n.Id] = node
+		}
+	}
+
+	outputs := make([]string, 0, len(n.Outputs))
+	for c := range n.Outputs {
+		outputs = append(outputs, string(c))
+	}
+	sort.Strings(outputs)
+
+	for _, o := range outputs {
+		output := graph.ConnectorName(o)
+		if node != nil && !hasConnector(nodeOutputs(node.linker.Node()), output) {
+			d.addError(path, fmt.Errorf("unknown output connector %q", output))
+		}
+
+		children, err := splitNodes(n.Outputs[output])
+		if err != nil {
+			d.addError(path, fmt.Errorf("output %q: %v", output, err))
+			continue
+		}
+
+		for _, raw := range children {
+			d.parseChild(node, output, raw, fmt.Sprintf("%s/%s:", path, output))
+		}
+	}
+
+	return node
+}
+
+func (d *document) parseChild(parent *documentNode, output graph.ConnectorName, raw json.RawMessage, path string) {
+	var n jsonNode
+	if err := decodeNode(raw, &n); err != nil {
+		d.addError(path, err)
+		return
+	}
+
+	e := documentEdge{from: parent, output: output, input: n.To}
+	if e.input == "" {
+		e.input = graph.InputName
+	}
+
+	if n.Ref != "" {
+		if n.Id != "" || n.Name != "" || n.Options != nil || n.Outputs != nil {
+			d.addError(path+"@"+n.Ref, fmt.Errorf("a reference can only have a Ref and To"))
+			return
+		}
+
+		e.path, e.ref = path+"@"+n.Ref, n.Ref
+	} else {
+		e.to = d.parseNode(n, path)
+		if e.to == nil {
+			return
+		}
+		e.path, e.resolved = e.to.path, true
+	}
+
+	if parent != nil {
+		d.edges = append(d.edges, e)
+	}
+}
+
+// resolve connects the references to their nodes, and checks the inputs of
+// every connection.
+func (d *document) resolve() {
+	for i := range d.edges {
+		e := &d.edges[i]
+
+		if !e.resolved {
+			n, ok := d.ids[e.ref]
+			if !ok {
+				d.addError(e.path, fmt.Errorf("reference to unknown node id %q", e.ref))
+				continue
+			}
+
+			if n == nil {
+				// The referenced node is invalid, and has already been
+				// reported
+				continue
+			}
+
+			e.to, e.resolved = n, true
+		}
+
+		if !hasConnector(nodeInputs(e.to.linker.Node()), e.input) {
+			d.addError(e.path, fmt.Errorf("unknown input connector %q", e.input))
+		}
+
+		e.from.edges = append(e.from.edges, i)
+	}
+}
+
+// checkCycles reports every reference that closes a cycle.
+func (d *document) checkCycles() {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[*documentNode]int)
+
+	var visit func(n *documentNode)
+	visit = func(n *documentNode) {
+		state[n] = visiting
+
+		for _, i := range n.edges {
+			e := d.edges[i]
+			switch state[e.to] {
+			case visiting:
+				d.addError(e.path, fmt.Errorf("connection creates a cycle"))
+			case unvisited:
+				visit(e.to)
+			}
+		}
+
+		state[n] = visited
+	}
+
+	for _, n := range d.nodes {
+		if state[n] == unvisited {
+			visit(n)
+		}
+	}
+}
+
+func (d *document) addError(path string, err error) {
+	d.errs = append(d.errs, &ValidationError{Path: path, Err: err})
+}
+
+func (d *document) err() error {
+	switch len(d.errs) {
+	case 0:
+		return nil
+	case 1:
+		return d.errs[0]
+	default:
+		return d.errs
+	}
+}
+
+// newNodeLinker constructs the linker of a node, deferring the construction
+// to process time if the options contain expressions, unless the node
+// evaluates them itself. The factory is not called for deferred nodes, so
+// that it never sees the unevaluated expressions.
+func newNodeLinker(name string, options json.RawMessage, factory LinkerFactory) (graph.Linker, error) {
+	if !evaluatesExpressions(name) {
+		deferred, ok, err := newDeferredLinker(name, options, factory)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return deferred, nil
+		}
+	}
+
+	return factory(options)
+}
+
+func decodeNode(raw json.RawMessage, n *jsonNode) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+
+	return dec.Decode(n)
+}
+
+func nodeOutputs(n graph.Node) []graph.ConnectorName {
+	outputs := []graph.ConnectorName{graph.OutputName}
+	if named, ok := n.(NamedOutputs); ok {
+		outputs = append(outputs, named.NamedOutputs()...)
+	}
+
+	return outputs
+}
+
+func nodeInputs(n graph.Node) []graph.ConnectorName {
+	if named, ok := n.(NamedInputs); ok {
+		return named.NamedInputs()
+	}
+
+	return []graph.ConnectorName{graph.InputName}
+}
+
+// splitNodes returns the raw nodes of a definition that is either a single
+// node, or an array of nodes.
+func splitNodes(b []byte) ([]json.RawMessage, error) {
+	b = bytes.TrimSpace(b)
+
+	var nodes []json.RawMessage
+	if len(b) > 0 && b[0] == '[' {
+		if err := json.Unmarshal(b, &nodes); err != nil {
+			return nil, err
+		}
+	} else {
+		var node json.RawMessage
+		if err := json.Unmarshal(b, &node); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+func hasConnector(connectors []graph.ConnectorName, c graph.ConnectorName) bool {
+	for _, n := range connectors {
+		if n == c {
+			return true
+		}
+	}
+
+	return false
+}
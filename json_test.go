@@ -0,0 +1,209 @@
+package drawgl_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/operation/tests"
+	"github.com/urandom/graph"
+	"github.com/urandom/graph/base"
+)
+
+// compositeNode is a node with two named inputs, which passes the background
+// through
+type compositeNode struct {
+	base.Node
+}
+
+func (n compositeNode) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+	res := drawgl.Result{Id: n.Id(), Buffer: buffers["Background"].Buffer}
+	if buffers["Foreground"].Buffer == nil || res.Buffer == nil {
+		res.Error = errors.New("missing input")
+	}
+
+	output <- res
+
+	wd.Close()
+}
+
+func (n compositeNode) NamedInputs() []graph.ConnectorName {
+	return []graph.ConnectorName{"Background", "Foreground"}
+}
+
+func (n compositeNode) Definition() (string, interface{}) {
+	return "testComposite", nil
+}
+
+func init() {
+	drawgl.RegisterLinker("testComposite", func(opts json.RawMessage) (graph.Linker, error) {
+		return base.NewLinkerNode(compositeNode{Node: base.NewNode()}), nil
+	})
+}
+
+func TestProcessJSONReferences(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.png")
+	def := fmt.Sprintf(`{
+		"Name": "Load",
+		"Options": {"Path": %q},
+		"Outputs": {
+			"Output": [{
+				"Name": "BoxBlur",
+				"Options": {"Radius": 1},
+				"Outputs": {
+					"Output": {"Ref": "comp", "To": "Foreground"}
+				}
+			}, {
+				"Id": "comp",
+				"Name": "testComposite",
+				"To": "Background",
+				"Outputs": {
+					"Output": {"Name": "Save", "Options": {"Path": %q}}
+				}
+			}]
+		}
+	}`, tests.TestDataDir()+"/test.png", out)
+
+	roots, err := drawgl.ProcessJSON(strings.NewReader(def), nil)
+	if err != nil {
+		t.Fatalf("Error reading graph: %v\n", err)
+	}
+
+	if len(roots) != 1 {
+		t.Fatalf("Expected 1 root, got %d\n", len(roots))
+	}
+
+	g := drawgl.Graph{}
+	if err := g.Process(roots[0]); err != nil {
+		t.Fatalf("Error processing graph: %v\n", err)
+	}
+
+	b, err := drawgl.MarshalGraph(roots[0])
+	if err != nil {
+		t.Fatalf("Error encoding graph: %v\n", err)
+	}
+
+	for _, s := range []string{`"Id": "node1"`, `"Ref": "node1"`, `"To": "Foreground"`, `"To": "Background"`} {
+		if !strings.Contains(string(b), s) {
+			t.Fatalf("Expected %s in\n%s\n", s, b)
+		}
+	}
+
+	if _, err := drawgl.ProcessJSON(strings.NewReader(string(b)), nil); err != nil {
+		t.Fatalf("Error reading encoded graph: %v\n%s\n", err, b)
+	}
+}
+
+func TestProcessJSONSharedNode(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.png")
+	def := fmt.Sprintf(`[{
+		"Name": "Load",
+		"Options": {"Path": %[1]q},
+		"Outputs": {
+			"Output": {
+				"Id": "comp",
+				"Name": "testComposite",
+				"To": "Background",
+				"Outputs": {
+					"Output": {"Name": "Save", "Options": {"Path": %[2]q}}
+				}
+			}
+		}
+	}, {
+		"Name": "Load",
+		"Options": {"Path": %[1]q},
+		"Outputs": {
+			"Output": {"Ref": "comp", "To": "Foreground"}
+		}
+	}]`, tests.TestDataDir()+"/test.png", out)
+
+	roots, err := drawgl.ProcessJSON(strings.NewReader(def), nil)
+	if err != nil {
+		t.Fatalf("Error reading graph: %v\n", err)
+	}
+
+	if len(roots) != 2 {
+		t.Fatalf("Expected 2 roots, got %d\n", len(roots))
+	}
+
+	var mu sync.Mutex
+	started := map[string]int{}
+
+	g := drawgl.Graph{Observer: func(e drawgl.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if e.Kind == drawgl.NodeStarted {
+			started[e.Name]++
+		}
+	}}
+
+	for i, err := range g.ProcessRoots(context.Background(), roots...) {
+		if err != nil {
+			t.Fatalf("Error processing root %d: %v\n", i, err)
+		}
+	}
+
+	// The composite and everything after it are processed once, with both
+	// inputs
+	if started["Load"] != 2 || started["testComposite"] != 1 || started["Save"] != 1 {
+		t.Fatalf("Unexpected processed nodes %v\n", started)
+	}
+
+	if _, err := os.Stat(out); err != nil {
+		t.Fatalf("Expected the composite to be saved: %v\n", err)
+	}
+}
+
+func TestProcessJSONReferenceErrors(t *testing.T) {
+	def := `[{
+		"Id": "a",
+		"Name": "BoxBlur",
+		"Outputs": {
+			"Output": {
+				"Id": "b",
+				"Name": "BoxBlur",
+				"Outputs": {
+					"Output": [{"Ref": "a"}, {"Ref": "missing"}, {"Ref": "c", "To": "Mask"}]
+				}
+			}
+		}
+	}, {
+		"Id": "a",
+		"Name": "testComposite",
+		"Outputs": {
+			"Output": {"Id": "c", "Name": "testComposite", "To": "Background"}
+		}
+	}]`
+
+	_, err := drawgl.ProcessJSON(strings.NewReader(def), nil)
+
+	var errs drawgl.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected multiple errors, got %v\n", err)
+	}
+
+	expected := []string{
+		"duplicate node id",
+		"unknown node id",
+		"unknown input connector",
+		"cycle",
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d: %v\n", len(expected), len(errs), err)
+	}
+
+	for i := range expected {
+		if !strings.Contains(errs[i].Error(), expected[i]) {
+			t.Fatalf("Expected error %d to mention %q, got %v\n", i, expected[i], errs[i])
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package drawgl
 
 import (
+	"encoding/json"
 	"errors"
 	"image"
 	"image/draw"
@@ -14,13 +15,6 @@ type Mask struct {
 	hasRect  bool
 }
 
-type EdgeHandler int
-
-const (
-	Extend EdgeHandler = iota
-	Wrap
-)
-
 var (
 	ErrOutOfBounds = errors.New("out of bounds")
 )
@@ -30,6 +24,36 @@ func NewMask(image image.Image, rect image.Rectangle) Mask {
 
 }
 
+// MarshalJSON encodes the mask's rectangle. An empty mask is encoded as null,
+// while a mask with an image cannot be encoded.
+func (m Mask) MarshalJSON() ([]byte, error) {
+	if m.Image != nil {
+		return nil, errors.New("a mask image cannot be encoded as json")
+	}
+
+	if m.Rect.Empty() {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(struct{ Rect image.Rectangle }{m.Rect})
+}
+
+func (m *Mask) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*m = Mask{}
+		return nil
+	}
+
+	var o struct{ Rect image.Rectangle }
+	if err := json.Unmarshal(b, &o); err != nil {
+		return err
+	}
+
+	*m = NewMask(nil, o.Rect)
+
+	return nil
+}
+
 func MaskFactor(pt image.Point, mask Mask) (factor float32) {
 	if mask.hasRect && !pt.In(mask.Rect) {
 		return 0
@@ -44,6 +68,9 @@ func MaskFactor(pt image.Point, mask Mask) (factor float32) {
 	return 1
 }
 
+// MaskColor combines the channels c of the src color into dst, weighed by
+// the mask factor f. With draw.Over, dst and src are interpolated, which
+// keeps premultiplied colors premultiplied, while draw.Src scales src by f.
 func MaskColor(dst FloatColor, src FloatColor, c Channel, f float32, op draw.Op) FloatColor {
 	fv := ColorValue(f)
 	switch op {
@@ -65,16 +92,16 @@ func MaskColor(dst FloatColor, src FloatColor, c Channel, f float32, op draw.Op)
 			}
 		default:
 			if c.Is(Red) {
-				dst.R = dst.R/fv + src.R*fv
+				dst.R = dst.R*(1-fv) + src.R*fv
 			}
 			if c.Is(Green) {
-				dst.G = dst.G/fv + src.G*fv
+				dst.G = dst.G*(1-fv) + src.G*fv
 			}
 			if c.Is(Blue) {
-				dst.B = dst.B/fv + src.B*fv
+				dst.B = dst.B*(1-fv) + src.B*fv
 			}
 			if c.Is(Alpha) {
-				dst.A = dst.A/fv + src.A*fv
+				dst.A = dst.A*(1-fv) + src.A*fv
 			}
 		}
 	case draw.Src:
@@ -123,36 +150,3 @@ func MaskColor(dst FloatColor, src FloatColor, c Channel, f float32, op draw.Op)
 
 	return dst
 }
-
-func TranslateCoords(x, y int, b image.Rectangle, h EdgeHandler) (mx, my int) {
-	mx, my = x, y
-
-	switch h {
-	case Wrap:
-		if mx < b.Min.X {
-			mx = b.Max.X - b.Min.X + mx
-		} else if mx >= b.Max.X {
-			mx = b.Min.X - b.Max.X + mx
-		}
-
-		if my < b.Min.Y {
-			my = b.Max.Y - b.Min.Y + my
-		} else if my >= b.Max.Y {
-			my = b.Min.Y - b.Max.Y + my
-		}
-	case Extend:
-		if mx < b.Min.X {
-			mx = b.Min.X
-		} else if mx >= b.Max.X {
-			mx = b.Max.X - 1
-		}
-
-		if my < b.Min.Y {
-			my = b.Min.Y
-		} else if my >= b.Max.Y {
-			my = b.Max.Y - 1
-		}
-	}
-
-	return
-}
@@ -1,7 +1,10 @@
 package operation
 
 import (
+	_ "github.com/urandom/drawgl/operation/color"
 	_ "github.com/urandom/drawgl/operation/convolution"
+	_ "github.com/urandom/drawgl/operation/flow"
+	_ "github.com/urandom/drawgl/operation/group"
 	_ "github.com/urandom/drawgl/operation/io"
 	_ "github.com/urandom/drawgl/operation/transform"
 )
@@ -0,0 +1,134 @@
+package color
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/graph"
+	"github.com/urandom/graph/base"
+)
+
+// ColorSpace converts the image into another color space. Transfer
+// functions are applied to straight colors, so premultiplied images are
+// unpremultiplied for the conversion, and keep their alpha mode.
+type ColorSpace struct {
+	base.Node
+
+	opts ColorSpaceOptions
+}
+
+type ColorSpaceOptions struct {
+	// Space is the color space of the output
+	Space drawgl.ColorSpace
+	// Assign only tags the image with the color space, leaving its values
+	// intact, for images whose values are known to be in that space
+	Assign bool
+}
+
+func NewColorSpaceLinker(opts ColorSpaceOptions) (graph.Linker, error) {
+	if !opts.Space.Valid() {
+		return nil, errors.New("unknown color space")
+	}
+
+	return base.NewLinkerNode(ColorSpace{
+		Node: base.NewNode(),
+		opts: opts,
+	}), nil
+}
+
+func (n ColorSpace) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+	var err error
+	var buf *drawgl.FloatImage
+	res := drawgl.Result{Id: n.Id()}
+
+	defer func() {
+		res.Buffer = buf
+		if err != nil {
+			res.Error = fmt.Errorf("applying color space using %v: %v", n.opts, err)
+		}
+		output <- res
+
+		wd.Close()
+	}()
+
+	r := buffers[graph.InputName]
+	src := r.Buffer
+	res.Meta = r.Meta
+	if src == nil {
+		err = fmt.Errorf("no input buffer")
+		return
+	}
+
+	// The input is not shared with other nodes, as the node works in place
+	buf = src
+	if n.opts.Assign {
+		buf.ColorSpace = n.opts.Space
+	} else {
+		drawgl.ConvertColorSpaceInPlace(buf, n.opts.Space)
+	}
+}
+
+// InPlace reports that the node converts the values of its input buffer.
+func (n ColorSpace) InPlace() bool {
+	return true
+}
+
+func (n ColorSpace) Hash() string {
+	return drawgl.HashOptions("ColorSpace", n.opts)
+}
+
+func (n ColorSpace) TileBounds(src image.Rectangle) image.Rectangle {
+	return src
+}
+
+func (n ColorSpace) TileSource(dst, src image.Rectangle) image.Rectangle {
+	return dst
+}
+
+func (n ColorSpace) ProcessTile(ctx context.Context, src *drawgl.FloatImage, b, rect image.Rectangle) (*drawgl.FloatImage, error) {
+	return n.convert(drawgl.CropImage(src, rect)), nil
+}
+
+// convert returns a copy of the image in the color space of the options.
+func (n ColorSpace) convert(src *drawgl.FloatImage) *drawgl.FloatImage {
+	if n.opts.Assign || src.ColorSpace == n.opts.Space {
+		buf := drawgl.CopyImage(src)
+		buf.ColorSpace = n.opts.Space
+
+		return buf
+	}
+
+	return drawgl.ConvertColorSpace(src, n.opts.Space)
+}
+
+func (n ColorSpace) Definition() (string, interface{}) {
+	return "ColorSpace", n.opts
+}
+
+var colorSpaceDescriptor = drawgl.Descriptor{
+	Name: "ColorSpace",
+	Doc: `Converts the image into a color space.
+Images are loaded in linear light, in which operations expect them.`,
+	Inputs:  []drawgl.ConnectorDescriptor{drawgl.MainInput()},
+	Outputs: []drawgl.ConnectorDescriptor{drawgl.MainOutput()},
+	Options: []drawgl.OptionDescriptor{
+		{Name: "Space", Type: drawgl.StringOption, Required: true, Enum: drawgl.ColorSpaceNames, Doc: "the color space of the output"},
+		{Name: "Assign", Type: drawgl.BooleanOption, Default: false, Doc: "only tag the image with the color space, keeping its values"},
+	},
+}
+
+func init() {
+	drawgl.RegisterOperation(colorSpaceDescriptor, func(opts json.RawMessage) (graph.Linker, error) {
+		var o ColorSpaceOptions
+
+		if err := drawgl.UnmarshalOptions(opts, &o); err != nil {
+			return nil, fmt.Errorf("constructing ColorSpace: %v", err)
+		}
+
+		return NewColorSpaceLinker(o)
+	})
+}
@@ -0,0 +1,75 @@
+package color_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/operation/color"
+	"github.com/urandom/drawgl/operation/tests"
+	"github.com/urandom/graph"
+)
+
+func TestColorSpace(t *testing.T) {
+	if _, err := color.NewColorSpaceLinker(color.ColorSpaceOptions{Space: drawgl.ColorSpace(42)}); err == nil {
+		t.Fatalf("Expected an error\n")
+	}
+
+	for _, opts := range []color.ColorSpaceOptions{
+		{Space: drawgl.LinearSRGB},
+		{Space: drawgl.DisplayP3, Assign: true},
+	} {
+		l, err := color.NewColorSpaceLinker(opts)
+		if err != nil {
+			t.Fatalf("Error creating a color space linker: %v\n", err)
+		}
+
+		// The test data is sRGB encoded
+		buffers := tests.ImageBuffers(t)
+		p, wd, output := tests.PrepareLinker(l)
+
+		go p.Process(context.Background(), wd, buffers, output)
+
+		r := <-output
+		if r.Error != nil {
+			t.Fatalf("Error processing: %v\n", r.Error)
+		}
+
+		if r.Buffer.ColorSpace != opts.Space {
+			t.Fatalf("Expected %s, got %s\n", opts.Space, r.Buffer.ColorSpace)
+		}
+
+		exp := tests.Colors()
+		b := r.Buffer.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				e := exp[y][x]
+				if !opts.Assign {
+					e = drawgl.ConvertColor(e, drawgl.SRGB, opts.Space)
+				}
+
+				if c := r.Buffer.FloatAt(x, y); !c.ApproxEqual(e) {
+					t.Fatalf("%v: at %d:%d, color %v doesn't match %v\n", opts, x, y, c, e)
+				}
+			}
+		}
+	}
+}
+
+func TestColorSpaceTransparent(t *testing.T) {
+	var cases []tests.TransparentCase
+	for _, space := range []drawgl.ColorSpace{drawgl.SRGB, drawgl.DisplayP3, drawgl.Rec2020} {
+		space := space
+		cases = append(cases, tests.TransparentCase{
+			Name: space.String(),
+			Linker: func() (graph.Linker, error) {
+				return color.NewColorSpaceLinker(color.ColorSpaceOptions{Space: space})
+			},
+			// Only the colors are converted
+			Straight: tests.SameAlpha,
+		})
+	}
+
+	// White stays white in every space
+	tests.CheckTransparent(t, cases)
+}
@@ -0,0 +1,36 @@
+package convolution_test
+
+import (
+	"image"
+	"testing"
+
+	"github.com/urandom/drawgl/operation/convolution"
+	"github.com/urandom/drawgl/operation/tests"
+	"github.com/urandom/graph"
+)
+
+func TestTransparent(t *testing.T) {
+	k, err := convolution.NewKernel([]float32{1, 2, 1, 2, 4, 2, 1, 2, 1})
+	if err != nil {
+		t.Fatalf("Error creating a kernel: %v\n", err)
+	}
+
+	mask := tests.HalfMask(image.Rect(4, 4, 28, 28))
+
+	// The filters weigh the colors by their alpha, while leaving the alpha
+	// of straight images intact when it isn't filtered
+	tests.CheckTransparent(t, []tests.TransparentCase{
+		{Name: "BoxBlur", Straight: tests.SameAlpha, Linker: func() (graph.Linker, error) {
+			return convolution.NewBoxBlurLinker(convolution.BoxBlurOptions{Radius: 3})
+		}},
+		{Name: "masked BoxBlur", Straight: tests.SameAlpha, Linker: func() (graph.Linker, error) {
+			return convolution.NewBoxBlurLinker(convolution.BoxBlurOptions{Radius: 3, Mask: mask})
+		}},
+		{Name: "Convolution", Straight: tests.SameAlpha, Linker: func() (graph.Linker, error) {
+			return convolution.NewConvolutionLinker(convolution.ConvolutionOptions{Kernel: k, Normalize: true})
+		}},
+		{Name: "masked Convolution", Straight: tests.SameAlpha, Linker: func() (graph.Linker, error) {
+			return convolution.NewConvolutionLinker(convolution.ConvolutionOptions{Kernel: k, Normalize: true, Mask: mask})
+		}},
+	})
+}
@@ -1,6 +1,7 @@
 package convolution
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,6 +13,9 @@ import (
 	"github.com/urandom/graph/base"
 )
 
+// BoxBlur averages every pixel with its neighbors within the radius.
+// Averaging happens on premultiplied colors, so that transparent pixels
+// don't darken their surroundings; straight images are converted back after.
 type BoxBlur struct {
 	base.Node
 	opts BoxBlurOptions
@@ -22,6 +26,8 @@ type BoxBlurOptions struct {
 	Channel drawgl.Channel
 	Mask    drawgl.Mask
 	Linear  bool
+	// Edge determines the colors beyond the sides of the image
+	Edge drawgl.EdgeHandler
 }
 
 func NewBoxBlurLinker(opts BoxBlurOptions) (graph.Linker, error) {
@@ -38,7 +44,7 @@ func NewBoxBlurLinker(opts BoxBlurOptions) (graph.Linker, error) {
 	}), nil
 }
 
-func (n BoxBlur) Process(wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+func (n BoxBlur) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
 	var err error
 	var buf *drawgl.FloatImage
 	res := drawgl.Result{Id: n.Id()}
@@ -54,97 +60,165 @@ func (n BoxBlur) Process(wd graph.WalkData, buffers map[graph.ConnectorName]draw
 	}()
 
 	r := buffers[graph.InputName]
-	buf = r.Buffer
+	src := r.Buffer
 	res.Meta = r.Meta
-	if buf == nil {
+	if src == nil {
 		err = fmt.Errorf("no input buffer")
 		return
 	}
 
-	coeff := 1 / drawgl.ColorValue(2*n.opts.Radius+1)
+	buf, err = n.ProcessTile(ctx, src, src.Bounds(), src.Bounds())
+}
 
-	src := drawgl.CopyImage(buf)
-	b := buf.Bounds()
+func (n BoxBlur) TileBounds(src image.Rectangle) image.Rectangle {
+	return src
+}
 
-	it := drawgl.DefaultRectangleIterator(b, n.opts.Linear)
+// TileSource pads the tile by the blur radius, or requires the whole input
+// if the edge handler might read any of it.
+func (n BoxBlur) TileSource(dst, src image.Rectangle) image.Rectangle {
+	if n.opts.Edge.Whole() {
+		return src
+	}
 
-	edgeHandler := drawgl.Extend
+	return dst.Inset(-n.opts.Radius)
+}
 
-	it.Iterate(n.opts.Mask, func(pt image.Point, f float32) {
-		if f == 0 {
-			return
-		}
+func (n BoxBlur) ProcessTile(ctx context.Context, src *drawgl.FloatImage, b, rect image.Rectangle) (*drawgl.FloatImage, error) {
+	// Blurring straight colors bleeds the color of transparent pixels
+	buf, err := n.blur(ctx, drawgl.ConvertAlpha(src, drawgl.Premultiplied), b, rect)
+	if err != nil {
+		return nil, err
+	}
 
-		var center, acc drawgl.FloatColor
-		if pt.X == b.Min.X {
-			for cx := pt.X - n.opts.Radius; cx <= pt.X+n.opts.Radius; cx++ {
-				mx, _ := drawgl.TranslateCoords(cx, pt.Y, b, edgeHandler)
+	return drawgl.ConvertAlpha(buf, src.Alpha), nil
+}
 
-				c := src.UnsafeFloatAt(mx, pt.Y)
-				if mx == pt.X {
-					center = c
-				}
+func (n BoxBlur) blur(ctx context.Context, src *drawgl.FloatImage, b, rect image.Rectangle) (buf *drawgl.FloatImage, err error) {
+	coeff := 1 / drawgl.ColorValue(2*n.opts.Radius+1)
 
-				acc = ColorAccumulator(acc, c, drawgl.FloatColor{}, coeff, n.opts.Channel)
+	// The alpha is always blurred, so that the colors can be weighed by it
+	// if the alpha channel is to be left intact
+	channel := n.opts.Channel | drawgl.Alpha
+	orig := src
+
+	// The horizontal pass has to cover the rows required by the vertical one
+	hrect := image.Rect(rect.Min.X, rect.Min.Y-n.opts.Radius, rect.Max.X, rect.Max.Y+n.opts.Radius).Intersect(b)
+	buf = drawgl.CropImage(src, hrect)
+
+	it := drawgl.DefaultRectangleIterator(hrect, n.opts.Linear)
+
+	edge := n.opts.Edge
+
+	err = it.IterateSpans(ctx, buf, n.opts.Mask, func(s drawgl.Span) {
+		for i, x := 0, s.Min; x < s.Max; i, x = i+1, x+1 {
+			f := s.Factor(i)
+			if f == 0 {
+				continue
 			}
-		} else {
-			center = src.UnsafeFloatAt(pt.X, pt.Y)
-			prev := buf.UnsafeFloatAt(pt.X-1, pt.Y)
 
-			mx, _ := drawgl.TranslateCoords(pt.X-n.opts.Radius-1, pt.Y, b, edgeHandler)
-			leftmost := src.UnsafeFloatAt(mx, pt.Y)
+			center := src.UnsafeFloatAt(x, s.Y)
 
-			mx, _ = drawgl.TranslateCoords(pt.X+n.opts.Radius, pt.Y, b, edgeHandler)
-			rightmost := src.UnsafeFloatAt(mx, pt.Y)
+			var acc drawgl.FloatColor
+			if x == hrect.Min.X {
+				for cx := x - n.opts.Radius; cx <= x+n.opts.Radius; cx++ {
+					c := drawgl.EdgeColor(src, cx, s.Y, b, edge)
+					acc = ColorAccumulator(acc, c, drawgl.FloatColor{}, coeff, channel)
+				}
+			} else {
+				prev := s.At(i - 1)
+				leftmost := drawgl.EdgeColor(src, x-n.opts.Radius-1, s.Y, b, edge)
+				rightmost := drawgl.EdgeColor(src, x+n.opts.Radius, s.Y, b, edge)
 
-			acc = ColorAccumulator(prev, rightmost, leftmost, coeff, n.opts.Channel)
-		}
+				acc = ColorAccumulator(prev, rightmost, leftmost, coeff, channel)
+			}
 
-		buf.UnsafeSetColor(pt.X, pt.Y,
-			drawgl.MaskColor(center, acc, n.opts.Channel, f, draw.Over))
+			s.Set(i, drawgl.MaskColor(center, acc, channel, f, draw.Over))
+		}
 	})
 
-	src = drawgl.CopyImage(buf)
-	it.VerticalIterate(n.opts.Mask, func(pt image.Point, f float32) {
-		if f == 0 {
-			return
-		}
+	if err != nil {
+		return
+	}
+
+	src = buf
+	buf = drawgl.CropImage(src, rect)
+	it = drawgl.DefaultRectangleIterator(rect, n.opts.Linear)
 
-		var center, acc drawgl.FloatColor
-		if pt.Y == b.Min.Y {
-			for cy := pt.Y - n.opts.Radius; cy <= pt.Y+n.opts.Radius; cy++ {
-				_, my := drawgl.TranslateCoords(pt.X, cy, b, edgeHandler)
+	// The vertical pass keeps running sums from the previous row, which has
+	// to be computed by the same goroutine
+	err = it.IterateSpanWorkers(ctx, buf, n.opts.Mask, func() func(s drawgl.Span) {
+		var last int
 
-				c := src.UnsafeFloatAt(pt.X, my)
-				if my == pt.Y {
-					center = c
+		return func(s drawgl.Span) {
+			first := s.Y == rect.Min.Y || s.Y != last+1
+			last = s.Y
+
+			for i, x := 0, s.Min; x < s.Max; i, x = i+1, x+1 {
+				f := s.Factor(i)
+				if f == 0 {
+					continue
 				}
 
-				acc = ColorAccumulator(acc, c, drawgl.FloatColor{}, coeff, n.opts.Channel)
-			}
-		} else {
-			center = src.UnsafeFloatAt(pt.X, pt.Y)
-			prev := buf.UnsafeFloatAt(pt.X, pt.Y-1)
+				center := src.UnsafeFloatAt(x, s.Y)
 
-			_, my := drawgl.TranslateCoords(pt.X, pt.Y-n.opts.Radius-1, b, edgeHandler)
-			leftmost := src.UnsafeFloatAt(pt.X, my)
+				var acc drawgl.FloatColor
+				if first {
+					for cy := s.Y - n.opts.Radius; cy <= s.Y+n.opts.Radius; cy++ {
+						c := drawgl.EdgeColor(src, x, cy, b, edge)
+						acc = ColorAccumulator(acc, c, drawgl.FloatColor{}, coeff, channel)
+					}
+				} else {
+					prev := buf.UnsafeFloatAt(x, s.Y-1)
+					topmost := drawgl.EdgeColor(src, x, s.Y-n.opts.Radius-1, b, edge)
+					bottommost := drawgl.EdgeColor(src, x, s.Y+n.opts.Radius, b, edge)
 
-			_, my = drawgl.TranslateCoords(pt.X, pt.Y+n.opts.Radius, b, edgeHandler)
-			rightmost := src.UnsafeFloatAt(pt.X, my)
+					acc = ColorAccumulator(prev, bottommost, topmost, coeff, channel)
+				}
 
-			acc = ColorAccumulator(prev, rightmost, leftmost, coeff, n.opts.Channel)
+				s.Set(i, drawgl.MaskColor(center, acc, channel, f, draw.Over))
+			}
 		}
+	})
 
-		buf.UnsafeSetColor(pt.X, pt.Y,
-			drawgl.MaskColor(center, acc, n.opts.Channel, f, draw.Over))
+	if err != nil || n.opts.Channel.Is(drawgl.Alpha) {
+		return
+	}
+
+	err = it.IterateSpans(ctx, buf, drawgl.Mask{}, func(s drawgl.Span) {
+		for i, x := 0, s.Min; x < s.Max; i, x = i+1, x+1 {
+			c := s.At(i)
+			s.Set(i, keepAlpha(c, n.opts.Channel, c.A, orig.UnsafeFloatAt(x, s.Y).A))
+		}
 	})
+
+	return
+}
+
+func (n BoxBlur) Hash() string {
+	return drawgl.HashOptions("BoxBlur", n.opts)
+}
+
+func (n BoxBlur) Definition() (string, interface{}) {
+	return "BoxBlur", n.opts
+}
+
+var boxBlurDescriptor = drawgl.Descriptor{
+	Name:    "BoxBlur",
+	Doc:     "Blurs the image by averaging the pixels within a box around each pixel.",
+	Inputs:  []drawgl.ConnectorDescriptor{drawgl.MainInput()},
+	Outputs: []drawgl.ConnectorDescriptor{drawgl.MainOutput()},
+	Options: append([]drawgl.OptionDescriptor{
+		{Name: "Radius", Type: drawgl.IntegerOption, Default: 4, Doc: "the distance from the center of the box to its edges"},
+		drawgl.EdgeOption(),
+	}, drawgl.CommonOptions()...),
 }
 
 func init() {
-	graph.RegisterLinker("BoxBlur", func(opts json.RawMessage) (graph.Linker, error) {
+	drawgl.RegisterOperation(boxBlurDescriptor, func(opts json.RawMessage) (graph.Linker, error) {
 		var o BoxBlurOptions
 
-		if err := json.Unmarshal([]byte(opts), &o); err != nil {
+		if err := drawgl.UnmarshalOptions(opts, &o); err != nil {
 			return nil, fmt.Errorf("constructing BoxBlur: %v", err)
 		}
 
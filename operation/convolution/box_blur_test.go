@@ -1,6 +1,9 @@
 package convolution_test
 
 import (
+	"context"
+	"image"
+	"image/draw"
 	"testing"
 
 	"github.com/urandom/drawgl"
@@ -22,7 +25,7 @@ func TestBoxBlur(t *testing.T) {
 	buffers := tests.ImageBuffers(t)
 	p, wd, output := tests.PrepareLinker(l)
 
-	go p.Process(wd, buffers, output)
+	go p.Process(context.Background(), wd, buffers, output)
 
 	r := <-output
 	if r.Error != nil {
@@ -41,6 +44,26 @@ func TestBoxBlur(t *testing.T) {
 	}
 }
 
+func TestBoxBlurCancelled(t *testing.T) {
+	l, err := convolution.NewBoxBlurLinker(convolution.BoxBlurOptions{})
+	if err != nil {
+		t.Fatalf("Error creating a convolution linker: %v\n", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	buffers := tests.ImageBuffers(t)
+	p, wd, output := tests.PrepareLinker(l)
+
+	go p.Process(ctx, wd, buffers, output)
+
+	r := <-output
+	if r.Error == nil {
+		t.Fatalf("Expected an error\n")
+	}
+}
+
 func expectedBoxBlurResult1() (c [4][4]drawgl.FloatColor) {
 	c = [4][4]drawgl.FloatColor{
 		[4]drawgl.FloatColor{
@@ -71,3 +94,91 @@ func expectedBoxBlurResult1() (c [4][4]drawgl.FloatColor) {
 
 	return
 }
+
+func BenchmarkBoxBlur(b *testing.B) {
+	l, err := convolution.NewBoxBlurLinker(convolution.BoxBlurOptions{Radius: 5, Channel: allChannels})
+	if err != nil {
+		b.Fatalf("Error creating a box blur linker: %v\n", err)
+	}
+
+	tests.BenchmarkTiles(b, l, tests.PatternImage(512, 512))
+}
+
+func BenchmarkBoxBlurIterate(b *testing.B) {
+	l, err := convolution.NewBoxBlurLinker(convolution.BoxBlurOptions{Radius: 5, Channel: allChannels})
+	if err != nil {
+		b.Fatalf("Error creating a box blur linker: %v\n", err)
+	}
+
+	tests.BenchmarkIterate(b, l, tests.PatternImage(512, 512), func(ctx context.Context, src *drawgl.FloatImage) (*drawgl.FloatImage, error) {
+		return boxBlurIterate(ctx, src, 5)
+	})
+}
+
+// boxBlurIterate blurs all channels of the image like BoxBlur does, one
+// pixel at a time, with the iterators that preceded the span ones.
+func boxBlurIterate(ctx context.Context, img *drawgl.FloatImage, radius int) (*drawgl.FloatImage, error) {
+	src := drawgl.ConvertAlpha(img, drawgl.Premultiplied)
+	b := src.Bounds()
+	coeff := 1 / drawgl.ColorValue(2*radius+1)
+
+	buf := drawgl.CropImage(src, b)
+	it := drawgl.DefaultRectangleIterator(b)
+
+	err := it.Iterate(ctx, drawgl.Mask{}, func(pt image.Point, f float32) {
+		if f == 0 {
+			return
+		}
+
+		var acc drawgl.FloatColor
+		if pt.X == b.Min.X {
+			for cx := pt.X - radius; cx <= pt.X+radius; cx++ {
+				c := drawgl.EdgeColor(src, cx, pt.Y, b, drawgl.Extend)
+				acc = convolution.ColorAccumulator(acc, c, drawgl.FloatColor{}, coeff, allChannels)
+			}
+		} else {
+			prev := buf.UnsafeFloatAt(pt.X-1, pt.Y)
+			leftmost := drawgl.EdgeColor(src, pt.X-radius-1, pt.Y, b, drawgl.Extend)
+			rightmost := drawgl.EdgeColor(src, pt.X+radius, pt.Y, b, drawgl.Extend)
+
+			acc = convolution.ColorAccumulator(prev, rightmost, leftmost, coeff, allChannels)
+		}
+
+		buf.UnsafeSetColor(pt.X, pt.Y,
+			drawgl.MaskColor(src.UnsafeFloatAt(pt.X, pt.Y), acc, allChannels, f, draw.Over))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	src = buf
+	buf = drawgl.CropImage(src, b)
+
+	err = it.VerticalIterate(ctx, drawgl.Mask{}, func(pt image.Point, f float32) {
+		if f == 0 {
+			return
+		}
+
+		var acc drawgl.FloatColor
+		if pt.Y == b.Min.Y {
+			for cy := pt.Y - radius; cy <= pt.Y+radius; cy++ {
+				c := drawgl.EdgeColor(src, pt.X, cy, b, drawgl.Extend)
+				acc = convolution.ColorAccumulator(acc, c, drawgl.FloatColor{}, coeff, allChannels)
+			}
+		} else {
+			prev := buf.UnsafeFloatAt(pt.X, pt.Y-1)
+			topmost := drawgl.EdgeColor(src, pt.X, pt.Y-radius-1, b, drawgl.Extend)
+			bottommost := drawgl.EdgeColor(src, pt.X, pt.Y+radius, b, drawgl.Extend)
+
+			acc = convolution.ColorAccumulator(prev, bottommost, topmost, coeff, allChannels)
+		}
+
+		buf.UnsafeSetColor(pt.X, pt.Y,
+			drawgl.MaskColor(src.UnsafeFloatAt(pt.X, pt.Y), acc, allChannels, f, draw.Over))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return drawgl.ConvertAlpha(buf, img.Alpha), nil
+}
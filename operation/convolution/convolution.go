@@ -1,6 +1,7 @@
 package convolution
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,6 +14,9 @@ import (
 	"github.com/urandom/graph/base"
 )
 
+// Convolution applies a kernel to the neighborhood of every pixel. The
+// kernel operates on premultiplied colors; images with straight alpha are
+// premultiplied first, and the result converted back.
 type Convolution struct {
 	base.Node
 	opts ConvolutionOptions
@@ -24,6 +28,8 @@ type ConvolutionOptions struct {
 	Normalize bool
 	Mask      drawgl.Mask
 	Linear    bool
+	// Edge determines the colors beyond the sides of the image
+	Edge drawgl.EdgeHandler
 }
 
 func NewConvolutionLinker(opts ConvolutionOptions) (graph.Linker, error) {
@@ -36,7 +42,25 @@ func NewConvolutionLinker(opts ConvolutionOptions) (graph.Linker, error) {
 	return base.NewLinkerNode(Convolution{Node: base.NewNode(), opts: opts}), nil
 }
 
-func (n Convolution) Process(wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+// MarshalJSON encodes the options in the form accepted by the Convolution
+// linker factory, with the kernel as a flat list of weights.
+func (o ConvolutionOptions) MarshalJSON() ([]byte, error) {
+	var weights []drawgl.ColorValue
+	if o.Kernel != nil {
+		weights = o.Kernel.Weights()
+	}
+
+	return json.Marshal(struct {
+		Kernel    []drawgl.ColorValue
+		Channel   drawgl.Channel
+		Normalize bool
+		Mask      drawgl.Mask
+		Linear    bool
+		Edge      drawgl.EdgeHandler
+	}{weights, o.Channel, o.Normalize, o.Mask, o.Linear, o.Edge})
+}
+
+func (n Convolution) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
 	var err error
 	var buf *drawgl.FloatImage
 	res := drawgl.Result{Id: n.Id()}
@@ -52,13 +76,43 @@ func (n Convolution) Process(wd graph.WalkData, buffers map[graph.ConnectorName]
 	}()
 
 	r := buffers[graph.InputName]
-	buf = r.Buffer
+	src := r.Buffer
 	res.Meta = r.Meta
-	if buf == nil {
+	if src == nil {
 		err = fmt.Errorf("no input buffer")
 		return
 	}
 
+	buf, err = n.ProcessTile(ctx, src, src.Bounds(), src.Bounds())
+}
+
+func (n Convolution) TileBounds(src image.Rectangle) image.Rectangle {
+	return src
+}
+
+// TileSource pads the tile by half the kernel size, or requires the whole
+// input if the edge handler might read any of it.
+func (n Convolution) TileSource(dst, src image.Rectangle) image.Rectangle {
+	if n.opts.Edge.Whole() {
+		return src
+	}
+
+	half := int(math.Sqrt(float64(len(n.opts.Kernel.Weights())))) / 2
+
+	return dst.Inset(-half)
+}
+
+func (n Convolution) ProcessTile(ctx context.Context, src *drawgl.FloatImage, b, rect image.Rectangle) (*drawgl.FloatImage, error) {
+	// The kernel is applied to premultiplied colors, like the other filters
+	buf, err := n.convolve(ctx, drawgl.ConvertAlpha(src, drawgl.Premultiplied), b, rect)
+	if err != nil {
+		return nil, err
+	}
+
+	return drawgl.ConvertAlpha(buf, src.Alpha), nil
+}
+
+func (n Convolution) convolve(ctx context.Context, src *drawgl.FloatImage, b, rect image.Rectangle) (buf *drawgl.FloatImage, err error) {
 	var weights []drawgl.ColorValue
 	var offset drawgl.ColorValue
 	if n.opts.Normalize {
@@ -67,45 +121,87 @@ func (n Convolution) Process(wd graph.WalkData, buffers map[graph.ConnectorName]
 		weights = n.opts.Kernel.Weights()
 	}
 
-	src := drawgl.CopyImage(buf)
-	b := buf.Bounds()
+	// Smoothing kernels average the colors weighed by their alpha when the
+	// alpha channel is left intact, as transparent pixels have no color
+	var total drawgl.ColorValue
+	for _, w := range weights {
+		total += w
+	}
+	weighed := !n.opts.Channel.Is(drawgl.Alpha) && total > 0
+
+	buf = drawgl.CropImage(src, rect)
 	l := len(weights)
 	size := int(math.Sqrt(float64(l)))
 	half := int(size / 2)
 
-	it := drawgl.DefaultRectangleIterator(b, n.opts.Linear)
+	it := drawgl.DefaultRectangleIterator(buf.Bounds(), n.opts.Linear)
 
-	it.Iterate(n.opts.Mask, func(pt image.Point, f float32) {
-		if f == 0 {
-			return
-		}
+	err = it.IterateSpans(ctx, buf, n.opts.Mask, func(s drawgl.Span) {
+		for i, x := 0, s.Min; x < s.Max; i, x = i+1, x+1 {
+			f := s.Factor(i)
+			if f == 0 {
+				continue
+			}
 
-		var center, acc drawgl.FloatColor
-		for cy := pt.Y - half; cy <= pt.Y+half; cy++ {
-			for cx := pt.X - half; cx <= pt.X+half; cx++ {
-				coeff := weights[l-((cy-pt.Y+half)*size+cx-pt.X+half)-1]
+			center := src.UnsafeFloatAt(x, s.Y)
 
-				mx, my := drawgl.TranslateCoords(cx, cy, b, drawgl.Extend)
+			var acc drawgl.FloatColor
+			var alpha drawgl.ColorValue
+			for cy := s.Y - half; cy <= s.Y+half; cy++ {
+				for cx := x - half; cx <= x+half; cx++ {
+					coeff := weights[l-((cy-s.Y+half)*size+cx-x+half)-1]
 
-				c := src.UnsafeFloatAt(mx, my)
-				if mx == pt.X && my == pt.Y {
-					center = c
+					c := drawgl.EdgeColor(src, cx, cy, b, n.opts.Edge)
+
+					acc = ColorAccumulator(acc, c, drawgl.FloatColor{}, coeff, n.opts.Channel)
+					alpha += coeff * c.A
 				}
+			}
 
-				acc = ColorAccumulator(acc, c, drawgl.FloatColor{}, coeff, n.opts.Channel)
+			if weighed {
+				acc = keepAlpha(acc, n.opts.Channel, alpha/total, center.A)
 			}
-		}
 
-		cs := drawgl.FloatColor{
-			R: acc.R + offset,
-			G: acc.G + offset,
-			B: acc.B + offset,
-			A: acc.A + offset,
-		}
+			cs := drawgl.FloatColor{
+				R: acc.R + offset,
+				G: acc.G + offset,
+				B: acc.B + offset,
+				A: acc.A + offset,
+			}
 
-		buf.UnsafeSetColor(pt.X, pt.Y,
-			drawgl.MaskColor(center, cs, n.opts.Channel, f, draw.Over))
+			s.Set(i, drawgl.MaskColor(center, cs, n.opts.Channel, f, draw.Over))
+		}
 	})
+
+	return
+}
+
+func (n Convolution) Hash() string {
+	return drawgl.HashOptions("Convolution", n.opts)
+}
+
+// keepAlpha scales the channels of a premultiplied color, filtered along
+// with its alpha, so that it is premultiplied by the original alpha of the
+// pixel instead. This averages the colors weighed by their alpha, for
+// operations which leave the alpha channel intact.
+func keepAlpha(c drawgl.FloatColor, channel drawgl.Channel, filtered, alpha drawgl.ColorValue) drawgl.FloatColor {
+	var scale drawgl.ColorValue
+	if filtered > 0 {
+		scale = alpha / filtered
+	}
+
+	if channel.Is(drawgl.Red) {
+		c.R *= scale
+	}
+	if channel.Is(drawgl.Green) {
+		c.G *= scale
+	}
+	if channel.Is(drawgl.Blue) {
+		c.B *= scale
+	}
+	c.A = alpha
+
+	return c
 }
 
 func ColorAccumulator(acc, add, sub drawgl.FloatColor, coeff drawgl.ColorValue, channel drawgl.Channel) drawgl.FloatColor {
@@ -124,6 +220,26 @@ func ColorAccumulator(acc, add, sub drawgl.FloatColor, coeff drawgl.ColorValue,
 	return acc
 }
 
+func (n Convolution) Definition() (string, interface{}) {
+	return "Convolution", n.opts
+}
+
+var convolutionDescriptor = drawgl.Descriptor{
+	Name:    "Convolution",
+	Doc:     "Convolves the image with a kernel.",
+	Inputs:  []drawgl.ConnectorDescriptor{drawgl.MainInput()},
+	Outputs: []drawgl.ConnectorDescriptor{drawgl.MainOutput()},
+	Options: append([]drawgl.OptionDescriptor{
+		{
+			Name: "Kernel", Type: drawgl.ArrayOption, Required: true,
+			Items: &drawgl.OptionDescriptor{Type: drawgl.NumberOption},
+			Doc:   "the weights of an odd square kernel, row by row",
+		},
+		{Name: "Normalize", Type: drawgl.BooleanOption, Default: false, Doc: "divide the weights by their sum"},
+		drawgl.EdgeOption(),
+	}, drawgl.CommonOptions()...),
+}
+
 func init() {
 	type jsonOptions struct {
 		Kernel    kernel
@@ -131,21 +247,29 @@ func init() {
 		Normalize bool
 		Mask      drawgl.Mask
 		Linear    bool
+		Edge      drawgl.EdgeHandler
 	}
 
-	graph.RegisterLinker("Convolution", func(opts json.RawMessage) (graph.Linker, error) {
+	drawgl.RegisterOperation(convolutionDescriptor, func(opts json.RawMessage) (graph.Linker, error) {
 		var o ConvolutionOptions
 		var jsono jsonOptions
 
-		if err := json.Unmarshal([]byte(opts), &jsono); err != nil {
+		if err := drawgl.UnmarshalOptions(opts, &jsono); err != nil {
 			return nil, fmt.Errorf("constructing Convolution: %v", err)
 		}
 
-		o.Kernel = jsono.Kernel
+		if len(jsono.Kernel) > 0 {
+			k, err := NewKernel(jsono.Kernel)
+			if err != nil {
+				return nil, fmt.Errorf("constructing Convolution: %v", err)
+			}
+			o.Kernel = k
+		}
 		o.Channel = jsono.Channel
 		o.Normalize = jsono.Normalize
 		o.Mask = jsono.Mask
 		o.Linear = jsono.Linear
+		o.Edge = jsono.Edge
 
 		return NewConvolutionLinker(o)
 	})
@@ -1,6 +1,10 @@
 package convolution_test
 
 import (
+	"context"
+	"image"
+	"image/draw"
+	"math"
 	"testing"
 
 	"github.com/urandom/drawgl"
@@ -23,7 +27,7 @@ func TestConvolution(t *testing.T) {
 	buffers := tests.ImageBuffers(t)
 	p, wd, output := tests.PrepareLinker(l)
 
-	go p.Process(wd, buffers, output)
+	go p.Process(context.Background(), wd, buffers, output)
 
 	r := <-output
 	if r.Error != nil {
@@ -57,7 +61,7 @@ func TestNormalizedConvolution(t *testing.T) {
 	buffers := tests.ImageBuffers(t)
 	p, wd, output := tests.PrepareLinker(l)
 
-	go p.Process(wd, buffers, output)
+	go p.Process(context.Background(), wd, buffers, output)
 
 	r := <-output
 	if r.Error != nil {
@@ -147,3 +151,73 @@ func expectedNormalizedResult1() (c [4][4]drawgl.FloatColor) {
 
 	return
 }
+
+// allChannels has the benchmarks filter the alpha as well, so that they
+// don't depend on how the operations keep it intact
+var allChannels drawgl.Channel = drawgl.Red | drawgl.Green | drawgl.Blue | drawgl.Alpha
+
+func BenchmarkConvolution(b *testing.B) {
+	l, err := convolution.NewConvolutionLinker(convolution.ConvolutionOptions{Kernel: kernel1(), Normalize: true, Channel: allChannels})
+	if err != nil {
+		b.Fatalf("Error creating a convolution linker: %v\n", err)
+	}
+
+	tests.BenchmarkTiles(b, l, tests.PatternImage(512, 512))
+}
+
+func BenchmarkConvolutionIterate(b *testing.B) {
+	k := kernel1()
+	l, err := convolution.NewConvolutionLinker(convolution.ConvolutionOptions{Kernel: k, Normalize: true, Channel: allChannels})
+	if err != nil {
+		b.Fatalf("Error creating a convolution linker: %v\n", err)
+	}
+
+	tests.BenchmarkIterate(b, l, tests.PatternImage(512, 512), func(ctx context.Context, src *drawgl.FloatImage) (*drawgl.FloatImage, error) {
+		return convolutionIterate(ctx, src, k)
+	})
+}
+
+// convolutionIterate applies the normalized kernel to all channels of the
+// image like Convolution does, one pixel at a time, with the iterators that
+// preceded the span ones.
+func convolutionIterate(ctx context.Context, img *drawgl.FloatImage, k convolution.Kernel) (*drawgl.FloatImage, error) {
+	src := drawgl.ConvertAlpha(img, drawgl.Premultiplied)
+	b := src.Bounds()
+	weights, offset := k.Normalized()
+
+	buf := drawgl.CropImage(src, b)
+	l := len(weights)
+	size := int(math.Sqrt(float64(l)))
+	half := size / 2
+
+	err := drawgl.DefaultRectangleIterator(b).Iterate(ctx, drawgl.Mask{}, func(pt image.Point, f float32) {
+		if f == 0 {
+			return
+		}
+
+		var acc drawgl.FloatColor
+		for cy := pt.Y - half; cy <= pt.Y+half; cy++ {
+			for cx := pt.X - half; cx <= pt.X+half; cx++ {
+				coeff := weights[l-((cy-pt.Y+half)*size+cx-pt.X+half)-1]
+
+				c := drawgl.EdgeColor(src, cx, cy, b, drawgl.Extend)
+				acc = convolution.ColorAccumulator(acc, c, drawgl.FloatColor{}, coeff, allChannels)
+			}
+		}
+
+		cs := drawgl.FloatColor{
+			R: acc.R + offset,
+			G: acc.G + offset,
+			B: acc.B + offset,
+			A: acc.A + offset,
+		}
+
+		buf.UnsafeSetColor(pt.X, pt.Y,
+			drawgl.MaskColor(src.UnsafeFloatAt(pt.X, pt.Y), cs, allChannels, f, draw.Over))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return drawgl.ConvertAlpha(buf, img.Alpha), nil
+}
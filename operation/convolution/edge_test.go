@@ -0,0 +1,125 @@
+package convolution_test
+
+import (
+	"context"
+	"image"
+	"testing"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/operation/convolution"
+	"github.com/urandom/drawgl/operation/tests"
+	"github.com/urandom/graph"
+)
+
+func TestEdge(t *testing.T) {
+	weights := []float32{1, 2, 1, 2, 4, 2, 1, 2, 1}
+	k, err := convolution.NewKernel(weights)
+	if err != nil {
+		t.Fatalf("Error creating a kernel: %v\n", err)
+	}
+
+	var all drawgl.Channel = drawgl.Red | drawgl.Green | drawgl.Blue | drawgl.Alpha
+	img := tests.PatternImage(7, 5)
+	b := img.Bounds()
+
+	edges := []drawgl.EdgeHandler{
+		drawgl.Extend, drawgl.Wrap, drawgl.Mirror, drawgl.Transparent,
+		drawgl.Constant(drawgl.FloatColor{R: 0.5, A: 0.5}),
+	}
+
+	for _, edge := range edges {
+		// The radius exceeds the image, so that the edge handlers have
+		// to map points further than a whole image away
+		radius := 6
+		boxBlur := make([]drawgl.ColorValue, (2*radius+1)*(2*radius+1))
+		for i := range boxBlur {
+			boxBlur[i] = 1
+		}
+
+		linkers := map[string]struct {
+			l       func() (graph.Linker, error)
+			weights []drawgl.ColorValue
+		}{
+			"BoxBlur": {func() (graph.Linker, error) {
+				return convolution.NewBoxBlurLinker(convolution.BoxBlurOptions{Radius: radius, Channel: all, Edge: edge})
+			}, boxBlur},
+			"Convolution": {func() (graph.Linker, error) {
+				return convolution.NewConvolutionLinker(convolution.ConvolutionOptions{Kernel: k, Normalize: true, Channel: all, Edge: edge})
+			}, k.Weights()},
+		}
+
+		for name, o := range linkers {
+			l, err := o.l()
+			if err != nil {
+				t.Fatalf("Error creating a %s linker: %v\n", name, err)
+			}
+
+			p := l.Node().(drawgl.TileProcessor)
+			exp := edgeReference(img, o.weights, edge)
+
+			buf := tests.ProcessImage(t, l, img)
+			checkEdge(t, name+" "+edge.String(), buf, exp, b)
+
+			// Tiles only receive the part of the source they ask for
+			for y := b.Min.Y; y < b.Max.Y; y += 3 {
+				for x := b.Min.X; x < b.Max.X; x += 3 {
+					rect := image.Rect(x, y, x+3, y+3).Intersect(b)
+					src := img.SubImage(p.TileSource(rect, b).Intersect(b)).(*drawgl.FloatImage)
+
+					tile, err := p.ProcessTile(context.Background(), src, b, rect)
+					if err != nil {
+						t.Fatalf("Error processing tile %v: %v\n", rect, err)
+					}
+
+					checkEdge(t, name+" "+edge.String()+" tile", tile, exp, rect)
+				}
+			}
+		}
+	}
+}
+
+// edgeReference computes the weighed average of the neighborhood of every
+// pixel, one point at a time.
+func edgeReference(img *drawgl.FloatImage, weights []drawgl.ColorValue, edge drawgl.EdgeHandler) *drawgl.FloatImage {
+	b := img.Bounds()
+	size := 1
+	for size*size < len(weights) {
+		size++
+	}
+	half := size / 2
+
+	var total drawgl.ColorValue
+	for _, w := range weights {
+		total += w
+	}
+
+	exp := drawgl.NewFloatImage(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var acc drawgl.FloatColor
+			for i, w := range weights {
+				c := drawgl.EdgeColor(img, x+i%size-half, y+i/size-half, b, edge)
+				w /= total
+
+				acc.R += c.R * w
+				acc.G += c.G * w
+				acc.B += c.B * w
+				acc.A += c.A * w
+			}
+
+			exp.UnsafeSetColor(x, y, acc)
+		}
+	}
+
+	return exp
+}
+
+func checkEdge(t *testing.T, name string, buf, exp *drawgl.FloatImage, rect image.Rectangle) {
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if c, e := buf.FloatAt(x, y), exp.FloatAt(x, y); !c.ApproxEqual(e) {
+				t.Fatalf("%s: at %d:%d, color %v doesn't match %v\n", name, x, y, c, e)
+			}
+		}
+	}
+}
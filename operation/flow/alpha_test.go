@@ -0,0 +1,64 @@
+package flow_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/operation/convolution"
+	"github.com/urandom/drawgl/operation/flow"
+	"github.com/urandom/drawgl/operation/group"
+	"github.com/urandom/drawgl/operation/tests"
+	_ "github.com/urandom/drawgl/operation/transform"
+	"github.com/urandom/graph"
+)
+
+// routedBlur blurs the image taken by the If node's output, so that the
+// blur is applied downstream of the flow nodes
+const routedBlur = `{
+	"Id": "if",
+	"Name": "If",
+	"Options": {"Condition": "input.width > 2"},
+	"Outputs": {
+		"Output": {"Id": "blur", "Name": "BoxBlur", "Options": {"Radius": 2}},
+		"Else": {"Id": "else", "Name": "Crop", "Options": {"Max": [1, 1]}}
+	}
+}`
+
+func TestTransparent(t *testing.T) {
+	blur := func() (graph.Linker, error) {
+		return group.NewGroupLinker(group.GroupOptions{
+			Definition: group.Definition{
+				Graph:   json.RawMessage(routedBlur),
+				Inputs:  map[graph.ConnectorName]string{graph.InputName: "if"},
+				Outputs: map[graph.ConnectorName]string{graph.OutputName: "blur"},
+			},
+		})
+	}
+
+	tests.CheckTransparent(t, []tests.TransparentCase{
+		{Name: "If", Straight: forwarded, Linker: func() (graph.Linker, error) {
+			return flow.NewIfLinker(flow.IfOptions{Condition: "input.width > 2"})
+		}},
+		{Name: "Switch", Straight: forwarded, Linker: func() (graph.Linker, error) {
+			return flow.NewSwitchLinker(flow.SwitchOptions{Cases: []flow.SwitchCase{{When: "input.width < 2", Output: "Small"}}})
+		}},
+		// The straight image reaches the blur as is, which filters it
+		// premultiplied, like an image that wasn't routed
+		{Name: "routed BoxBlur", Linker: blur, Straight: func(t *testing.T, name string, src, buf *drawgl.FloatImage) {
+			l, err := convolution.NewBoxBlurLinker(convolution.BoxBlurOptions{Radius: 2})
+			if err != nil {
+				t.Fatalf("Error creating a box blur linker: %v\n", err)
+			}
+
+			tests.CheckVisible(t, name, buf, tests.ProcessImage(t, l, src))
+		}},
+	})
+}
+
+// forwarded checks that the flow node forwarded its straight input as is.
+func forwarded(t *testing.T, name string, src, buf *drawgl.FloatImage) {
+	if buf != src {
+		t.Fatalf("%s: expected the input to be forwarded as is\n", name)
+	}
+}
@@ -0,0 +1,131 @@
+package flow_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urandom/drawgl"
+	_ "github.com/urandom/drawgl/operation"
+	"github.com/urandom/drawgl/operation/flow"
+	"github.com/urandom/drawgl/operation/tests"
+	"github.com/urandom/graph"
+)
+
+func TestIf(t *testing.T) {
+	dir := t.TempDir()
+	then, otherwise := filepath.Join(dir, "then.png"), filepath.Join(dir, "else.png")
+
+	def := fmt.Sprintf(`{
+		"Name": "Load",
+		"Options": {"Path": %q},
+		"Outputs": {
+			"Output": {
+				"Name": "If",
+				"Options": {"Condition": "meta['input-format'] == 'png' && input.width > 2"},
+				"Outputs": {
+					"Output": {
+						"Name": "BoxBlur",
+						"Outputs": {"Output": {"Name": "Save", "Options": {"Path": %q}}}
+					},
+					"Else": {"Name": "Save", "Options": {"Path": %q}}
+				}
+			}
+		}
+	}`, tests.TestDataDir()+"/test.png", then, otherwise)
+
+	roots, err := drawgl.ProcessJSON(strings.NewReader(def), nil)
+	if err != nil {
+		t.Fatalf("Error reading graph: %v\n", err)
+	}
+
+	report := &drawgl.Report{}
+	if err := (drawgl.Graph{Report: report}).Process(roots[0]); err != nil {
+		t.Fatalf("Error processing graph: %v\n", err)
+	}
+
+	if _, err := os.Stat(then); err != nil {
+		t.Fatalf("Expected the taken branch to be saved: %v\n", err)
+	}
+
+	if _, err := os.Stat(otherwise); err == nil {
+		t.Fatalf("Expected the other branch to be skipped\n")
+	}
+
+	skipped := 0
+	for _, s := range report.Nodes() {
+		if s.Skipped {
+			skipped++
+			if s.Name != "Save" {
+				t.Fatalf("Expected only the else Save node to be skipped, got %s\n", s.Name)
+			}
+		}
+	}
+
+	if skipped != 1 {
+		t.Fatalf("Expected 1 skipped node, got %d\n", skipped)
+	}
+
+	if _, err := flow.NewIfLinker(flow.IfOptions{Condition: "input.width >"}); err == nil {
+		t.Fatalf("Expected an error\n")
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	l, err := flow.NewSwitchLinker(flow.SwitchOptions{Cases: []flow.SwitchCase{
+		{When: "meta.format == 'gif'", Output: "Gif"},
+		{When: "input.width < 10", Output: "Small"},
+		{When: "meta.format == 'jpeg'", Output: "Gif"},
+	}})
+	if err != nil {
+		t.Fatalf("Error creating a switch linker: %v\n", err)
+	}
+
+	if named := l.Node().(drawgl.NamedOutputs).NamedOutputs(); len(named) != 2 || named[0] != "Gif" || named[1] != "Small" {
+		t.Fatalf("Unexpected named outputs %v\n", named)
+	}
+
+	cases := []struct {
+		meta     drawgl.Meta
+		inactive []graph.ConnectorName
+	}{
+		{drawgl.Meta{"format": "gif"}, []graph.ConnectorName{graph.OutputName, "Small"}},
+		{drawgl.Meta{"format": "png"}, []graph.ConnectorName{graph.OutputName, "Gif"}},
+	}
+
+	for _, c := range cases {
+		buffers := tests.ImageBuffers(t)
+		in := buffers[graph.InputName]
+		in.Meta = c.meta
+		buffers[graph.InputName] = in
+
+		p, wd, output := tests.PrepareLinker(l)
+		go p.Process(context.Background(), wd, buffers, output)
+
+		r := <-output
+		if r.Error != nil {
+			t.Fatalf("Error processing: %v\n", r.Error)
+		}
+
+		if fmt.Sprint(r.Inactive) != fmt.Sprint(c.inactive) {
+			t.Fatalf("Expected inactive outputs %v for %v, got %v\n", c.inactive, c.meta, r.Inactive)
+		}
+
+		if r.Buffer != in.Buffer {
+			t.Fatalf("Expected the input buffer to be forwarded\n")
+		}
+	}
+
+	for _, opts := range []flow.SwitchOptions{
+		{},
+		{Cases: []flow.SwitchCase{{When: "true", Output: graph.OutputName}}},
+		{Cases: []flow.SwitchCase{{When: "meta.", Output: "A"}}},
+	} {
+		if _, err := flow.NewSwitchLinker(opts); err == nil {
+			t.Fatalf("Expected an error for %v\n", opts)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/graph"
+	"github.com/urandom/graph/base"
+)
+
+// ElseName is the output taken by If when its condition is false.
+const ElseName graph.ConnectorName = "Else"
+
+// If forwards its input to the Output connector when the condition holds,
+// and to the Else connector otherwise. The nodes connected to the other
+// connector are skipped. The input is forwarded as is, in any alpha mode.
+type If struct {
+	base.Node
+	opts      IfOptions
+	condition drawgl.Expression
+}
+
+// IfOptions hold a boolean expression, evaluated against the input, as
+// described by drawgl.Expression.
+type IfOptions struct {
+	Condition string
+}
+
+func NewIfLinker(opts IfOptions) (graph.Linker, error) {
+	e, err := drawgl.ParseExpression(opts.Condition)
+	if err != nil {
+		return nil, err
+	}
+
+	return base.NewLinkerNode(If{
+		Node:      base.NewNode(),
+		opts:      opts,
+		condition: e,
+	}), nil
+}
+
+func (n If) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+	r := buffers[graph.InputName]
+	res := drawgl.Result{Id: n.Id(), Buffer: r.Buffer, Meta: r.Meta}
+
+	ok, err := evaluate(n.condition, r)
+	switch {
+	case err != nil:
+		res.Error = fmt.Errorf("Error evaluating condition: %v", err)
+	case ok:
+		res.Inactive = []graph.ConnectorName{ElseName}
+	default:
+		res.Inactive = []graph.ConnectorName{graph.OutputName}
+	}
+
+	output <- res
+
+	wd.Close()
+}
+
+func (n If) NamedOutputs() []graph.ConnectorName {
+	return []graph.ConnectorName{ElseName}
+}
+
+func (n If) Hash() string {
+	return drawgl.HashOptions("If", n.opts)
+}
+
+func (n If) Definition() (string, interface{}) {
+	return "If", n.opts
+}
+
+// evaluate evaluates a condition, which has to produce a boolean.
+func evaluate(e drawgl.Expression, r drawgl.Result) (bool, error) {
+	v, err := e.Evaluate(r)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%q produced %v instead of a boolean", e, v)
+	}
+
+	return b, nil
+}
+
+var ifDescriptor = drawgl.Descriptor{
+	Name: "If",
+	Doc: `Forwards the image to Output when the condition holds, and to Else otherwise.
+The nodes connected to the other output are skipped.`,
+	Inputs: []drawgl.ConnectorDescriptor{drawgl.MainInput()},
+	Outputs: []drawgl.ConnectorDescriptor{
+		{Name: graph.OutputName, Doc: "receives the image when the condition holds"},
+		{Name: ElseName, Doc: "receives the image when the condition does not hold"},
+	},
+	Options: []drawgl.OptionDescriptor{
+		{Name: "Condition", Type: drawgl.ExpressionOption, Required: true, Doc: "a boolean expression, evaluated against the image"},
+	},
+}
+
+func init() {
+	drawgl.RegisterOperation(ifDescriptor, func(opts json.RawMessage) (graph.Linker, error) {
+		var o IfOptions
+
+		if err := drawgl.UnmarshalOptions(opts, &o); err != nil {
+			return nil, fmt.Errorf("constructing If: %v", err)
+		}
+
+		return NewIfLinker(o)
+	})
+}
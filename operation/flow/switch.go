@@ -0,0 +1,142 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/graph"
+	"github.com/urandom/graph/base"
+)
+
+// Switch forwards its input to the output of the first case whose condition
+// holds, or to the Output connector if none does. The nodes connected to the
+// other outputs are skipped. Like If, it leaves the pixels and their alpha
+// mode untouched.
+type Switch struct {
+	base.Node
+	opts       SwitchOptions
+	conditions []drawgl.Expression
+	outputs    []graph.ConnectorName
+}
+
+type SwitchOptions struct {
+	Cases []SwitchCase
+}
+
+// SwitchCase holds a boolean expression, as described by drawgl.Expression,
+// and the named output taken when it holds. Several cases may share an
+// output.
+type SwitchCase struct {
+	When   string
+	Output graph.ConnectorName
+}
+
+func NewSwitchLinker(opts SwitchOptions) (graph.Linker, error) {
+	if len(opts.Cases) == 0 {
+		return nil, errors.New("no cases")
+	}
+
+	n := Switch{Node: base.NewNode(), opts: opts}
+
+	seen := make(map[graph.ConnectorName]bool)
+	for i, c := range opts.Cases {
+		if c.Output == "" || c.Output == graph.OutputName {
+			return nil, fmt.Errorf("case %d: invalid output %q", i, c.Output)
+		}
+
+		e, err := drawgl.ParseExpression(c.When)
+		if err != nil {
+			return nil, fmt.Errorf("case %d: %v", i, err)
+		}
+		n.conditions = append(n.conditions, e)
+
+		if !seen[c.Output] {
+			seen[c.Output] = true
+			n.outputs = append(n.outputs, c.Output)
+		}
+	}
+
+	sort.Slice(n.outputs, func(i, j int) bool { return n.outputs[i] < n.outputs[j] })
+
+	return base.NewLinkerNode(n), nil
+}
+
+func (n Switch) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+	r := buffers[graph.InputName]
+	res := drawgl.Result{Id: n.Id(), Buffer: r.Buffer, Meta: r.Meta}
+
+	taken := graph.OutputName
+	for i, e := range n.conditions {
+		ok, err := evaluate(e, r)
+		if err != nil {
+			res.Error = fmt.Errorf("Error evaluating case %d: %v", i, err)
+			break
+		}
+
+		if ok {
+			taken = n.opts.Cases[i].Output
+			break
+		}
+	}
+
+	if res.Error == nil {
+		for _, c := range append([]graph.ConnectorName{graph.OutputName}, n.outputs...) {
+			if c != taken {
+				res.Inactive = append(res.Inactive, c)
+			}
+		}
+	}
+
+	output <- res
+
+	wd.Close()
+}
+
+func (n Switch) NamedOutputs() []graph.ConnectorName {
+	return n.outputs
+}
+
+func (n Switch) Hash() string {
+	return drawgl.HashOptions("Switch", n.opts)
+}
+
+func (n Switch) Definition() (string, interface{}) {
+	return "Switch", n.opts
+}
+
+var switchDescriptor = drawgl.Descriptor{
+	Name: "Switch",
+	Doc: `Forwards the image to the output of the first case whose condition holds, or to Output if none does.
+The nodes connected to the other outputs are skipped.`,
+	Inputs: []drawgl.ConnectorDescriptor{drawgl.MainInput()},
+	Outputs: []drawgl.ConnectorDescriptor{
+		{Name: graph.OutputName, Doc: "receives the image when no case holds"},
+		{Name: "<case output>", Doc: "receives the image when the case holds"},
+	},
+	Options: []drawgl.OptionDescriptor{
+		{
+			Name: "Cases", Type: drawgl.ArrayOption,
+			Items: &drawgl.OptionDescriptor{Type: drawgl.ObjectOption, Fields: []drawgl.OptionDescriptor{
+				{Name: "When", Type: drawgl.ExpressionOption, Required: true, Doc: "a boolean expression, evaluated against the image"},
+				{Name: "Output", Type: drawgl.StringOption, Required: true, Doc: "the output taken when the expression holds"},
+			}},
+			Doc: "the cases, in the order they are checked",
+		},
+	},
+}
+
+func init() {
+	drawgl.RegisterOperation(switchDescriptor, func(opts json.RawMessage) (graph.Linker, error) {
+		var o SwitchOptions
+
+		if err := drawgl.UnmarshalOptions(opts, &o); err != nil {
+			return nil, fmt.Errorf("constructing Switch: %v", err)
+		}
+
+		return NewSwitchLinker(o)
+	})
+}
@@ -0,0 +1,44 @@
+package group_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/operation/convolution"
+	"github.com/urandom/drawgl/operation/group"
+	"github.com/urandom/drawgl/operation/tests"
+	"github.com/urandom/drawgl/operation/transform"
+	"github.com/urandom/graph"
+)
+
+func TestTransparent(t *testing.T) {
+	tests.CheckTransparent(t, []tests.TransparentCase{
+		{Name: "Group", Straight: matchesInnerNodes, Linker: func() (graph.Linker, error) {
+			return group.NewGroupLinker(group.GroupOptions{
+				Definition: group.Definition{
+					Graph:   json.RawMessage(blurScale),
+					Inputs:  map[graph.ConnectorName]string{graph.InputName: "blur"},
+					Outputs: map[graph.ConnectorName]string{graph.OutputName: "scale", "Blurred": "blur"},
+				},
+			})
+		}},
+	})
+}
+
+// matchesInnerNodes checks that the group passed the straight image between
+// its inner nodes as processing them one after the other does.
+func matchesInnerNodes(t *testing.T, name string, src, buf *drawgl.FloatImage) {
+	blur, err := convolution.NewBoxBlurLinker(convolution.BoxBlurOptions{Radius: 1})
+	if err != nil {
+		t.Fatalf("Error creating a box blur linker: %v\n", err)
+	}
+
+	scale, err := transform.NewScaleLinker(transform.ScaleOptions{Width: 2, Height: 2, Crop: true})
+	if err != nil {
+		t.Fatalf("Error creating a scale linker: %v\n", err)
+	}
+
+	exp := tests.ProcessImage(t, scale, tests.ProcessImage(t, blur, src))
+	tests.CheckVisible(t, name, buf, exp)
+}
@@ -0,0 +1,522 @@
+package group
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/graph"
+	"github.com/urandom/graph/base"
+)
+
+// rootConnector connects the source of a group to the inner roots that do
+// not receive any of the group's inputs, so that they are processed as part
+// of the same graph. No node reads from it.
+const rootConnector graph.ConnectorName = "GroupRoot"
+
+// Group processes an inner graph as a single node. The group's inputs are
+// connected to inner nodes, while its outputs are taken from inner nodes.
+// The alpha mode of the outputs is whatever the inner nodes produce.
+type Group struct {
+	base.Node
+	opts GroupOptions
+	def  Definition
+	args []drawgl.Override
+	// includes holds the absolute paths of the files including the inner
+	// graph, outermost first
+	includes []string
+	inPlace  bool
+}
+
+// GroupOptions either hold a group definition, or Include the path of a JSON
+// file holding one. The fields that are set replace the ones of the included
+// definition. Args hold values for the parameters of the definition.
+//
+// IncludedFrom holds the absolute paths of the files that include the group,
+// outermost first. A relative Include is resolved against the directory of
+// the last one, or the working directory if there are none, and including
+// any of them again is an error. It is set for the groups of included
+// graphs, and by the IncludedFrom override.
+type GroupOptions struct {
+	Include string `json:"$include,omitempty"`
+	Definition
+	Args         map[string]json.RawMessage `json:",omitempty"`
+	IncludedFrom []string                   `json:"$includedFrom,omitempty"`
+}
+
+// Definition describes a group. Graph holds a JSON graph definition, whose
+// nodes are referenced by their Id from Inputs and Outputs, optionally
+// followed by a connector, as in "comp.Background". Each parameter sets the
+// inner options listed for it, given as Target.Option, where the target is a
+// node Id or name.
+type Definition struct {
+	Graph   json.RawMessage                `json:",omitempty"`
+	Params  map[string][]string            `json:",omitempty"`
+	Inputs  map[graph.ConnectorName]string `json:",omitempty"`
+	Outputs map[graph.ConnectorName]string `json:",omitempty"`
+}
+
+// connection is an inner end of a group connector.
+type connection struct {
+	id        string
+	connector graph.ConnectorName
+}
+
+// source sends the group's inputs to the inner graph.
+type source struct {
+	base.Node
+	buffers map[graph.ConnectorName]drawgl.Result
+	copy    bool
+}
+
+// capture receives the results of the inner nodes connected to a group
+// output.
+type capture struct {
+	base.Node
+	name    graph.ConnectorName
+	mu      *sync.Mutex
+	results map[graph.ConnectorName]drawgl.Result
+}
+
+func NewGroupLinker(opts GroupOptions) (graph.Linker, error) {
+	def, includes, err := opts.definition()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(def.Graph) == 0 {
+		return nil, errors.New("missing group graph")
+	}
+
+	var args []drawgl.Override
+	for _, name := range sortedArgs(opts.Args) {
+		targets, ok := def.Params[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown parameter %q", name)
+		}
+
+		value := string(opts.Args[name])
+
+		var s string
+		if json.Unmarshal(opts.Args[name], &s) == nil {
+			value = s
+		}
+
+		for _, t := range targets {
+			o, err := drawgl.ParseOverride(t + "=" + value)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %q: %v", name, err)
+			}
+			args = append(args, o)
+		}
+	}
+
+	n := Group{Node: base.NewNode(), opts: opts, def: def, args: args, includes: includes}
+
+	// Construct the inner graph once, to report any problems early
+	g, err := n.readGraph()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := def.checkParams(g); err != nil {
+		return nil, err
+	}
+
+	for _, c := range def.Inputs {
+		conn, err := parseConnection(c, graph.InputName)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := g.Nodes[conn.id]; !ok {
+			return nil, fmt.Errorf("input %q: unknown node id %q", c, conn.id)
+		}
+	}
+
+	for _, c := range def.Outputs {
+		conn, err := parseConnection(c, graph.OutputName)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := g.Nodes[conn.id]; !ok {
+			return nil, fmt.Errorf("output %q: unknown node id %q", c, conn.id)
+		}
+	}
+
+	for _, l := range g.Nodes {
+		if ip, ok := l.Node().(drawgl.InPlaceProcessor); ok && ip.InPlace() {
+			n.inPlace = true
+		}
+	}
+
+	return base.NewLinkerNode(n), nil
+}
+
+// IncludedFrom returns an override that resolves the includes of the groups
+// in a graph definition read from the given file against its directory.
+func IncludedFrom(path string) (drawgl.Override, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return drawgl.Override{}, err
+	}
+
+	return includedFrom([]string{abs}), nil
+}
+
+func includedFrom(includes []string) drawgl.Override {
+	b, _ := json.Marshal(includes)
+	return drawgl.Override{Target: "Group", Option: "$includedFrom", Value: string(b), Optional: true}
+}
+
+// IncludePath returns the path of the included file, resolved against the
+// directory of the file that includes the group.
+func (o GroupOptions) IncludePath() string {
+	if o.Include == "" || filepath.IsAbs(o.Include) || len(o.IncludedFrom) == 0 {
+		return o.Include
+	}
+
+	return filepath.Join(filepath.Dir(o.IncludedFrom[len(o.IncludedFrom)-1]), o.Include)
+}
+
+// definition returns the group definition, reading the included one, if
+// any, along with the files including its graph.
+func (o GroupOptions) definition() (Definition, []string, error) {
+	if o.Include == "" {
+		return o.Definition, o.IncludedFrom, nil
+	}
+
+	path, err := filepath.Abs(o.IncludePath())
+	if err != nil {
+		return Definition{}, nil, fmt.Errorf("including group: %v", err)
+	}
+
+	includes := append(o.IncludedFrom[:len(o.IncludedFrom):len(o.IncludedFrom)], path)
+	for _, p := range o.IncludedFrom {
+		if p == path {
+			return Definition{}, nil, &drawgl.ValidationError{
+				Path: o.Include,
+				Err:  fmt.Errorf("include cycle %s", strings.Join(includes, " -> ")),
+			}
+		}
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Definition{}, nil, fmt.Errorf("including group: %v", err)
+	}
+
+	var def Definition
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		// Arrays of root nodes are plain graph definitions
+		def.Graph = b
+	} else if _, ok := fields["Graph"]; ok {
+		if err := drawgl.UnmarshalOptions(b, &def); err != nil {
+			return Definition{}, nil, fmt.Errorf("including group %s: %v", o.Include, err)
+		}
+	} else {
+		def.Graph = b
+	}
+
+	if o.Graph != nil {
+		def.Graph = o.Graph
+	}
+	if o.Params != nil {
+		def.Params = o.Params
+	}
+	if o.Inputs != nil {
+		def.Inputs = o.Inputs
+	}
+	if o.Outputs != nil {
+		def.Outputs = o.Outputs
+	}
+
+	return def, includes, nil
+}
+
+// checkParams reports parameters whose targets do not match any inner node.
+func (def Definition) checkParams(g drawgl.JSONGraph) error {
+	names := make(map[string]bool)
+	for id := range g.Nodes {
+		names[id] = true
+	}
+
+	for _, l := range g.Linkers {
+		if d, ok := l.Node().(drawgl.Definer); ok {
+			name, _ := d.Definition()
+			names[name] = true
+		}
+	}
+
+	for _, name := range sortedParams(def.Params) {
+		for _, t := range def.Params[name] {
+			o, err := drawgl.ParseOverride(t + "=")
+			if err != nil {
+				return fmt.Errorf("parameter %q: %v", name, err)
+			}
+
+			if !names[o.Target] {
+				return fmt.Errorf("parameter %q: no node matches %q", name, o.Target)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (n Group) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+	var err error
+	res := drawgl.Result{Id: n.Id()}
+
+	defer func() {
+		if err != nil {
+			res.Error = fmt.Errorf("Error processing group: %v", err)
+		}
+		output <- res
+
+		wd.Close()
+	}()
+
+	g, err := n.readGraph()
+	if err != nil {
+		return
+	}
+
+	src := base.NewLinkerNode(source{Node: base.NewNode(), buffers: buffers, copy: n.inPlace})
+
+	fed := make(map[graph.Id]bool)
+	for name, c := range n.def.Inputs {
+		conn, _ := parseConnection(c, graph.InputName)
+		target := g.Nodes[conn.id]
+
+		from := name
+		if name == graph.InputName {
+			from = graph.OutputName
+		}
+
+		if err = src.Link(target, from, conn.connector); err != nil {
+			return
+		}
+		fed[target.Node().Id()] = true
+	}
+
+	for _, root := range g.Roots {
+		if !fed[root.Node().Id()] {
+			if err = src.Link(root, graph.OutputName, rootConnector); err != nil {
+				return
+			}
+		}
+	}
+
+	var mu sync.Mutex
+	results := make(map[graph.ConnectorName]drawgl.Result)
+	for name, c := range n.def.Outputs {
+		conn, _ := parseConnection(c, graph.OutputName)
+		l := base.NewLinkerNode(capture{Node: base.NewNode(), name: name, mu: &mu, results: results})
+
+		if err = g.Nodes[conn.id].Link(l, conn.connector, graph.InputName); err != nil {
+			return
+		}
+	}
+
+	// The inner graph is processed with the configuration of the outer one,
+	// so that its nodes share the cache, report and observer
+	parent, _ := drawgl.GraphFromContext(ctx)
+	if err = parent.ProcessContext(ctx, src); err != nil {
+		return
+	}
+
+	for name, r := range results {
+		if name == graph.OutputName {
+			res.Buffer, res.Meta = r.Buffer, r.Meta
+			continue
+		}
+
+		if res.NamedBuffers == nil {
+			res.NamedBuffers = make(map[graph.ConnectorName]*drawgl.FloatImage)
+		}
+		res.NamedBuffers[name] = r.Buffer
+	}
+}
+
+// InPlace reports whether any of the inner nodes writes into its input.
+func (n Group) InPlace() bool {
+	return n.inPlace
+}
+
+func (n Group) NamedInputs() []graph.ConnectorName {
+	return sortedConnectors(n.def.Inputs, "")
+}
+
+func (n Group) NamedOutputs() []graph.ConnectorName {
+	return sortedConnectors(n.def.Outputs, graph.OutputName)
+}
+
+func (n Group) Definition() (string, interface{}) {
+	return "Group", n.opts
+}
+
+// InnerGraph constructs a new copy of the inner graph, with the arguments
+// applied. It is not connected to the inputs and outputs of the group.
+func (n Group) InnerGraph() (drawgl.JSONGraph, error) {
+	return n.readGraph()
+}
+
+// readGraph constructs the inner graph, with the arguments applied, and the
+// includes of its groups resolved against the file holding it.
+func (n Group) readGraph() (drawgl.JSONGraph, error) {
+	overrides := n.args
+	if len(n.includes) > 0 {
+		overrides = append(overrides[:len(overrides):len(overrides)], includedFrom(n.includes))
+	}
+
+	return drawgl.ReadJSON(bytes.NewReader(n.def.Graph), nil, overrides...)
+}
+
+func (n source) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+	in := n.buffers[graph.InputName]
+	res := drawgl.Result{Id: n.Id(), Buffer: in.Buffer, Meta: in.Meta}
+
+	for name, r := range n.buffers {
+		if name == graph.InputName || r.Buffer == nil {
+			continue
+		}
+
+		if res.NamedBuffers == nil {
+			res.NamedBuffers = make(map[graph.ConnectorName]*drawgl.FloatImage)
+		}
+
+		// The main input is already owned by the group when any of the inner
+		// nodes write into their input, but not the named ones
+		if n.copy {
+			res.NamedBuffers[name] = drawgl.CopyImage(r.Buffer)
+		} else {
+			res.NamedBuffers[name] = r.Buffer
+		}
+	}
+
+	output <- res
+
+	wd.Close()
+}
+
+func (n capture) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+	r := buffers[graph.InputName]
+
+	n.mu.Lock()
+	n.results[n.name] = r
+	n.mu.Unlock()
+
+	output <- drawgl.Result{Id: n.Id(), Buffer: r.Buffer, Meta: r.Meta}
+
+	wd.Close()
+}
+
+// parseConnection parses an inner node id, optionally followed by a
+// connector.
+func parseConnection(s string, connector graph.ConnectorName) (connection, error) {
+	conn := connection{id: s, connector: connector}
+	if i := strings.LastIndex(s, "."); i != -1 {
+		conn.id, conn.connector = s[:i], graph.ConnectorName(s[i+1:])
+	}
+
+	if conn.id == "" || conn.connector == "" {
+		return connection{}, fmt.Errorf("invalid connection %q, expected an id and an optional connector", s)
+	}
+
+	return conn, nil
+}
+
+func sortedConnectors(m map[graph.ConnectorName]string, exclude graph.ConnectorName) []graph.ConnectorName {
+	names := make([]graph.ConnectorName, 0, len(m))
+	for name := range m {
+		if name != exclude {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+
+	return names
+}
+
+func sortedArgs(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func sortedParams(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+var groupDescriptor = drawgl.Descriptor{
+	Name: "Group",
+	Doc: `Processes an inner graph as a single node.
+The inputs and outputs of the group are the ones listed by its definition.`,
+	Inputs: []drawgl.ConnectorDescriptor{
+		{Name: graph.InputName, Doc: "the input of the inner node listed for it"},
+		{Name: "<input>", Doc: "the input of the inner node listed for it"},
+	},
+	Outputs: []drawgl.ConnectorDescriptor{
+		{Name: graph.OutputName, Doc: "the output of the inner node listed for it"},
+		{Name: "<output>", Doc: "the output of the inner node listed for it"},
+	},
+	Options: []drawgl.OptionDescriptor{
+		{Name: "$include", Type: drawgl.StringOption, Doc: "the path of a JSON file holding a definition, whose fields are replaced by the given ones"},
+		{Name: "Graph", Type: drawgl.AnyOption, Doc: "the inner JSON graph definition"},
+		{
+			Name: "Params", Type: drawgl.ObjectOption,
+			Items: &drawgl.OptionDescriptor{Type: drawgl.ArrayOption, Items: &drawgl.OptionDescriptor{Type: drawgl.StringOption}},
+			Doc:   "the inner options, as Target.Option, set by each parameter",
+		},
+		{
+			Name: "Inputs", Type: drawgl.ObjectOption, Items: &drawgl.OptionDescriptor{Type: drawgl.StringOption},
+			Doc: "the inner node, as Id or Id.Connector, receiving each input",
+		},
+		{
+			Name: "Outputs", Type: drawgl.ObjectOption, Items: &drawgl.OptionDescriptor{Type: drawgl.StringOption},
+			Doc: "the inner node, as Id or Id.Connector, producing each output",
+		},
+		{
+			Name: "Args", Type: drawgl.ObjectOption, Items: &drawgl.OptionDescriptor{Type: drawgl.AnyOption},
+			Doc: "the values of the parameters",
+		},
+		{
+			Name: "$includedFrom", Type: drawgl.ArrayOption, Items: &drawgl.OptionDescriptor{Type: drawgl.StringOption},
+			Doc: "the absolute paths of the files including the group, against which a relative $include is resolved",
+		},
+	},
+}
+
+func init() {
+	drawgl.RegisterOperation(groupDescriptor, func(opts json.RawMessage) (graph.Linker, error) {
+		var o GroupOptions
+
+		if err := drawgl.UnmarshalOptions(opts, &o); err != nil {
+			return nil, fmt.Errorf("constructing Group: %v", err)
+		}
+
+		return NewGroupLinker(o)
+	})
+}
@@ -0,0 +1,278 @@
+package group_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/urandom/drawgl"
+	_ "github.com/urandom/drawgl/operation"
+	"github.com/urandom/drawgl/operation/group"
+	"github.com/urandom/drawgl/operation/tests"
+	"github.com/urandom/graph"
+)
+
+const blurScale = `{
+	"Id": "blur",
+	"Name": "BoxBlur",
+	"Options": {"Radius": 1},
+	"Outputs": {
+		"Output": {"Id": "scale", "Name": "Scale", "Options": {"Width": 2, "Height": 2, "Crop": true}}
+	}
+}`
+
+func TestGroup(t *testing.T) {
+	l, err := group.NewGroupLinker(group.GroupOptions{
+		Definition: group.Definition{
+			Graph:   json.RawMessage(blurScale),
+			Params:  map[string][]string{"Size": {"scale.Width", "Scale.Height"}},
+			Inputs:  map[graph.ConnectorName]string{graph.InputName: "blur"},
+			Outputs: map[graph.ConnectorName]string{graph.OutputName: "scale", "Blurred": "blur"},
+		},
+		Args: map[string]json.RawMessage{"Size": json.RawMessage("1")},
+	})
+	if err != nil {
+		t.Fatalf("Error creating a group linker: %v\n", err)
+	}
+
+	buffers := tests.ImageBuffers(t)
+	p, wd, output := tests.PrepareLinker(l)
+
+	go p.Process(context.Background(), wd, buffers, output)
+
+	r := <-output
+	if r.Error != nil {
+		t.Fatalf("Error processing: %v\n", r.Error)
+	}
+
+	if b := r.Buffer.Bounds(); b != image.Rect(0, 0, 1, 1) {
+		t.Fatalf("Expected a 1x1 output, got %v\n", b)
+	}
+
+	if b := r.NamedBuffers["Blurred"].Bounds(); b != buffers[graph.InputName].Buffer.Bounds() {
+		t.Fatalf("Expected the blurred output to keep the input bounds, got %v\n", b)
+	}
+
+	if named := l.Node().(drawgl.NamedOutputs).NamedOutputs(); len(named) != 1 || named[0] != "Blurred" {
+		t.Fatalf("Unexpected named outputs %v\n", named)
+	}
+}
+
+func TestGroupInclude(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.png")
+
+	inner := fmt.Sprintf(`{"Id": "load", "Name": "Load", "Options": {"Path": %q}}`, tests.TestDataDir()+"/test.png")
+	if err := ioutil.WriteFile(filepath.Join(dir, "load.json"), []byte(inner), 0644); err != nil {
+		t.Fatalf("Error writing the included graph: %v\n", err)
+	}
+
+	def := fmt.Sprintf(`{
+		"Name": "Group",
+		"Options": {
+			"$include": %q,
+			"Outputs": {"Output": "load"}
+		},
+		"Outputs": {
+			"Output": {
+				"Name": "Group",
+				"Options": {
+					"Graph": %s,
+					"Params": {"Size": ["Scale.Width"]},
+					"Inputs": {"Input": "blur"},
+					"Outputs": {"Output": "scale"},
+					"Args": {"Size": "25%%"}
+				},
+				"Outputs": {"Output": {"Name": "Save", "Options": {"Path": %q}}}
+			}
+		}
+	}`, filepath.Join(dir, "load.json"), blurScale, out)
+
+	roots, err := drawgl.ProcessJSON(strings.NewReader(def), nil)
+	if err != nil {
+		t.Fatalf("Error reading graph: %v\n", err)
+	}
+
+	if err := (drawgl.Graph{}).Process(roots[0]); err != nil {
+		t.Fatalf("Error processing graph: %v\n", err)
+	}
+
+	b, err := drawgl.MarshalGraph(roots[0])
+	if err != nil {
+		t.Fatalf("Error encoding graph: %v\n", err)
+	}
+
+	if !strings.Contains(string(b), `"$include"`) {
+		t.Fatalf("Expected the include to be preserved in\n%s\n", b)
+	}
+
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatalf("Error opening the output: %v\n", err)
+	}
+	defer f.Close()
+
+	c, _, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatalf("Error decoding the output: %v\n", err)
+	}
+
+	if c.Width != 1 || c.Height != 2 {
+		t.Fatalf("Expected a 1x2 output, got %dx%d\n", c.Width, c.Height)
+	}
+}
+
+func TestGroupIncludeRelative(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"load.json": fmt.Sprintf(`{"Id": "load", "Name": "Load", "Options": {"Path": %q}}`, tests.TestDataDir()+"/test.png"),
+		"outer.json": `{
+			"Graph": {"Id": "inner", "Name": "Group", "Options": {"$include": "load.json", "Outputs": {"Output": "load"}}},
+			"Outputs": {"Output": "inner"}
+		}`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing %s: %v\n", name, err)
+		}
+	}
+
+	// Includes are resolved against the including file, not the working
+	// directory
+	t.Chdir(t.TempDir())
+
+	if _, err := group.NewGroupLinker(group.GroupOptions{Include: filepath.Join(dir, "outer.json")}); err != nil {
+		t.Fatalf("Error creating a group linker: %v\n", err)
+	}
+
+	o, err := group.IncludedFrom(filepath.Join(dir, "graph.json"))
+	if err != nil {
+		t.Fatalf("Error creating the include override: %v\n", err)
+	}
+
+	def := `{"Name": "Group", "Options": {"$include": "outer.json"}}`
+	if _, err := drawgl.ProcessJSON(strings.NewReader(def), nil, o); err != nil {
+		t.Fatalf("Error reading graph: %v\n", err)
+	}
+
+	// The override is optional
+	if _, err := drawgl.ProcessJSON(strings.NewReader(blurScale), nil, o); err != nil {
+		t.Fatalf("Error reading graph without groups: %v\n", err)
+	}
+}
+
+func TestGroupIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"self.json": `{"Id": "g", "Name": "Group", "Options": {"$include": "self.json"}}`,
+		"a.json":    `{"Id": "g", "Name": "Group", "Options": {"$include": "b.json"}}`,
+		"b.json":    `{"Id": "g", "Name": "Group", "Options": {"$include": "a.json"}}`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing %s: %v\n", name, err)
+		}
+	}
+
+	for _, name := range []string{"self.json", "a.json"} {
+		_, err := group.NewGroupLinker(group.GroupOptions{Include: filepath.Join(dir, name)})
+
+		var verr *drawgl.ValidationError
+		if !errors.As(err, &verr) || !strings.Contains(err.Error(), "include cycle") {
+			t.Fatalf("Expected an include cycle error for %s, got %v\n", name, err)
+		}
+	}
+}
+
+func TestGroupGraphConfiguration(t *testing.T) {
+	def := fmt.Sprintf(`{
+		"Name": "Load",
+		"Options": {"Path": %q},
+		"Outputs": {
+			"Output": {
+				"Name": "Group",
+				"Options": {
+					"Graph": %s,
+					"Inputs": {"Input": "blur"},
+					"Outputs": {"Output": "scale"}
+				}
+			}
+		}
+	}`, tests.TestDataDir()+"/test.png", blurScale)
+
+	roots, err := drawgl.ProcessJSON(strings.NewReader(def), nil)
+	if err != nil {
+		t.Fatalf("Error reading graph: %v\n", err)
+	}
+
+	var mu sync.Mutex
+	observed := make(map[string]bool)
+
+	g := drawgl.Graph{
+		Report: &drawgl.Report{},
+		Observer: func(e drawgl.Event) {
+			mu.Lock()
+			observed[e.Name] = true
+			mu.Unlock()
+		},
+	}
+	if err := g.Process(roots[0]); err != nil {
+		t.Fatalf("Error processing graph: %v\n", err)
+	}
+
+	reported := make(map[string]bool)
+	for _, s := range g.Report.Nodes() {
+		reported[s.Name] = true
+	}
+
+	// The inner nodes are processed with the outer graph's configuration
+	for _, name := range []string{"Load", "Group", "BoxBlur", "Scale"} {
+		if !reported[name] {
+			t.Fatalf("Expected %s in the report %v\n", name, g.Report.Nodes())
+		}
+
+		if !observed[name] {
+			t.Fatalf("Expected events from %s, got %v\n", name, observed)
+		}
+	}
+}
+
+func TestGroupErrors(t *testing.T) {
+	cases := []struct {
+		opts group.GroupOptions
+		err  string
+	}{
+		{group.GroupOptions{}, "missing group graph"},
+		{group.GroupOptions{Include: "missing.json"}, "including group"},
+		{group.GroupOptions{
+			Definition: group.Definition{Graph: json.RawMessage(blurScale)},
+			Args:       map[string]json.RawMessage{"Size": json.RawMessage("1")},
+		}, "unknown parameter"},
+		{group.GroupOptions{
+			Definition: group.Definition{Graph: json.RawMessage(blurScale), Params: map[string][]string{"Size": {"Crop.Width"}}},
+		}, "no node matches"},
+		{group.GroupOptions{
+			Definition: group.Definition{Graph: json.RawMessage(blurScale), Inputs: map[graph.ConnectorName]string{graph.InputName: "missing"}},
+		}, "unknown node id"},
+		{group.GroupOptions{
+			Definition: group.Definition{Graph: json.RawMessage(blurScale), Outputs: map[graph.ConnectorName]string{graph.OutputName: "scale."}},
+		}, "invalid connection"},
+	}
+
+	for i, c := range cases {
+		_, err := group.NewGroupLinker(c.opts)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("Case %d: expected an error mentioning %q, got %v\n", i, c.err, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package io_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/operation/io"
+	"github.com/urandom/drawgl/operation/tests"
+	"github.com/urandom/graph"
+)
+
+func TestTransparent(t *testing.T) {
+	// A straight white png, whose transparent pixels hold red
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			if x < 8 {
+				nrgba.SetNRGBA(x, y, color.NRGBA{R: 255})
+			} else {
+				nrgba.SetNRGBA(x, y, color.NRGBA{R: 255, G: 255, B: 255, A: uint8(x * 8)})
+			}
+		}
+	}
+
+	var in bytes.Buffer
+	if err := png.Encode(&in, nrgba); err != nil {
+		t.Fatalf("Error encoding png: %v\n", err)
+	}
+
+	for _, cs := range []drawgl.ColorSpace{drawgl.LinearSRGB, drawgl.SRGB} {
+		load, err := io.NewLoadLinker(io.LoadOptions{Reader: bytes.NewReader(in.Bytes()), ColorSpace: cs})
+		if err != nil {
+			t.Fatalf("Error creating load linker: %v\n", err)
+		}
+
+		p, wd, output := tests.PrepareLinker(load)
+
+		go p.Process(context.Background(), wd, map[graph.ConnectorName]drawgl.Result{}, output)
+
+		r := <-output
+		if r.Error != nil {
+			t.Fatalf("Error loading: %v\n", r.Error)
+		}
+
+		tests.CheckWhite(t, "Load "+cs.String(), r.Buffer, drawgl.Premultiplied)
+	}
+
+	saved := map[drawgl.AlphaMode]*drawgl.FloatImage{}
+	for _, mode := range []drawgl.AlphaMode{drawgl.Premultiplied, drawgl.Straight} {
+		var out bytes.Buffer
+		save, err := io.NewSaveLinker(io.SaveOptions{Writer: &out, Type: "png"})
+		if err != nil {
+			t.Fatalf("Error creating save linker: %v\n", err)
+		}
+
+		tests.ProcessImage(t, save, tests.TransparentImage(32, 32, mode))
+
+		img, err := png.Decode(&out)
+		if err != nil {
+			t.Fatalf("Error decoding the saved png: %v\n", err)
+		}
+
+		saved[mode] = drawgl.ConvertImage(img)
+		saved[mode].ColorSpace = drawgl.LinearSRGB
+
+		tests.CheckWhite(t, "Save "+mode.String(), saved[mode], drawgl.Premultiplied)
+	}
+
+	// Straight images are encoded with the colors of their premultiplied
+	// form
+	tests.CheckVisible(t, "Save straight", saved[drawgl.Straight], saved[drawgl.Premultiplied])
+}
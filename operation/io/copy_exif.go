@@ -1,6 +1,7 @@
 package io
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -18,6 +19,8 @@ const (
 	Exiftool ExecType = iota
 )
 
+// CopyExif copies the exif metadata of a file into a saved jpeg. It works
+// on the files alone, and outputs no buffer.
 type CopyExif struct {
 	base.Node
 	opts CopyExifOptions
@@ -34,7 +37,7 @@ func NewCopyExifLinker(opts CopyExifOptions) graph.Linker {
 	return base.NewLinkerNode(CopyExif{Node: base.NewNode(), opts: opts})
 }
 
-func (n CopyExif) Process(wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+func (n CopyExif) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
 	var err error
 	res := drawgl.Result{Id: n.Id()}
 
@@ -118,11 +121,29 @@ func (n CopyExif) Process(wd graph.WalkData, buffers map[graph.ConnectorName]dra
 	}
 }
 
+func (n CopyExif) Definition() (string, interface{}) {
+	return "CopyExif", n.opts
+}
+
+var copyExifDescriptor = drawgl.Descriptor{
+	Name: "CopyExif",
+	Doc: `Copies the exif data of the loaded jpeg file to the saved one, using exiftool.
+The paths default to the ones stored in the metadata by Load and Save.`,
+	Inputs:  []drawgl.ConnectorDescriptor{{Name: graph.InputName, Doc: "the result of a Save node"}},
+	Outputs: []drawgl.ConnectorDescriptor{{Name: graph.OutputName, Doc: "the input metadata"}},
+	Options: []drawgl.OptionDescriptor{
+		{Name: "Executable", Type: drawgl.StringOption, Default: "exiftool", Doc: "the executable used to copy the data"},
+		{Name: "ExecutableType", Type: drawgl.IntegerOption, Default: 0, Doc: "the kind of the executable, 0 for exiftool"},
+		{Name: "InputPath", Type: drawgl.StringOption, Doc: "the file the data is copied from"},
+		{Name: "OutputPath", Type: drawgl.StringOption, Doc: "the file the data is copied to"},
+	},
+}
+
 func init() {
-	graph.RegisterLinker("CopyExif", func(opts json.RawMessage) (graph.Linker, error) {
+	drawgl.RegisterOperation(copyExifDescriptor, func(opts json.RawMessage) (graph.Linker, error) {
 		var o CopyExifOptions
 
-		if err := json.Unmarshal([]byte(opts), &o); err != nil {
+		if err := drawgl.UnmarshalOptions(opts, &o); err != nil {
 			return nil, fmt.Errorf("constructing CopyExif: %v", err)
 		}
 
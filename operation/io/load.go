@@ -1,6 +1,7 @@
 package io
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -22,6 +23,7 @@ const (
 	InputFormat = "input-format"
 )
 
+// Load decodes an image, with premultiplied alpha.
 type Load struct {
 	base.Node
 	opts LoadOptions
@@ -30,6 +32,9 @@ type Load struct {
 type LoadOptions struct {
 	Reader io.Reader
 	Path   string
+	// ColorSpace is the color space the image is converted into. Image files
+	// are sRGB encoded, and are decoded into linear light by default.
+	ColorSpace drawgl.ColorSpace
 }
 
 func NewLoadLinker(opts LoadOptions) (graph.Linker, error) {
@@ -39,7 +44,20 @@ func NewLoadLinker(opts LoadOptions) (graph.Linker, error) {
 	return base.NewLinkerNode(Load{Node: base.NewNode(), opts: opts}), nil
 }
 
-func (n Load) Process(wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+// MarshalJSON encodes the options in the form accepted by the Load linker
+// factory. Options with a reader cannot be encoded.
+func (o LoadOptions) MarshalJSON() ([]byte, error) {
+	if o.Reader != nil {
+		return nil, errors.New("a load reader cannot be encoded as json")
+	}
+
+	return json.Marshal(struct {
+		Path       string
+		ColorSpace drawgl.ColorSpace
+	}{o.Path, o.ColorSpace})
+}
+
+func (n Load) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
 	var err error
 	res := drawgl.Result{Id: n.Id()}
 
@@ -69,15 +87,47 @@ func (n Load) Process(wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.
 	img, res.Meta[InputFormat], err = image.Decode(reader)
 
 	if err == nil {
-		res.Buffer = drawgl.ConvertImage(img)
+		res.Buffer = drawgl.ConvertColorSpace(drawgl.ConvertImage(img), n.opts.ColorSpace)
+	}
+}
+
+// Hash identifies the loaded image by its path, size, modification time and
+// color space.
+// Images loaded from a reader are not cached.
+func (n Load) Hash() string {
+	if n.opts.Reader != nil {
+		return ""
 	}
+
+	fi, err := os.Stat(n.opts.Path)
+	if err != nil {
+		return ""
+	}
+
+	return drawgl.HashOptions("Load", fmt.Sprintf("%s:%d:%d:%s", n.opts.Path, fi.Size(), fi.ModTime().UnixNano(), n.opts.ColorSpace))
+}
+
+func (n Load) Definition() (string, interface{}) {
+	return "Load", n.opts
+}
+
+var loadDescriptor = drawgl.Descriptor{
+	Name: "Load",
+	Doc: `Loads an image from a file.
+The path and format of the image are stored in the metadata of the result.`,
+	Outputs: []drawgl.ConnectorDescriptor{{Name: graph.OutputName, Doc: "the loaded image"}},
+	Options: []drawgl.OptionDescriptor{
+		{Name: "Path", Type: drawgl.StringOption, Required: true, Doc: "the path of the image"},
+		{Name: "ColorSpace", Type: drawgl.StringOption, Default: "linear-srgb", Enum: drawgl.ColorSpaceNames,
+			Doc: "the color space the image is converted into"},
+	},
 }
 
 func init() {
-	graph.RegisterLinker("Load", func(opts json.RawMessage) (graph.Linker, error) {
+	drawgl.RegisterOperation(loadDescriptor, func(opts json.RawMessage) (graph.Linker, error) {
 		var o LoadOptions
 
-		if err := json.Unmarshal([]byte(opts), &o); err != nil {
+		if err := drawgl.UnmarshalOptions(opts, &o); err != nil {
 			return nil, fmt.Errorf("constructing Load: %v", err)
 		}
 
@@ -1,6 +1,8 @@
 package io_test
 
 import (
+	"bytes"
+	"context"
 	"testing"
 
 	"github.com/urandom/drawgl"
@@ -10,7 +12,7 @@ import (
 )
 
 func TestLoadJpg(t *testing.T) {
-	jpg, err := io.NewLoadLinker(io.LoadOptions{Path: tests.TestDataDir() + "/test.jpg"})
+	jpg, err := io.NewLoadLinker(io.LoadOptions{Path: tests.TestDataDir() + "/test.jpg", ColorSpace: drawgl.SRGB})
 	if err != nil {
 		t.Fatalf("Error opening jpeg: %v\n", err)
 	}
@@ -18,7 +20,7 @@ func TestLoadJpg(t *testing.T) {
 	pb := make(map[graph.ConnectorName]drawgl.Result)
 	p, wd, output := tests.PrepareLinker(jpg)
 
-	go p.Process(wd, pb, output)
+	go p.Process(context.Background(), wd, pb, output)
 
 	r := <-output
 
@@ -70,7 +72,7 @@ func TestLoadPng(t *testing.T) {
 }
 
 func TestLoadGif(t *testing.T) {
-	jpg, err := io.NewLoadLinker(io.LoadOptions{Path: tests.TestDataDir() + "/test.gif"})
+	jpg, err := io.NewLoadLinker(io.LoadOptions{Path: tests.TestDataDir() + "/test.gif", ColorSpace: drawgl.SRGB})
 	if err != nil {
 		t.Fatalf("Error opening gif: %v\n", err)
 	}
@@ -78,7 +80,7 @@ func TestLoadGif(t *testing.T) {
 	pb := make(map[graph.ConnectorName]drawgl.Result)
 	p, wd, output := tests.PrepareLinker(jpg)
 
-	go p.Process(wd, pb, output)
+	go p.Process(context.Background(), wd, pb, output)
 
 	r := <-output
 
@@ -123,3 +125,72 @@ func testColorJpeg(c, exp drawgl.FloatColor) bool {
 
 	return true
 }
+
+func TestLoadLinear(t *testing.T) {
+	png, err := io.NewLoadLinker(io.LoadOptions{Path: tests.TestDataDir() + "/test.png"})
+	if err != nil {
+		t.Fatalf("Error opening png: %v\n", err)
+	}
+
+	p, wd, output := tests.PrepareLinker(png)
+
+	go p.Process(context.Background(), wd, map[graph.ConnectorName]drawgl.Result{}, output)
+
+	r := <-output
+
+	if r.Error != nil {
+		t.Fatalf("Error processing: %v\n", r.Error)
+	}
+
+	if r.Buffer.ColorSpace != drawgl.LinearSRGB {
+		t.Fatalf("Expected a linear buffer, got %s\n", r.Buffer.ColorSpace)
+	}
+
+	colors := tests.Colors()
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			e := drawgl.ConvertColor(colors[y][x], drawgl.SRGB, drawgl.LinearSRGB)
+			if c := r.Buffer.FloatAt(x, y); !c.ApproxEqual(e) {
+				t.Fatalf("At %d:%d, color %v doesn't match %v\n", x, y, c, e)
+			}
+		}
+	}
+
+	// Saving encodes the linear values back
+	var out bytes.Buffer
+	save, err := io.NewSaveLinker(io.SaveOptions{Writer: &out, Type: "png"})
+	if err != nil {
+		t.Fatalf("Error creating save linker: %v\n", err)
+	}
+
+	p, wd, output = tests.PrepareLinker(save)
+
+	go p.Process(context.Background(), wd, map[graph.ConnectorName]drawgl.Result{graph.InputName: r}, output)
+
+	if r := <-output; r.Error != nil {
+		t.Fatalf("Error saving: %v\n", r.Error)
+	}
+
+	load, err := io.NewLoadLinker(io.LoadOptions{Reader: &out, ColorSpace: drawgl.SRGB})
+	if err != nil {
+		t.Fatalf("Error creating load linker: %v\n", err)
+	}
+
+	p, wd, output = tests.PrepareLinker(load)
+
+	go p.Process(context.Background(), wd, map[graph.ConnectorName]drawgl.Result{}, output)
+
+	r = <-output
+
+	if r.Error != nil {
+		t.Fatalf("Error loading: %v\n", r.Error)
+	}
+
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if c := r.Buffer.FloatAt(x, y); !c.ApproxEqual(colors[y][x]) {
+				t.Fatalf("At %d:%d, saved color %v doesn't match %v\n", x, y, c, colors[y][x])
+			}
+		}
+	}
+}
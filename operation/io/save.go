@@ -1,6 +1,7 @@
 package io
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -23,6 +24,8 @@ const (
 	OutputFormat = "output-format"
 )
 
+// Save encodes an image. Images with straight alpha are premultiplied
+// while encoding, as the image encoders expect.
 type Save struct {
 	base.Node
 	opts SaveOptions
@@ -43,7 +46,22 @@ func NewSaveLinker(opts SaveOptions) (graph.Linker, error) {
 	return base.NewLinkerNode(Save{Node: base.NewNode(), opts: opts}), nil
 }
 
-func (n Save) Process(wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+// MarshalJSON encodes the options in the form accepted by the Save linker
+// factory. Options with a writer cannot be encoded.
+func (o SaveOptions) MarshalJSON() ([]byte, error) {
+	if o.Writer != nil {
+		return nil, errors.New("a save writer cannot be encoded as json")
+	}
+
+	return json.Marshal(struct {
+		Path        string
+		Type        string        `json:",omitempty"`
+		JpegOptions *jpeg.Options `json:",omitempty"`
+		GifOptions  *gif.Options  `json:",omitempty"`
+	}{o.Path, o.Type, o.JpegOptions, o.GifOptions})
+}
+
+func (n Save) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
 	var err error
 	res := drawgl.Result{Id: n.Id()}
 
@@ -58,6 +76,9 @@ func (n Save) Process(wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.
 
 	r := buffers[graph.InputName]
 	res.Meta = r.Meta
+	if res.Meta == nil {
+		res.Meta = drawgl.Meta{}
+	}
 	if r.Buffer == nil {
 		err = fmt.Errorf("no input buffer")
 		return
@@ -74,6 +95,13 @@ func (n Save) Process(wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.
 		}
 	}
 
+	// Image files hold encoded values. Buffers in linear light are encoded
+	// with sRGB, while ones in other color spaces are written as they are.
+	buf := r.Buffer
+	if buf.ColorSpace.Linear() {
+		buf = drawgl.ConvertColorSpace(buf, drawgl.SRGB)
+	}
+
 	w := n.opts.Writer
 	if w == nil && n.opts.Path != "" {
 		w, err = os.Create(n.opts.Path)
@@ -90,22 +118,54 @@ func (n Save) Process(wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.
 		res.Meta[OutputPath] = n.opts.Path
 		switch kind {
 		case "jpeg":
-			jpeg.Encode(w, r.Buffer, n.opts.JpegOptions)
+			err = jpeg.Encode(w, buf, n.opts.JpegOptions)
 		case "png":
-			png.Encode(w, r.Buffer)
+			err = png.Encode(w, buf)
 		case "gif":
-			gif.Encode(w, r.Buffer, n.opts.GifOptions)
+			err = gif.Encode(w, buf, n.opts.GifOptions)
 		default:
 			err = fmt.Errorf("unknown format %s", kind)
 		}
 	}
 }
 
+func (n Save) Definition() (string, interface{}) {
+	return "Save", n.opts
+}
+
+var saveDescriptor = drawgl.Descriptor{
+	Name: "Save",
+	Doc: `Saves the image to a file.
+Images in linear light are encoded with sRGB, others are written as they are.
+The path and format of the file are stored in the metadata of the result.`,
+	Inputs:  []drawgl.ConnectorDescriptor{{Name: graph.InputName, Doc: "the image to save"}},
+	Outputs: []drawgl.ConnectorDescriptor{{Name: graph.OutputName, Doc: "the metadata of the saved image"}},
+	Options: []drawgl.OptionDescriptor{
+		{Name: "Path", Type: drawgl.StringOption, Required: true, Doc: "the path of the file"},
+		{
+			Name: "Type", Type: drawgl.StringOption, Enum: []string{"jpeg", "png", "gif"},
+			Doc: "the format of the file, defaulting to the one of the path's extension, or jpeg",
+		},
+		{
+			Name: "JpegOptions", Type: drawgl.ObjectOption, Fields: []drawgl.OptionDescriptor{
+				{Name: "Quality", Type: drawgl.IntegerOption, Default: jpeg.DefaultQuality, Doc: "the quality, from 1 to 100"},
+			},
+			Doc: "the options of the jpeg encoder",
+		},
+		{
+			Name: "GifOptions", Type: drawgl.ObjectOption, Fields: []drawgl.OptionDescriptor{
+				{Name: "NumColors", Type: drawgl.IntegerOption, Default: 256, Doc: "the maximum number of colors, from 1 to 256"},
+			},
+			Doc: "the options of the gif encoder",
+		},
+	},
+}
+
 func init() {
-	graph.RegisterLinker("Save", func(opts json.RawMessage) (graph.Linker, error) {
+	drawgl.RegisterOperation(saveDescriptor, func(opts json.RawMessage) (graph.Linker, error) {
 		var o SaveOptions
 
-		if err := json.Unmarshal([]byte(opts), &o); err != nil {
+		if err := drawgl.UnmarshalOptions(opts, &o); err != nil {
 			return nil, fmt.Errorf("constructing Save: %v", err)
 		}
 
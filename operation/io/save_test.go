@@ -0,0 +1,36 @@
+package io_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/operation/io"
+	"github.com/urandom/drawgl/operation/tests"
+	"github.com/urandom/graph"
+)
+
+type failingWriter struct{}
+
+func (w failingWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestSaveEncodeError(t *testing.T) {
+	for _, kind := range []string{"jpeg", "png", "gif"} {
+		l, err := io.NewSaveLinker(io.SaveOptions{Writer: failingWriter{}, Type: kind})
+		if err != nil {
+			t.Fatalf("Error creating a %s save linker: %v\n", kind, err)
+		}
+
+		p, wd, output := tests.PrepareLinker(l)
+		go p.Process(context.Background(), wd, map[graph.ConnectorName]drawgl.Result{
+			graph.InputName: {Buffer: tests.PatternImage(4, 4)},
+		}, output)
+
+		if r := <-output; r.Error == nil {
+			t.Fatalf("Expected a %s write error\n", kind)
+		}
+	}
+}
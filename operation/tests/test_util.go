@@ -1,7 +1,9 @@
 package tests
 
 import (
+	"context"
 	"fmt"
+	"image"
 	"os"
 	"strings"
 	"testing"
@@ -63,7 +65,7 @@ func TestDataDir() string {
 }
 
 func ReadTestData() (*drawgl.FloatImage, error) {
-	jpg, err := io.NewLoadLinker(io.LoadOptions{Path: TestDataDir() + "/test.png"})
+	jpg, err := io.NewLoadLinker(io.LoadOptions{Path: TestDataDir() + "/test.png", ColorSpace: drawgl.SRGB})
 	if err != nil {
 		return nil, err
 	}
@@ -71,7 +73,7 @@ func ReadTestData() (*drawgl.FloatImage, error) {
 	pb := make(map[graph.ConnectorName]drawgl.Result)
 	p, wd, output := PrepareLinker(jpg)
 
-	go p.Process(wd, pb, output)
+	go p.Process(context.Background(), wd, pb, output)
 
 	r := <-output
 
@@ -92,3 +94,223 @@ func ImageBuffers(t *testing.T) map[graph.ConnectorName]drawgl.Result {
 		graph.InputName: drawgl.Result{Buffer: img},
 	}
 }
+
+// PatternImage returns an opaque image of the given size, filled with a
+// repeating pattern.
+func PatternImage(width, height int) *drawgl.FloatImage {
+	img := drawgl.NewFloatImage(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := drawgl.ColorValue((x*7+y*13)%32) / 32
+			img.UnsafeSetColor(x, y, drawgl.FloatColor{R: v, G: 1 - v, B: v / 2, A: 1})
+		}
+	}
+
+	return img
+}
+
+// BenchmarkTiles processes the whole source image with the linker's tile
+// processor b.N times.
+func BenchmarkTiles(b *testing.B, l graph.Linker, src *drawgl.FloatImage) {
+	p, ok := l.Node().(drawgl.TileProcessor)
+	if !ok {
+		b.Fatalf("%T is not a tile processor\n", l.Node())
+	}
+
+	bounds := src.Bounds()
+	rect := p.TileBounds(bounds)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.ProcessTile(context.Background(), src, bounds, rect); err != nil {
+			b.Fatalf("Error processing: %v\n", err)
+		}
+	}
+}
+
+// BenchmarkIterate processes the whole source image with fn b.N times, so
+// that an implementation built on the per-pixel iterators can be compared
+// with the linker's tile processor on the same input. The output of fn has
+// to match the one of the tile processor.
+func BenchmarkIterate(b *testing.B, l graph.Linker, src *drawgl.FloatImage, fn func(ctx context.Context, src *drawgl.FloatImage) (*drawgl.FloatImage, error)) {
+	p, ok := l.Node().(drawgl.TileProcessor)
+	if !ok {
+		b.Fatalf("%T is not a tile processor\n", l.Node())
+	}
+
+	bounds := src.Bounds()
+	exp, err := p.ProcessTile(context.Background(), src, bounds, p.TileBounds(bounds))
+	if err != nil {
+		b.Fatalf("Error processing: %v\n", err)
+	}
+
+	buf, err := fn(context.Background(), src)
+	if err != nil {
+		b.Fatalf("Error iterating: %v\n", err)
+	}
+
+	if buf.Bounds() != exp.Bounds() {
+		b.Fatalf("Expected bounds %v, got %v\n", exp.Bounds(), buf.Bounds())
+	}
+
+	eb := exp.Bounds()
+	for y := eb.Min.Y; y < eb.Max.Y; y++ {
+		for x := eb.Min.X; x < eb.Max.X; x++ {
+			if c, e := buf.FloatAt(x, y), exp.FloatAt(x, y); !c.ApproxEqual(e) {
+				b.Fatalf("At %d:%d, color %v doesn't match %v\n", x, y, c, e)
+			}
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := fn(context.Background(), src); err != nil {
+			b.Fatalf("Error iterating: %v\n", err)
+		}
+	}
+}
+
+// TransparentImage returns a white image of the given size, in the given
+// alpha mode, whose alpha fades in from a fully transparent left quarter.
+// Transparent pixels hold red with straight alpha, so operations that
+// filter straight colors produce tinted fringes.
+func TransparentImage(width, height int, mode drawgl.AlphaMode) *drawgl.FloatImage {
+	img := drawgl.NewFloatImage(image.Rect(0, 0, width, height))
+	img.Alpha = drawgl.Straight
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := drawgl.FloatColor{R: 1, G: 1, B: 1}
+			if x < width/4 {
+				c.G, c.B = 0, 0
+			} else {
+				c.A = drawgl.ColorValue(x-width/4+1+y%3) / drawgl.ColorValue(width/2)
+				if c.A > 1 {
+					c.A = 1
+				}
+			}
+
+			img.UnsafeSetColor(x, y, c)
+		}
+	}
+
+	return drawgl.ConvertAlpha(img, mode)
+}
+
+// TransparentCase describes a linker checked by CheckTransparent.
+type TransparentCase struct {
+	Name   string
+	Linker func() (graph.Linker, error)
+	// Straight, if not nil, checks the output of the straight input, buf,
+	// against the input, src.
+	Straight func(t *testing.T, name string, src, buf *drawgl.FloatImage)
+}
+
+// CheckTransparent processes a TransparentImage in both alpha modes with the
+// linker of every case, and checks each output with CheckWhite, and the
+// straight ones with the Straight function of their case.
+func CheckTransparent(t *testing.T, cases []TransparentCase) {
+	for _, c := range cases {
+		for _, mode := range []drawgl.AlphaMode{drawgl.Premultiplied, drawgl.Straight} {
+			l, err := c.Linker()
+			if err != nil {
+				t.Fatalf("Error creating a %s linker: %v\n", c.Name, err)
+			}
+
+			name := c.Name + " " + mode.String()
+			src := TransparentImage(32, 32, mode)
+			buf := ProcessImage(t, l, src)
+
+			CheckWhite(t, name, buf, mode)
+			if mode == drawgl.Straight && c.Straight != nil {
+				c.Straight(t, name, src, buf)
+			}
+		}
+	}
+}
+
+// CheckWhite fails the test if the image, derived from a TransparentImage,
+// lost its alpha mode, or if any of its visible pixels is no longer white.
+func CheckWhite(t *testing.T, name string, img *drawgl.FloatImage, mode drawgl.AlphaMode) {
+	if img.Alpha != mode {
+		t.Fatalf("%s: expected %s alpha, got %s\n", name, mode, img.Alpha)
+	}
+
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.UnsafeFloatAt(x, y)
+			if mode == drawgl.Premultiplied {
+				c = c.Unpremultiply()
+			}
+
+			if c.A < -0.001 || c.A > 1.001 {
+				t.Fatalf("%s: alpha %f at %d:%d out of range\n", name, c.A, x, y)
+			}
+
+			// Nearly transparent pixels lose precision when unpremultiplied
+			if c.A > 0.01 && !c.ApproxEqual(drawgl.FloatColor{R: 1, G: 1, B: 1, A: c.A}) {
+				t.Fatalf("%s: expected white at %d:%d, got %v\n", name, x, y, c)
+			}
+		}
+	}
+}
+
+// SameAlpha fails the test if the alpha of any pixel of buf differs from
+// the one of src.
+func SameAlpha(t *testing.T, name string, src, buf *drawgl.FloatImage) {
+	b := buf.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if a, e := buf.UnsafeFloatAt(x, y).A, src.FloatAt(x, y).A; a-e > 0.001 || e-a > 0.001 {
+				t.Fatalf("%s: expected alpha %f at %d:%d, got %f\n", name, e, x, y, a)
+			}
+		}
+	}
+}
+
+// CheckVisible fails the test if buf and exp differ in their bounds, alpha
+// mode, or in the color of any pixel that isn't nearly transparent.
+func CheckVisible(t *testing.T, name string, buf, exp *drawgl.FloatImage) {
+	if buf.Bounds() != exp.Bounds() || buf.Alpha != exp.Alpha {
+		t.Fatalf("%s: expected a %s %v image, got a %s %v one\n", name, exp.Alpha, exp.Bounds(), buf.Alpha, buf.Bounds())
+	}
+
+	b := exp.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c, e := buf.UnsafeFloatAt(x, y), exp.UnsafeFloatAt(x, y)
+			if e.A > 0.01 && !c.ApproxEqual(e) {
+				t.Fatalf("%s: at %d:%d, color %v doesn't match %v\n", name, x, y, c, e)
+			}
+		}
+	}
+}
+
+// HalfMask returns a mask limited to the rectangle, which blends the
+// results of an operation half way with the original colors.
+func HalfMask(rect image.Rectangle) drawgl.Mask {
+	half := image.NewAlpha(rect)
+	for i := range half.Pix {
+		half.Pix[i] = 128
+	}
+
+	return drawgl.NewMask(half, rect)
+}
+
+// ProcessImage processes the image with the linker, connected to its main
+// input, and returns the output buffer.
+func ProcessImage(t *testing.T, l graph.Linker, img *drawgl.FloatImage) *drawgl.FloatImage {
+	p, wd, output := PrepareLinker(l)
+
+	go p.Process(context.Background(), wd, map[graph.ConnectorName]drawgl.Result{
+		graph.InputName: {Buffer: img},
+	}, output)
+
+	r := <-output
+	if r.Error != nil {
+		t.Fatalf("Error processing: %v\n", r.Error)
+	}
+
+	return r.Buffer
+}
@@ -0,0 +1,81 @@
+package transform_test
+
+import (
+	"image"
+	"testing"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/interpolator"
+	"github.com/urandom/drawgl/operation/tests"
+	"github.com/urandom/drawgl/operation/transform"
+	"github.com/urandom/graph"
+)
+
+func TestTransparent(t *testing.T) {
+	mask := tests.HalfMask(image.Rect(4, 4, 28, 28))
+
+	cases := []tests.TransparentCase{
+		{Name: "Crop", Straight: movesPixels(func(x, y int) (int, int) { return x, y }), Linker: func() (graph.Linker, error) {
+			return transform.NewCropLinker(transform.CropOptions{Min: [2]int{4, 4}, Max: [2]int{20, 20}})
+		}},
+		{Name: "Transform", Straight: movesPixels(func(x, y int) (int, int) { return 31 - x, y }), Linker: func() (graph.Linker, error) {
+			return transform.NewTransformLinker(transform.TransformOptions{Operator: transform.FlipHOperator})
+		}},
+		{Name: "masked Transform", Linker: func() (graph.Linker, error) {
+			return transform.NewTransformLinker(transform.TransformOptions{Operator: transform.TransposeOperator, Mask: mask})
+		}},
+		{Name: "Rotate", Linker: func() (graph.Linker, error) {
+			return transform.NewRotateLinker(transform.RotateOptions{Degrees: 30})
+		}},
+		{Name: "masked Rotate", Linker: func() (graph.Linker, error) {
+			return transform.NewRotateLinker(transform.RotateOptions{Degrees: 30, Mask: mask})
+		}},
+		{Name: "Translate", Linker: func() (graph.Linker, error) {
+			return transform.NewTranslateLinker(transform.TranslateOptions{OffsetPercent: [2]float64{0.1, 0.05}})
+		}},
+	}
+
+	for _, kind := range interpolator.Kinds {
+		kind := kind
+		cases = append(cases, tests.TransparentCase{Name: "Scale " + kind, Linker: func() (graph.Linker, error) {
+			return transform.NewScaleLinker(transform.ScaleOptions{WidthPercent: 0.6, HeightPercent: 0.6, Crop: true, Interpolator: kind})
+		}})
+	}
+
+	for i := range cases {
+		if cases[i].Straight == nil {
+			cases[i].Straight = interpolatesPremultiplied(cases[i].Linker)
+		}
+	}
+
+	tests.CheckTransparent(t, cases)
+}
+
+// movesPixels checks that every visible pixel of a straight image was
+// copied without resampling, from the source point given by the function.
+func movesPixels(from func(x, y int) (int, int)) func(t *testing.T, name string, src, buf *drawgl.FloatImage) {
+	return func(t *testing.T, name string, src, buf *drawgl.FloatImage) {
+		b := buf.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if c, e := buf.FloatAt(x, y), src.FloatAt(from(x, y)); e.A > 0 && !c.ApproxEqual(e) {
+					t.Fatalf("%s: at %d:%d, color %v doesn't match %v\n", name, x, y, c, e)
+				}
+			}
+		}
+	}
+}
+
+// interpolatesPremultiplied checks that the straight image was interpolated
+// as the premultiplied one is.
+func interpolatesPremultiplied(linker func() (graph.Linker, error)) func(t *testing.T, name string, src, buf *drawgl.FloatImage) {
+	return func(t *testing.T, name string, src, buf *drawgl.FloatImage) {
+		l, err := linker()
+		if err != nil {
+			t.Fatalf("Error creating a %s linker: %v\n", name, err)
+		}
+
+		exp := tests.ProcessImage(t, l, drawgl.ConvertAlpha(src, drawgl.Premultiplied))
+		tests.CheckVisible(t, name, buf, drawgl.ConvertAlpha(exp, drawgl.Straight))
+	}
+}
@@ -0,0 +1,182 @@
+package transform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/graph"
+	"github.com/urandom/graph/base"
+)
+
+// Crop cuts a rectangle out of the image, in any alpha mode.
+type Crop struct {
+	base.Node
+
+	opts CropOptions
+}
+
+type CropOptions struct {
+	Min, Max               [2]int
+	MinPercent, MaxPercent [2]float64
+}
+
+type jsonCropOptions struct {
+	CropOptions
+	Min, Max [2]drawgl.Length
+}
+
+func NewCropLinker(opts CropOptions) (graph.Linker, error) {
+	if opts.Max == [2]int{} && opts.MaxPercent == [2]float64{} {
+		return nil, errors.New("no crop rectangle")
+	}
+
+	return base.NewLinkerNode(Crop{
+		Node: base.NewNode(),
+		opts: opts,
+	}), nil
+}
+
+// MarshalJSON encodes the options in the form accepted by the Crop linker
+// factory, with the corners as pairs of lengths.
+func (o CropOptions) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Min []string `json:",omitempty"`
+		Max []string `json:",omitempty"`
+	}{formatPoint(o.Min, o.MinPercent), formatPoint(o.Max, o.MaxPercent)})
+}
+
+func (n Crop) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+	var err error
+	var buf *drawgl.FloatImage
+	res := drawgl.Result{Id: n.Id()}
+
+	defer func() {
+		res.Buffer = buf
+		if err != nil {
+			res.Error = fmt.Errorf("applying crop using %v: %v", n.opts, err)
+		}
+		output <- res
+
+		wd.Close()
+	}()
+
+	r := buffers[graph.InputName]
+	src := r.Buffer
+	res.Meta = r.Meta
+	if src == nil {
+		err = fmt.Errorf("no input buffer")
+		return
+	}
+
+	// The input is not shared with other nodes, so the output may refer to
+	// its pixels
+	buf = src.SubImage(n.TileBounds(src.Bounds())).(*drawgl.FloatImage)
+}
+
+// InPlace reports that the output of the node shares the pixels of its
+// input buffer.
+func (n Crop) InPlace() bool {
+	return true
+}
+
+func (n Crop) Hash() string {
+	return drawgl.HashOptions("Crop", n.opts)
+}
+
+func (n Crop) TileBounds(src image.Rectangle) image.Rectangle {
+	var r image.Rectangle
+	r.Min = src.Min.Add(n.point(n.opts.Min, n.opts.MinPercent, src))
+	r.Max = src.Min.Add(n.point(n.opts.Max, n.opts.MaxPercent, src))
+
+	return r.Intersect(src)
+}
+
+// TileSource requires only the tile itself, so that none of the pixels
+// outside the crop rectangle are ever computed by any preceding tile
+// processor.
+func (n Crop) TileSource(dst, src image.Rectangle) image.Rectangle {
+	return dst
+}
+
+func (n Crop) ProcessTile(ctx context.Context, src *drawgl.FloatImage, b, rect image.Rectangle) (*drawgl.FloatImage, error) {
+	return drawgl.CropImage(src, rect), nil
+}
+
+func (n Crop) point(px [2]int, percent [2]float64, b image.Rectangle) (pt image.Point) {
+	if px[0] != 0 {
+		pt.X = px[0]
+	} else if percent[0] != 0 {
+		pt.X = int(percent[0] * float64(b.Dx()))
+	}
+
+	if px[1] != 0 {
+		pt.Y = px[1]
+	} else if percent[1] != 0 {
+		pt.Y = int(percent[1] * float64(b.Dy()))
+	}
+
+	return
+}
+
+func (n Crop) Definition() (string, interface{}) {
+	return "Crop", n.opts
+}
+
+var cropDescriptor = drawgl.Descriptor{
+	Name:    "Crop",
+	Doc:     "Crops the image to a rectangle.",
+	Inputs:  []drawgl.ConnectorDescriptor{drawgl.MainInput()},
+	Outputs: []drawgl.ConnectorDescriptor{drawgl.MainOutput()},
+	Options: []drawgl.OptionDescriptor{
+		{
+			Name: "Min", Type: drawgl.ArrayOption, Size: 2, Items: &drawgl.OptionDescriptor{Type: drawgl.LengthOption},
+			Doc: "the top left corner of the rectangle",
+		},
+		{
+			Name: "Max", Type: drawgl.ArrayOption, Size: 2, Items: &drawgl.OptionDescriptor{Type: drawgl.LengthOption},
+			Doc: "the bottom right corner of the rectangle",
+		},
+	},
+}
+
+func init() {
+	drawgl.RegisterOperation(cropDescriptor, func(opts json.RawMessage) (graph.Linker, error) {
+		var o jsonCropOptions
+		var err error
+
+		if err = drawgl.UnmarshalOptions(opts, &o); err != nil {
+			return nil, fmt.Errorf("constructing Crop: %v", err)
+		}
+
+		for i := 0; i < 2; i++ {
+			if o.CropOptions.Min[i], o.CropOptions.MinPercent[i], err =
+				o.Min[i].Parse(); err != nil {
+				return nil, fmt.Errorf("constructing Crop: parsing Min[%d]: %v", i, err)
+			}
+
+			if o.CropOptions.Max[i], o.CropOptions.MaxPercent[i], err =
+				o.Max[i].Parse(); err != nil {
+				return nil, fmt.Errorf("constructing Crop: parsing Max[%d]: %v", i, err)
+			}
+		}
+
+		return NewCropLinker(o.CropOptions)
+	})
+}
+
+// formatPoint formats a point of lengths as parsed by drawgl.ParseLength, or
+// returns nil if the point is zero.
+func formatPoint(px [2]int, percent [2]float64) []string {
+	if px == [2]int{} && percent == [2]float64{} {
+		return nil
+	}
+
+	return []string{
+		drawgl.FormatLength(px[0], percent[0]),
+		drawgl.FormatLength(px[1], percent[1]),
+	}
+}
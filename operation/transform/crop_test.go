@@ -0,0 +1,46 @@
+package transform_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/urandom/drawgl/operation/tests"
+	"github.com/urandom/drawgl/operation/transform"
+)
+
+func TestCrop(t *testing.T) {
+	_, err := transform.NewCropLinker(transform.CropOptions{})
+	if err == nil {
+		t.Fatalf("Expected an error\n")
+	}
+
+	l, err := transform.NewCropLinker(transform.CropOptions{Min: [2]int{1, 1}, MaxPercent: [2]float64{0.75, 1}})
+	if err != nil {
+		t.Fatalf("Error creating a crop linker: %v\n", err)
+	}
+
+	buffers := tests.ImageBuffers(t)
+	p, wd, output := tests.PrepareLinker(l)
+
+	go p.Process(context.Background(), wd, buffers, output)
+
+	r := <-output
+	if r.Error != nil {
+		t.Fatalf("Error processing: %v\n", r.Error)
+	}
+
+	b := r.Buffer.Bounds()
+	if b.Min.X != 1 || b.Min.Y != 1 || b.Max.X != 3 || b.Max.Y != 4 {
+		t.Fatalf("Bounds don't match (1,1)-(3,4): %v", b)
+	}
+
+	exp := tests.Colors()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := r.Buffer.FloatAt(x, y)
+			if c != exp[y][x] {
+				t.Fatalf("At %d:%d, color %v doesn't match %v\n", x, y, c, exp[y][x])
+			}
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package transform
 
 import (
+	"context"
 	"image"
 	"image/draw"
 	"math"
@@ -13,62 +14,144 @@ import (
 type transformOperation struct {
 	matrix       matrix.Matrix3
 	interpolator string
+	edge         drawgl.EdgeHandler
 	dstB         image.Rectangle
 }
 
-func affine(op transformOperation, src *drawgl.FloatImage, mask drawgl.Mask, channel drawgl.Channel, forceLinear bool) (dst *drawgl.FloatImage) {
+// affineTransform holds the precomputed state of an affine transformation
+// of a source image with the given bounds
+type affineTransform struct {
+	transformOperation
+	srcB, dstB, adr image.Rectangle
+	inverse         matrix.Matrix3
+	biasedInverse   matrix.Matrix3
+	bias            image.Point
+	identity        bool
+}
+
+func newAffineTransform(op transformOperation, srcB image.Rectangle) (a affineTransform) {
+	a.transformOperation = op
+	a.srcB = srcB
+
 	if op.matrix.IsIdentity() {
-		dst = drawgl.CopyImage(src)
+		a.identity = true
+		a.dstB = srcB
 		return
 	}
 
-	srcB := src.Bounds()
-	dstB := op.dstB
-	if dstB.Empty() {
-		dstB = srcB
+	a.dstB = op.dstB
+	if a.dstB.Empty() {
+		a.dstB = srcB
+	}
+
+	a.adr = srcB.Intersect(affineTransformRect(op.matrix, srcB))
+	if a.adr.Empty() || srcB.Empty() {
+		return
+	}
+
+	a.inverse = op.matrix
+	a.inverse.Invert()
+
+	a.bias = affineTransformRect(a.inverse, a.adr).Min
+	a.bias.X--
+	a.bias.Y--
+
+	a.biasedInverse = a.inverse
+	a.biasedInverse[0][2] -= float64(a.bias.X)
+	a.biasedInverse[1][2] -= float64(a.bias.Y)
+
+	return
+}
+
+// sourceRect returns the source rectangle required to produce the given
+// destination rectangle, including the pixels read by the interpolator
+func (a affineTransform) sourceRect(rect image.Rectangle) image.Rectangle {
+	if a.identity {
+		return rect
+	}
+
+	rect = rect.Intersect(a.adr)
+	if rect.Empty() {
+		return image.Rectangle{}
+	}
+
+	if a.edge.Whole() {
+		return a.srcB.Union(rect)
 	}
 
-	adr := srcB.Intersect(affineTransformRect(op.matrix, srcB))
-	dst = drawgl.NewFloatImage(dstB)
+	pad := interpolator.Padding(a.interpolator, a.inverse)
+	sr := affineTransformRect(a.inverse, rect.Add(a.dstB.Min)).Inset(-pad)
+
+	// The original colors at the destination are also used
+	return sr.Union(rect)
+}
 
-	if adr.Empty() || srcB.Empty() {
+// apply produces the given rectangle of the transformed image. The src image
+// has to contain the rectangle returned by sourceRect. Images with straight
+// alpha are interpolated premultiplied, and converted back.
+func (a affineTransform) apply(ctx context.Context, src *drawgl.FloatImage, rect image.Rectangle, mask drawgl.Mask, channel drawgl.Channel, forceLinear bool) (dst *drawgl.FloatImage, err error) {
+	if a.identity {
+		if rect == src.Bounds() {
+			// Input buffers are read-only, and can be passed along as is
+			dst = src
+		} else {
+			dst = drawgl.CropImage(src, rect)
+		}
 		return
 	}
 
-	inverse := op.matrix
-	inverse.Invert()
+	// Interpolating straight colors bleeds the color of transparent pixels
+	if src.Alpha == drawgl.Straight {
+		if dst, err = a.apply(ctx, drawgl.ConvertAlpha(src, drawgl.Premultiplied), rect, mask, channel, forceLinear); err == nil {
+			dst = drawgl.ConvertAlpha(dst, drawgl.Straight)
+		}
+		return
+	}
 
-	bias := affineTransformRect(inverse, adr).Min
-	bias.X--
-	bias.Y--
-	inverse[0][2] -= float64(bias.X)
-	inverse[1][2] -= float64(bias.Y)
+	dst = drawgl.NewFloatImage(rect)
+	dst.ColorSpace, dst.Alpha = src.ColorSpace, src.Alpha
 
-	interpolator := interpolator.New(op.interpolator, src, inverse, bias)
+	adr := rect.Intersect(a.adr)
+	if adr.Empty() {
+		return
+	}
+
+	srcB, dstB := a.srcB, a.dstB
+	inverse, bias := a.biasedInverse, a.bias
+
+	newInterpolator := interpolator.New(a.interpolator, src, inverse, bias, a.edge)
 
 	it := drawgl.DefaultRectangleIterator(adr, forceLinear)
-	it.Iterate(mask, func(pt image.Point, f float32) {
-		if f == 0 {
-			return
-		}
+	err = it.IterateSpanWorkers(ctx, dst, mask, func() func(s drawgl.Span) {
+		interpolator := newInterpolator()
 
-		dx := float64(dstB.Min.X+pt.X) + 0.5
-		dy := float64(dstB.Min.Y+pt.Y) + 0.5
+		return func(s drawgl.Span) {
+			dy := float64(dstB.Min.Y+s.Y) + 0.5
 
-		sx := inverse[0][0]*dx + inverse[0][1]*dy + inverse[0][2]
-		sy := inverse[1][0]*dx + inverse[1][1]*dy + inverse[1][2]
+			for i, x := 0, s.Min; x < s.Max; i, x = i+1, x+1 {
+				f := s.Factor(i)
+				if f == 0 {
+					continue
+				}
 
-		if !(image.Point{int(sx) + bias.X, int(sy) + bias.Y}).In(srcB) {
-			return
-		}
+				dx := float64(dstB.Min.X+x) + 0.5
 
-		sx += float64(bias.X)
-		sy += float64(bias.Y)
+				sx := inverse[0][0]*dx + inverse[0][1]*dy + inverse[0][2]
+				sy := inverse[1][0]*dx + inverse[1][1]*dy + inverse[1][2]
 
-		orig := src.FloatAt(pt.X, pt.Y)
-		srcC := interpolator.Get(src, sx, sy)
+				if !(image.Point{int(sx) + bias.X, int(sy) + bias.Y}).In(srcB) {
+					continue
+				}
 
-		dst.UnsafeSetColor(pt.X, pt.Y, drawgl.MaskColor(orig, srcC, channel, f, draw.Over))
+				sx += float64(bias.X)
+				sy += float64(bias.Y)
+
+				orig := src.FloatAt(x, s.Y)
+				srcC := interpolator.Get(src, sx, sy)
+
+				s.Set(i, drawgl.MaskColor(orig, srcC, channel, f, draw.Over))
+			}
+		}
 	})
 
 	return
@@ -1,16 +1,21 @@
 package transform
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"image"
 	"math"
 
 	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/interpolator"
 	"github.com/urandom/drawgl/operation/transform/matrix"
 	"github.com/urandom/graph"
 	"github.com/urandom/graph/base"
 )
 
+// Rotate rotates the image around its center. The image is interpolated
+// premultiplied, with straight images converted back afterwards.
 type Rotate struct {
 	base.Node
 
@@ -22,6 +27,7 @@ type RotateOptions struct {
 	Center        [2]int
 	CenterPercent [2]float64
 	Interpolator  string
+	Edge          drawgl.EdgeHandler
 	Channel       drawgl.Channel
 	Mask          drawgl.Mask
 	Linear        bool
@@ -29,10 +35,14 @@ type RotateOptions struct {
 
 type jsonRotateOptions struct {
 	RotateOptions
-	Center [2]string
+	Center [2]drawgl.Length
 }
 
 func NewRotateLinker(opts RotateOptions) (graph.Linker, error) {
+	if !interpolator.Valid(opts.Interpolator) {
+		return nil, fmt.Errorf("unknown interpolator %q", opts.Interpolator)
+	}
+
 	opts.Channel = opts.Channel.Normalize(true)
 
 	return base.NewLinkerNode(Rotate{
@@ -41,7 +51,24 @@ func NewRotateLinker(opts RotateOptions) (graph.Linker, error) {
 	}), nil
 }
 
-func (n Rotate) Process(wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+// MarshalJSON encodes the options in the form accepted by the Rotate linker
+// factory, with the center as a pair of lengths.
+func (o RotateOptions) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Degrees      float64
+		Center       []string `json:",omitempty"`
+		Interpolator string   `json:",omitempty"`
+		Edge         drawgl.EdgeHandler
+		Channel      drawgl.Channel
+		Mask         drawgl.Mask
+		Linear       bool
+	}{
+		o.Degrees, formatPoint(o.Center, o.CenterPercent),
+		o.Interpolator, o.Edge, o.Channel, o.Mask, o.Linear,
+	})
+}
+
+func (n Rotate) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
 	var err error
 	var buf *drawgl.FloatImage
 	res := drawgl.Result{Id: n.Id()}
@@ -69,6 +96,24 @@ func (n Rotate) Process(wd graph.WalkData, buffers map[graph.ConnectorName]drawg
 		return
 	}
 
+	a := n.transform(src.Bounds())
+	buf, err = a.apply(ctx, src, a.dstB, n.opts.Mask, n.opts.Channel, n.opts.Linear)
+}
+
+func (n Rotate) TileBounds(src image.Rectangle) image.Rectangle {
+	return n.transform(src).dstB
+}
+
+// TileSource inverse-maps the tile through the transformation matrix.
+func (n Rotate) TileSource(dst, src image.Rectangle) image.Rectangle {
+	return n.transform(src).sourceRect(dst)
+}
+
+func (n Rotate) ProcessTile(ctx context.Context, src *drawgl.FloatImage, b, rect image.Rectangle) (*drawgl.FloatImage, error) {
+	return n.transform(b).apply(ctx, src, rect, n.opts.Mask, n.opts.Channel, n.opts.Linear)
+}
+
+func (n Rotate) transform(b image.Rectangle) affineTransform {
 	rads := n.opts.Degrees * (2 * math.Pi / 360)
 
 	cos := math.Cos(rads)
@@ -80,7 +125,6 @@ func (n Rotate) Process(wd graph.WalkData, buffers map[graph.ConnectorName]drawg
 	m[1][0] = sin
 	m[1][1] = cos
 
-	b := src.Bounds()
 	var h, k float64
 	if n.opts.Center[0] != 0 {
 		h = float64(n.opts.Center[0])
@@ -94,29 +138,51 @@ func (n Rotate) Process(wd graph.WalkData, buffers map[graph.ConnectorName]drawg
 		k = n.opts.CenterPercent[1] * float64(b.Dy())
 	}
 
-	buf = src
-
 	if h != 0 || k != 0 {
 		m[0][2] = h - m[0][0]*h - m[0][1]*k
 		m[1][2] = k - m[1][0]*h - m[1][1]*k
 	}
 
-	buf = affine(transformOperation{matrix: m, interpolator: n.opts.Interpolator}, buf, n.opts.Mask, n.opts.Channel, n.opts.Linear)
+	return newAffineTransform(transformOperation{matrix: m, interpolator: n.opts.Interpolator, edge: n.opts.Edge}, b)
+}
+
+func (n Rotate) Hash() string {
+	return drawgl.HashOptions("Rotate", n.opts)
+}
+
+func (n Rotate) Definition() (string, interface{}) {
+	return "Rotate", n.opts
+}
+
+var rotateDescriptor = drawgl.Descriptor{
+	Name:    "Rotate",
+	Doc:     "Rotates the image by an arbitrary angle.",
+	Inputs:  []drawgl.ConnectorDescriptor{drawgl.MainInput()},
+	Outputs: []drawgl.ConnectorDescriptor{drawgl.MainOutput()},
+	Options: append([]drawgl.OptionDescriptor{
+		{Name: "Degrees", Type: drawgl.NumberOption, Doc: "the angle of the rotation"},
+		{
+			Name: "Center", Type: drawgl.ArrayOption, Size: 2, Items: &drawgl.OptionDescriptor{Type: drawgl.LengthOption},
+			Doc: "the center of the rotation, defaulting to the top left corner",
+		},
+		interpolator.Option(),
+		drawgl.EdgeOption(),
+	}, drawgl.CommonOptions()...),
 }
 
 func init() {
-	graph.RegisterLinker("Rotate", func(opts json.RawMessage) (graph.Linker, error) {
+	drawgl.RegisterOperation(rotateDescriptor, func(opts json.RawMessage) (graph.Linker, error) {
 		var o jsonRotateOptions
 		var err error
 
-		if err = json.Unmarshal([]byte(opts), &o); err != nil {
+		if err = drawgl.UnmarshalOptions(opts, &o); err != nil {
 			return nil, fmt.Errorf("constructing Rotate: %v", err)
 		}
 
 		if len(o.Center) == 2 {
 			for i := 0; i < 2; i++ {
 				if o.RotateOptions.Center[i], o.RotateOptions.CenterPercent[i], err =
-					drawgl.ParseLength(o.Center[i]); err != nil {
+					o.Center[i].Parse(); err != nil {
 					return nil, fmt.Errorf("constructing Rotate: parsing Center[%d]: %v", i, err)
 				}
 			}
@@ -1,16 +1,20 @@
 package transform
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"image"
 
 	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/interpolator"
 	"github.com/urandom/drawgl/operation/transform/matrix"
 	"github.com/urandom/graph"
 	"github.com/urandom/graph/base"
 )
 
+// Scale resizes the image. Like the other resampling operations, it
+// interpolates premultiplied colors and keeps the alpha mode of the input.
 type Scale struct {
 	base.Node
 
@@ -22,6 +26,7 @@ type ScaleOptions struct {
 	WidthPercent, HeightPercent float64
 	Crop                        bool
 	Interpolator                string
+	Edge                        drawgl.EdgeHandler
 	Channel                     drawgl.Channel
 	Mask                        drawgl.Mask
 	Linear                      bool
@@ -29,10 +34,14 @@ type ScaleOptions struct {
 
 type jsonScaleOptions struct {
 	ScaleOptions
-	Width, Height string
+	Width, Height drawgl.Length
 }
 
 func NewScaleLinker(opts ScaleOptions) (graph.Linker, error) {
+	if !interpolator.Valid(opts.Interpolator) {
+		return nil, fmt.Errorf("unknown interpolator %q", opts.Interpolator)
+	}
+
 	if opts.Width <= 0 && opts.Height <= 0 && opts.WidthPercent <= 0 && opts.HeightPercent <= 0 {
 		return nil, fmt.Errorf("invalid width %f and height %f, at least one has to be positive", opts.Width, opts.Height)
 	}
@@ -44,7 +53,25 @@ func NewScaleLinker(opts ScaleOptions) (graph.Linker, error) {
 	}), nil
 }
 
-func (n Scale) Process(wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+// MarshalJSON encodes the options in the form accepted by the Scale linker
+// factory, with the width and height as lengths.
+func (o ScaleOptions) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Width, Height string `json:",omitempty"`
+		Crop          bool
+		Interpolator  string `json:",omitempty"`
+		Edge          drawgl.EdgeHandler
+		Channel       drawgl.Channel
+		Mask          drawgl.Mask
+		Linear        bool
+	}{
+		drawgl.FormatLength(o.Width, o.WidthPercent),
+		drawgl.FormatLength(o.Height, o.HeightPercent),
+		o.Crop, o.Interpolator, o.Edge, o.Channel, o.Mask, o.Linear,
+	})
+}
+
+func (n Scale) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
 	var err error
 	var buf *drawgl.FloatImage
 	res := drawgl.Result{Id: n.Id()}
@@ -67,8 +94,24 @@ func (n Scale) Process(wd graph.WalkData, buffers map[graph.ConnectorName]drawgl
 		return
 	}
 
-	b := src.Bounds()
+	a := n.transform(src.Bounds())
+	buf, err = a.apply(ctx, src, a.dstB, n.opts.Mask, n.opts.Channel, n.opts.Linear)
+}
+
+func (n Scale) TileBounds(src image.Rectangle) image.Rectangle {
+	return n.transform(src).dstB
+}
+
+// TileSource inverse-maps the tile through the transformation matrix.
+func (n Scale) TileSource(dst, src image.Rectangle) image.Rectangle {
+	return n.transform(src).sourceRect(dst)
+}
+
+func (n Scale) ProcessTile(ctx context.Context, src *drawgl.FloatImage, b, rect image.Rectangle) (*drawgl.FloatImage, error) {
+	return n.transform(b).apply(ctx, src, rect, n.opts.Mask, n.opts.Channel, n.opts.Linear)
+}
 
+func (n Scale) transform(b image.Rectangle) affineTransform {
 	width, height := b.Dx(), b.Dy()
 
 	var tW, tH int
@@ -96,32 +139,55 @@ func (n Scale) Process(wd graph.WalkData, buffers map[graph.ConnectorName]drawgl
 	m[0][0] = float64(tW) / float64(b.Dx())
 	m[1][1] = float64(tH) / float64(b.Dy())
 
-	op := transformOperation{matrix: m, interpolator: n.opts.Interpolator}
+	op := transformOperation{matrix: m, interpolator: n.opts.Interpolator, edge: n.opts.Edge}
 
 	if n.opts.Crop {
 		op.dstB.Min = b.Min
 		op.dstB.Max = image.Point{X: b.Min.X + tW, Y: b.Min.Y + tH}
 	}
 
-	buf = affine(op, src, n.opts.Mask, n.opts.Channel, n.opts.Linear)
+	return newAffineTransform(op, b)
+}
+
+func (n Scale) Hash() string {
+	return drawgl.HashOptions("Scale", n.opts)
+}
+
+func (n Scale) Definition() (string, interface{}) {
+	return "Scale", n.opts
+}
+
+var scaleDescriptor = drawgl.Descriptor{
+	Name: "Scale",
+	Doc: `Resizes the image.
+When only one of the width and height is given, the other keeps the aspect ratio.`,
+	Inputs:  []drawgl.ConnectorDescriptor{drawgl.MainInput()},
+	Outputs: []drawgl.ConnectorDescriptor{drawgl.MainOutput()},
+	Options: append([]drawgl.OptionDescriptor{
+		{Name: "Width", Type: drawgl.LengthOption, Doc: "the new width"},
+		{Name: "Height", Type: drawgl.LengthOption, Doc: "the new height"},
+		{Name: "Crop", Type: drawgl.BooleanOption, Default: false, Doc: "crop the result to the new size, instead of keeping the size of the input"},
+		interpolator.Option(),
+		drawgl.EdgeOption(),
+	}, drawgl.CommonOptions()...),
 }
 
 func init() {
-	graph.RegisterLinker("Scale", func(opts json.RawMessage) (graph.Linker, error) {
+	drawgl.RegisterOperation(scaleDescriptor, func(opts json.RawMessage) (graph.Linker, error) {
 		var o jsonScaleOptions
 		var err error
 
-		if err = json.Unmarshal([]byte(opts), &o); err != nil {
+		if err = drawgl.UnmarshalOptions(opts, &o); err != nil {
 			return nil, fmt.Errorf("constructing Scale: %v", err)
 		}
 
 		if o.ScaleOptions.Width, o.ScaleOptions.WidthPercent, err =
-			drawgl.ParseLength(o.Width); err != nil {
+			o.Width.Parse(); err != nil {
 			return nil, fmt.Errorf("constructing Scale: parsing Width: %v", err)
 		}
 
 		if o.ScaleOptions.Height, o.ScaleOptions.HeightPercent, err =
-			drawgl.ParseLength(o.Height); err != nil {
+			o.Height.Parse(); err != nil {
 			return nil, fmt.Errorf("constructing Scale: parsing Height: %v", err)
 		}
 
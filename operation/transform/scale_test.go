@@ -1,11 +1,17 @@
 package transform_test
 
 import (
+	"context"
+	"image"
+	"image/draw"
 	"testing"
 
 	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/interpolator"
 	"github.com/urandom/drawgl/operation/tests"
 	"github.com/urandom/drawgl/operation/transform"
+	"github.com/urandom/drawgl/operation/transform/matrix"
+	"github.com/urandom/graph"
 )
 
 func TestScale(t *testing.T) {
@@ -22,7 +28,7 @@ func TestScale(t *testing.T) {
 	buffers := tests.ImageBuffers(t)
 	p, wd, output := tests.PrepareLinker(l)
 
-	go p.Process(wd, buffers, output)
+	go p.Process(context.Background(), wd, buffers, output)
 
 	r := <-output
 	if r.Error != nil {
@@ -45,17 +51,20 @@ func TestScale(t *testing.T) {
 	}
 }
 
+// expectedScaleResult1 holds the halved test image, each pixel blending the
+// neighbouring ones with a bilinear kernel twice as wide as the source
+// pixels.
 func expectedScaleResult1() (c [4][4]drawgl.FloatColor) {
 	c = [4][4]drawgl.FloatColor{
 		[4]drawgl.FloatColor{
-			drawgl.FloatColor{1, 1, 1, 1},
-			drawgl.FloatColor{1, 1, 0, 1},
+			drawgl.FloatColor{0.578125, 0.5625, 0.421875, 1},
+			drawgl.FloatColor{0.4684436, 0.59558827, 0.39920342, 1},
 			drawgl.FloatColor{0, 0, 0, 0},
 			drawgl.FloatColor{0, 0, 0, 0},
 		},
 		[4]drawgl.FloatColor{
-			drawgl.FloatColor{1, 1, 1, 1},
-			drawgl.FloatColor{1, 0, 1, 1},
+			drawgl.FloatColor{0.2833946, 0.3970588, 0.48866418, 1},
+			drawgl.FloatColor{0.5082721, 0.28308824, 0.5284927, 1},
 			drawgl.FloatColor{0, 0, 0, 0},
 			drawgl.FloatColor{0, 0, 0, 0},
 		},
@@ -75,3 +84,106 @@ func expectedScaleResult1() (c [4][4]drawgl.FloatColor) {
 
 	return
 }
+
+func TestScaleParallel(t *testing.T) {
+	// Parallel iterations hand out chunks of rows, so the image has to be
+	// tall enough for several goroutines to take part
+	src := tests.PatternImage(16, 1024)
+
+	for _, kind := range interpolator.Kinds {
+		var results [2]*drawgl.FloatImage
+		for i, linear := range []bool{true, false} {
+			l, err := transform.NewScaleLinker(transform.ScaleOptions{WidthPercent: 0.4, HeightPercent: 0.4, Crop: true, Interpolator: kind, Linear: linear})
+			if err != nil {
+				t.Fatalf("Error creating a scale linker: %v\n", err)
+			}
+
+			p, wd, output := tests.PrepareLinker(l)
+			go p.Process(context.Background(), wd, map[graph.ConnectorName]drawgl.Result{graph.InputName: {Buffer: src}}, output)
+
+			r := <-output
+			if r.Error != nil {
+				t.Fatalf("Error processing: %v\n", r.Error)
+			}
+			results[i] = r.Buffer
+		}
+
+		b := results[0].Bounds()
+		if b != results[1].Bounds() {
+			t.Fatalf("%s: bounds %v don't match %v\n", kind, results[1].Bounds(), b)
+		}
+
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if c, e := results[1].FloatAt(x, y), results[0].FloatAt(x, y); c != e {
+					t.Fatalf("%s: at %d:%d, color %v doesn't match %v\n", kind, x, y, c, e)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkScale(b *testing.B) {
+	l, err := transform.NewScaleLinker(transform.ScaleOptions{WidthPercent: 0.5, HeightPercent: 0.5, Crop: true})
+	if err != nil {
+		b.Fatalf("Error creating a scale linker: %v\n", err)
+	}
+
+	tests.BenchmarkTiles(b, l, tests.PatternImage(512, 512))
+}
+
+func BenchmarkScaleIterate(b *testing.B) {
+	l, err := transform.NewScaleLinker(transform.ScaleOptions{WidthPercent: 0.5, HeightPercent: 0.5, Crop: true})
+	if err != nil {
+		b.Fatalf("Error creating a scale linker: %v\n", err)
+	}
+
+	tests.BenchmarkIterate(b, l, tests.PatternImage(512, 512), scaleIterate)
+}
+
+// scaleIterate halves the image like a cropping Scale does, one pixel at a
+// time, with the iterators that preceded the span ones.
+func scaleIterate(ctx context.Context, img *drawgl.FloatImage) (*drawgl.FloatImage, error) {
+	src := drawgl.ConvertAlpha(img, drawgl.Premultiplied)
+	srcB := src.Bounds()
+	var channel drawgl.Channel = drawgl.Red | drawgl.Green | drawgl.Blue
+
+	inverse := matrix.New3()
+	inverse[0][0], inverse[1][1] = 2, 2
+
+	dst := drawgl.NewFloatImage(image.Rect(srcB.Min.X, srcB.Min.Y, srcB.Min.X+srcB.Dx()/2, srcB.Min.Y+srcB.Dy()/2))
+	dst.ColorSpace, dst.Alpha = src.ColorSpace, src.Alpha
+
+	newInterpolator := interpolator.New("", src, inverse, image.Point{}, drawgl.Extend)
+
+	it := drawgl.DefaultRectangleIterator(dst.Bounds())
+	err := it.IterateWorkers(ctx, drawgl.Mask{}, func() func(pt image.Point, f float32) {
+		interpolator := newInterpolator()
+
+		return func(pt image.Point, f float32) {
+			if f == 0 {
+				return
+			}
+
+			dx := float64(pt.X) + 0.5
+			dy := float64(pt.Y) + 0.5
+
+			sx := inverse[0][0]*dx + inverse[0][1]*dy + inverse[0][2]
+			sy := inverse[1][0]*dx + inverse[1][1]*dy + inverse[1][2]
+
+			if !(image.Point{int(sx), int(sy)}).In(srcB) {
+				return
+			}
+
+			orig := src.FloatAt(pt.X, pt.Y)
+			srcC := interpolator.Get(src, sx, sy)
+
+			dst.UnsafeSetColor(pt.X, pt.Y, drawgl.MaskColor(orig, srcC, channel, f, draw.Over))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return drawgl.ConvertAlpha(dst, img.Alpha), nil
+}
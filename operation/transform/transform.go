@@ -1,6 +1,7 @@
 package transform
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,6 +15,8 @@ import (
 
 type Operator int
 
+// Transform flips or transposes the image. Pixels are moved as they are,
+// and only masked ones are blended, premultiplied.
 type Transform struct {
 	base.Node
 
@@ -45,7 +48,9 @@ func NewTransformLinker(opts TransformOptions) (graph.Linker, error) {
 		return nil, fmt.Errorf("unknown operator %d", opts.Operator)
 	}
 
-	opts.Channel = opts.Channel.Normalize()
+	// Like the other transformations, the alpha moves along with the
+	// premultiplied colors
+	opts.Channel = opts.Channel.Normalize(true)
 
 	return base.NewLinkerNode(Transform{
 		Node: base.NewNode(),
@@ -53,7 +58,7 @@ func NewTransformLinker(opts TransformOptions) (graph.Linker, error) {
 	}), nil
 }
 
-func (n Transform) Process(wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+func (n Transform) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
 	var err error
 	var buf *drawgl.FloatImage
 	res := drawgl.Result{Id: n.Id()}
@@ -76,7 +81,27 @@ func (n Transform) Process(wd graph.WalkData, buffers map[graph.ConnectorName]dr
 		return
 	}
 
-	buf = transform(n.opts.Operator, src, n.opts.Mask, n.opts.Channel, n.opts.Linear)
+	b := src.Bounds()
+	buf, err = n.ProcessTile(ctx, src, b, n.TileBounds(b))
+}
+
+func (n Transform) TileBounds(src image.Rectangle) image.Rectangle {
+	return newTransformMapping(n.opts.Operator, src).dstB
+}
+
+// TileSource returns the source region that maps to the tile. Since the
+// original color at the tile's position is also used, the tile itself is
+// included as well.
+func (n Transform) TileSource(dst, src image.Rectangle) image.Rectangle {
+	return newTransformMapping(n.opts.Operator, src).sourceRect(dst).Union(dst)
+}
+
+func (n Transform) ProcessTile(ctx context.Context, src *drawgl.FloatImage, b, rect image.Rectangle) (*drawgl.FloatImage, error) {
+	return transform(ctx, newTransformMapping(n.opts.Operator, b), src, rect, n.opts.Mask, n.opts.Channel, n.opts.Linear)
+}
+
+func (n Transform) Hash() string {
+	return drawgl.HashOptions("Transform", n.opts)
 }
 
 func (o Operator) MarshalJSON() (b []byte, err error) {
@@ -95,6 +120,8 @@ func (o Operator) MarshalJSON() (b []byte, err error) {
 		b = []byte(`"rotate-180"`)
 	case Rotate270Operator:
 		b = []byte(`"rotate-270"`)
+	default:
+		err = fmt.Errorf("unknown operator %d", o)
 	}
 	return
 }
@@ -124,87 +151,175 @@ func (o *Operator) UnmarshalJSON(b []byte) (err error) {
 	return
 }
 
-func transform(op Operator, src *drawgl.FloatImage, mask drawgl.Mask, channel drawgl.Channel, forceLinear bool) (dst *drawgl.FloatImage) {
-	srcB := src.Bounds()
-	dstB := srcB
+type transformMapping struct {
+	op               Operator
+	srcB, dstB       image.Rectangle
+	offsetX, offsetY int
+}
+
+func newTransformMapping(op Operator, srcB image.Rectangle) (m transformMapping) {
+	m.op = op
+	m.srcB = srcB
+	m.dstB = srcB
 
 	switch op {
 	case TransposeOperator, TransverseOperator, Rotate90Operator, Rotate270Operator:
-		dstB = image.Rect(srcB.Min.Y, srcB.Min.X, srcB.Max.Y, srcB.Max.X)
+		m.dstB = image.Rect(srcB.Min.Y, srcB.Min.X, srcB.Max.Y, srcB.Max.X)
 	}
 
-	var offsetX, offsetY int
+	dstB := m.dstB
 
 	switch op {
 	case FlipHOperator:
-		offsetX = srcB.Min.X + srcB.Max.X - 1
+		m.offsetX = srcB.Min.X + srcB.Max.X - 1
 	case FlipVOperator:
-		offsetY = srcB.Min.Y + srcB.Max.Y - 1
+		m.offsetY = srcB.Min.Y + srcB.Max.Y - 1
 	case TransposeOperator:
-		offsetX = dstB.Min.X - srcB.Min.Y
-		offsetY = dstB.Min.Y - srcB.Min.X
+		m.offsetX = dstB.Min.X - srcB.Min.Y
+		m.offsetY = dstB.Min.Y - srcB.Min.X
 	case TransverseOperator:
-		offsetX = dstB.Min.Y + srcB.Max.Y - 1
-		offsetY = dstB.Min.X + srcB.Max.X - 1
+		m.offsetX = dstB.Min.Y + srcB.Max.Y - 1
+		m.offsetY = dstB.Min.X + srcB.Max.X - 1
 	case Rotate90Operator:
-		offsetX = dstB.Min.X + srcB.Max.Y - 1
-		offsetY = dstB.Min.Y - srcB.Min.X
+		m.offsetX = dstB.Min.X + srcB.Max.Y - 1
+		m.offsetY = dstB.Min.Y - srcB.Min.X
 	case Rotate180Operator:
-		offsetX = dstB.Min.X + srcB.Max.X - 1
-		offsetY = dstB.Min.Y + srcB.Max.Y - 1
+		m.offsetX = dstB.Min.X + srcB.Max.X - 1
+		m.offsetY = dstB.Min.Y + srcB.Max.Y - 1
 	case Rotate270Operator:
-		offsetX = dstB.Min.X - srcB.Min.Y
-		offsetY = dstB.Min.Y + srcB.Max.X - 1
+		m.offsetX = dstB.Min.X - srcB.Min.Y
+		m.offsetY = dstB.Min.Y + srcB.Max.X - 1
 	}
 
-	dst = drawgl.NewFloatImage(dstB)
+	return
+}
 
-	it := drawgl.DefaultRectangleIterator(srcB, forceLinear)
+// forward maps a source point to its destination
+func (m transformMapping) forward(x, y int) (px, py int) {
+	switch m.op {
+	case FlipHOperator:
+		px, py = m.offsetX-x, y
+	case FlipVOperator:
+		px, py = x, m.offsetY-y
+	case TransposeOperator:
+		px, py = m.offsetX+y, m.offsetY+x
+	case TransverseOperator:
+		px, py = m.offsetX-y, m.offsetY-x
+	case Rotate90Operator:
+		px, py = m.offsetX-y, m.offsetY+x
+	case Rotate180Operator:
+		px, py = m.offsetX-x, m.offsetY-y
+	case Rotate270Operator:
+		px, py = m.offsetX+y, m.offsetY-x
+	}
 
-	it.Iterate(mask, func(pt image.Point, f float32) {
-		if f == 0 {
-			return
-		}
+	return
+}
 
-		var px, py int
-
-		switch op {
-		case FlipHOperator:
-			px, py = offsetX-pt.X, pt.Y
-		case FlipVOperator:
-			px, py = pt.X, offsetY-pt.Y
-		case TransposeOperator:
-			px, py = offsetX+pt.Y, offsetY+pt.X
-		case TransverseOperator:
-			px, py = offsetX-pt.Y, offsetY-pt.X
-		case Rotate90Operator:
-			px, py = offsetX-pt.Y, offsetY+pt.X
-		case Rotate180Operator:
-			px, py = offsetX-pt.X, offsetY-pt.Y
-		case Rotate270Operator:
-			px, py = offsetX+pt.Y, offsetY-pt.X
-		}
+// inverse maps a destination point back to its source
+func (m transformMapping) inverse(px, py int) (x, y int) {
+	switch m.op {
+	case FlipHOperator:
+		x, y = m.offsetX-px, py
+	case FlipVOperator:
+		x, y = px, m.offsetY-py
+	case TransposeOperator:
+		x, y = py-m.offsetY, px-m.offsetX
+	case TransverseOperator:
+		x, y = m.offsetY-py, m.offsetX-px
+	case Rotate90Operator:
+		x, y = py-m.offsetY, m.offsetX-px
+	case Rotate180Operator:
+		x, y = m.offsetX-px, m.offsetY-py
+	case Rotate270Operator:
+		x, y = m.offsetY-py, px-m.offsetX
+	}
 
-		srcColor := src.UnsafeFloatAt(pt.X, pt.Y)
+	return
+}
+
+// sourceRect returns the source rectangle that maps to the given destination
+// rectangle
+func (m transformMapping) sourceRect(dst image.Rectangle) image.Rectangle {
+	if dst.Empty() {
+		return image.Rectangle{}
+	}
+
+	x0, y0 := m.inverse(dst.Min.X, dst.Min.Y)
+	x1, y1 := m.inverse(dst.Max.X-1, dst.Max.Y-1)
+
+	r := image.Rect(x0, y0, x1, y1)
+	r.Max = r.Max.Add(image.Pt(1, 1))
+
+	return r
+}
 
-		var dstColor drawgl.FloatColor
-		if srcB == dstB || (image.Point{px, py}.In(src.Rect)) {
-			dstColor = src.UnsafeFloatAt(px, py)
-		} else {
-			dstColor = drawgl.FloatColor{A: 1}
+// transform produces the given rectangle of the transformed image. Masked
+// pixels are blended premultiplied, so images with straight alpha are
+// converted for the duration.
+func transform(ctx context.Context, m transformMapping, src *drawgl.FloatImage, rect image.Rectangle, mask drawgl.Mask, channel drawgl.Channel, forceLinear bool) (dst *drawgl.FloatImage, err error) {
+	if src.Alpha == drawgl.Straight {
+		if dst, err = transform(ctx, m, drawgl.ConvertAlpha(src, drawgl.Premultiplied), rect, mask, channel, forceLinear); err == nil {
+			dst = drawgl.ConvertAlpha(dst, drawgl.Straight)
 		}
+		return
+	}
+
+	dst = drawgl.NewFloatImage(rect)
+	dst.ColorSpace, dst.Alpha = src.ColorSpace, src.Alpha
+
+	it := drawgl.DefaultRectangleIterator(m.sourceRect(rect).Intersect(m.srcB), forceLinear)
+
+	// The spans hold the source pixels, which are scattered into the
+	// destination
+	err = it.IterateSpans(ctx, src, mask, func(s drawgl.Span) {
+		for i, x := 0, s.Min; x < s.Max; i, x = i+1, x+1 {
+			f := s.Factor(i)
+			if f == 0 {
+				continue
+			}
+
+			px, py := m.forward(x, s.Y)
+
+			srcColor := s.At(i)
 
-		dst.UnsafeSetColor(px, py, drawgl.MaskColor(dstColor, srcColor, channel, f, draw.Over))
+			var dstColor drawgl.FloatColor
+			if m.srcB == m.dstB || (image.Point{px, py}.In(m.srcB)) {
+				dstColor = src.UnsafeFloatAt(px, py)
+			} else {
+				dstColor = drawgl.FloatColor{A: 1}
+			}
+
+			dst.UnsafeSetColor(px, py, drawgl.MaskColor(dstColor, srcColor, channel, f, draw.Over))
+		}
 	})
 
 	return
 }
 
+func (n Transform) Definition() (string, interface{}) {
+	return "Transform", n.opts
+}
+
+var transformDescriptor = drawgl.Descriptor{
+	Name:    "Transform",
+	Doc:     "Flips, transposes or rotates the image by a multiple of 90 degrees.",
+	Inputs:  []drawgl.ConnectorDescriptor{drawgl.MainInput()},
+	Outputs: []drawgl.ConnectorDescriptor{drawgl.MainOutput()},
+	Options: append([]drawgl.OptionDescriptor{
+		{
+			Name: "Operator", Type: drawgl.StringOption, Required: true,
+			Enum: []string{"flip-horizontal", "flip-vertical", "transpose", "transverse", "rotate-90", "rotate-180", "rotate-270"},
+			Doc:  "the transformation",
+		},
+	}, drawgl.CommonOptions()...),
+}
+
 func init() {
-	graph.RegisterLinker("Transform", func(opts json.RawMessage) (graph.Linker, error) {
+	drawgl.RegisterOperation(transformDescriptor, func(opts json.RawMessage) (graph.Linker, error) {
 		var o TransformOptions
 
-		if err := json.Unmarshal([]byte(opts), &o); err != nil {
+		if err := drawgl.UnmarshalOptions(opts, &o); err != nil {
 			return nil, fmt.Errorf("constructing Transform: %v", err)
 		}
 
@@ -1,6 +1,7 @@
 package transform_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/urandom/drawgl"
@@ -29,7 +30,7 @@ func TestTransformFlipH(t *testing.T) {
 	buffers := tests.ImageBuffers(t)
 	p, wd, output := tests.PrepareLinker(l)
 
-	go p.Process(wd, buffers, output)
+	go p.Process(context.Background(), wd, buffers, output)
 
 	r := <-output
 	if r.Error != nil {
@@ -92,7 +93,7 @@ func TestTransformFlipV(t *testing.T) {
 	buffers := tests.ImageBuffers(t)
 	p, wd, output := tests.PrepareLinker(l)
 
-	go p.Process(wd, buffers, output)
+	go p.Process(context.Background(), wd, buffers, output)
 
 	r := <-output
 	if r.Error != nil {
@@ -155,7 +156,7 @@ func TestTransformTranspose(t *testing.T) {
 	buffers := tests.ImageBuffers(t)
 	p, wd, output := tests.PrepareLinker(l)
 
-	go p.Process(wd, buffers, output)
+	go p.Process(context.Background(), wd, buffers, output)
 
 	r := <-output
 	if r.Error != nil {
@@ -218,7 +219,7 @@ func TestTransformTransverse(t *testing.T) {
 	buffers := tests.ImageBuffers(t)
 	p, wd, output := tests.PrepareLinker(l)
 
-	go p.Process(wd, buffers, output)
+	go p.Process(context.Background(), wd, buffers, output)
 
 	r := <-output
 	if r.Error != nil {
@@ -281,7 +282,7 @@ func TestTransformRotate90(t *testing.T) {
 	buffers := tests.ImageBuffers(t)
 	p, wd, output := tests.PrepareLinker(l)
 
-	go p.Process(wd, buffers, output)
+	go p.Process(context.Background(), wd, buffers, output)
 
 	r := <-output
 	if r.Error != nil {
@@ -344,7 +345,7 @@ func TestTransformRotate180(t *testing.T) {
 	buffers := tests.ImageBuffers(t)
 	p, wd, output := tests.PrepareLinker(l)
 
-	go p.Process(wd, buffers, output)
+	go p.Process(context.Background(), wd, buffers, output)
 
 	r := <-output
 	if r.Error != nil {
@@ -407,7 +408,7 @@ func TestTransformRotate270(t *testing.T) {
 	buffers := tests.ImageBuffers(t)
 	p, wd, output := tests.PrepareLinker(l)
 
-	go p.Process(wd, buffers, output)
+	go p.Process(context.Background(), wd, buffers, output)
 
 	r := <-output
 	if r.Error != nil {
@@ -460,3 +461,12 @@ func expectedTransformRotate270Result() (c [4][4]drawgl.FloatColor) {
 
 	return
 }
+
+func BenchmarkTransform(b *testing.B) {
+	l, err := transform.NewTransformLinker(transform.TransformOptions{Operator: transform.Rotate90Operator})
+	if err != nil {
+		b.Fatalf("Error creating a transform linker: %v\n", err)
+	}
+
+	tests.BenchmarkTiles(b, l, tests.PatternImage(512, 512))
+}
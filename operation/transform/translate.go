@@ -1,15 +1,20 @@
 package transform
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"image"
 
 	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/interpolator"
 	"github.com/urandom/drawgl/operation/transform/matrix"
 	"github.com/urandom/graph"
 	"github.com/urandom/graph/base"
 )
 
+// Translate shifts the image. Fractional offsets are interpolated, on
+// premultiplied colors, keeping the alpha mode of the input.
 type Translate struct {
 	base.Node
 
@@ -20,6 +25,7 @@ type TranslateOptions struct {
 	Offset        [2]int
 	OffsetPercent [2]float64
 	Interpolator  string
+	Edge          drawgl.EdgeHandler
 	Channel       drawgl.Channel
 	Mask          drawgl.Mask
 	Linear        bool
@@ -27,10 +33,14 @@ type TranslateOptions struct {
 
 type jsonTranslateOptions struct {
 	TranslateOptions
-	Offset [2]string
+	Offset [2]drawgl.Length
 }
 
 func NewTranslateLinker(opts TranslateOptions) (graph.Linker, error) {
+	if !interpolator.Valid(opts.Interpolator) {
+		return nil, fmt.Errorf("unknown interpolator %q", opts.Interpolator)
+	}
+
 	opts.Channel = opts.Channel.Normalize(true)
 
 	return base.NewLinkerNode(Translate{
@@ -39,7 +49,23 @@ func NewTranslateLinker(opts TranslateOptions) (graph.Linker, error) {
 	}), nil
 }
 
-func (n Translate) Process(wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+// MarshalJSON encodes the options in the form accepted by the Translate
+// linker factory, with the offset as a pair of lengths.
+func (o TranslateOptions) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Offset       []string `json:",omitempty"`
+		Interpolator string   `json:",omitempty"`
+		Edge         drawgl.EdgeHandler
+		Channel      drawgl.Channel
+		Mask         drawgl.Mask
+		Linear       bool
+	}{
+		formatPoint(o.Offset, o.OffsetPercent),
+		o.Interpolator, o.Edge, o.Channel, o.Mask, o.Linear,
+	})
+}
+
+func (n Translate) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
 	var err error
 	var buf *drawgl.FloatImage
 	res := drawgl.Result{Id: n.Id()}
@@ -68,8 +94,25 @@ func (n Translate) Process(wd graph.WalkData, buffers map[graph.ConnectorName]dr
 		return
 	}
 
+	a := n.transform(src.Bounds())
+	buf, err = a.apply(ctx, src, a.dstB, n.opts.Mask, n.opts.Channel, n.opts.Linear)
+}
+
+func (n Translate) TileBounds(src image.Rectangle) image.Rectangle {
+	return n.transform(src).dstB
+}
+
+// TileSource inverse-maps the tile through the transformation matrix.
+func (n Translate) TileSource(dst, src image.Rectangle) image.Rectangle {
+	return n.transform(src).sourceRect(dst)
+}
+
+func (n Translate) ProcessTile(ctx context.Context, src *drawgl.FloatImage, b, rect image.Rectangle) (*drawgl.FloatImage, error) {
+	return n.transform(b).apply(ctx, src, rect, n.opts.Mask, n.opts.Channel, n.opts.Linear)
+}
+
+func (n Translate) transform(b image.Rectangle) affineTransform {
 	m := matrix.New3()
-	b := src.Bounds()
 	if n.opts.Offset[0] != 0 {
 		m[0][2] = float64(n.opts.Offset[0])
 	} else if n.opts.OffsetPercent[0] != 0 {
@@ -82,22 +125,45 @@ func (n Translate) Process(wd graph.WalkData, buffers map[graph.ConnectorName]dr
 		m[1][2] = n.opts.OffsetPercent[1] * float64(b.Dy())
 	}
 
-	buf = affine(transformOperation{matrix: m, interpolator: n.opts.Interpolator}, src, n.opts.Mask, n.opts.Channel, n.opts.Linear)
+	return newAffineTransform(transformOperation{matrix: m, interpolator: n.opts.Interpolator, edge: n.opts.Edge}, b)
+}
+
+func (n Translate) Hash() string {
+	return drawgl.HashOptions("Translate", n.opts)
+}
+
+func (n Translate) Definition() (string, interface{}) {
+	return "Translate", n.opts
+}
+
+var translateDescriptor = drawgl.Descriptor{
+	Name:    "Translate",
+	Doc:     "Moves the image by an offset.",
+	Inputs:  []drawgl.ConnectorDescriptor{drawgl.MainInput()},
+	Outputs: []drawgl.ConnectorDescriptor{drawgl.MainOutput()},
+	Options: append([]drawgl.OptionDescriptor{
+		{
+			Name: "Offset", Type: drawgl.ArrayOption, Size: 2, Items: &drawgl.OptionDescriptor{Type: drawgl.LengthOption},
+			Doc: "the horizontal and vertical offset",
+		},
+		interpolator.Option(),
+		drawgl.EdgeOption(),
+	}, drawgl.CommonOptions()...),
 }
 
 func init() {
-	graph.RegisterLinker("Translate", func(opts json.RawMessage) (graph.Linker, error) {
+	drawgl.RegisterOperation(translateDescriptor, func(opts json.RawMessage) (graph.Linker, error) {
 		var o jsonTranslateOptions
 		var err error
 
-		if err = json.Unmarshal([]byte(opts), &o); err != nil {
+		if err = drawgl.UnmarshalOptions(opts, &o); err != nil {
 			return nil, fmt.Errorf("constructing Translate: %v", err)
 		}
 
 		if len(o.Offset) == 2 {
 			for i := 0; i < 2; i++ {
 				if o.TranslateOptions.Offset[i], o.TranslateOptions.OffsetPercent[i], err =
-					drawgl.ParseLength(o.Offset[i]); err != nil {
+					o.Offset[i].Parse(); err != nil {
 					return nil, fmt.Errorf("constructing Translate: parsing Offset[%d]: %v", i, err)
 				}
 			}
@@ -0,0 +1,79 @@
+package drawgl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Override replaces an option of the nodes in a JSON graph definition. The
+// target is matched against the Id of each node, as well as its Name.
+type Override struct {
+	Target string
+	Option string
+	Value  string
+	// Optional overrides are not reported when no node matches them
+	Optional bool
+}
+
+// ParseOverride parses an override in the form Target.Option=Value, such as
+// Scale.Width=50%.
+func ParseOverride(s string) (Override, error) {
+	i := strings.Index(s, "=")
+	if i == -1 {
+		return Override{}, fmt.Errorf("invalid override %q, expected Target.Option=Value", s)
+	}
+
+	key, value := s[:i], s[i+1:]
+	j := strings.LastIndex(key, ".")
+	if j <= 0 || j == len(key)-1 {
+		return Override{}, fmt.Errorf("invalid override %q, expected Target.Option=Value", s)
+	}
+
+	return Override{Target: key[:j], Option: key[j+1:], Value: value}, nil
+}
+
+func (o Override) String() string {
+	return fmt.Sprintf("%s.%s=%s", o.Target, o.Option, o.Value)
+}
+
+// applyOverrides returns the options of the node, with the matching
+// overrides applied. A value that is valid JSON replaces an option that is
+// not a string as is, and is otherwise used as a JSON string.
+func (d *document) applyOverrides(n jsonNode) (json.RawMessage, error) {
+	var options map[string]json.RawMessage
+
+	for i, o := range d.overrides {
+		if o.Target != n.Id && o.Target != n.Name {
+			continue
+		}
+		d.used[i] = true
+
+		if options == nil {
+			options = make(map[string]json.RawMessage)
+			if len(n.Options) > 0 && string(n.Options) != "null" {
+				if err := json.Unmarshal(n.Options, &options); err != nil {
+					return nil, fmt.Errorf("overriding %s: %v", o, err)
+				}
+			}
+		}
+
+		current := bytes.TrimSpace(options[o.Option])
+		if json.Valid([]byte(o.Value)) && (len(current) == 0 || current[0] != '"') {
+			options[o.Option] = json.RawMessage(o.Value)
+		} else {
+			b, err := json.Marshal(o.Value)
+			if err != nil {
+				return nil, err
+			}
+			options[o.Option] = b
+		}
+	}
+
+	if options == nil {
+		return n.Options, nil
+	}
+
+	return json.Marshal(options)
+}
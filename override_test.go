@@ -0,0 +1,182 @@
+package drawgl_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/operation/tests"
+	"github.com/urandom/graph"
+	"github.com/urandom/graph/base"
+)
+
+func TestParseOverride(t *testing.T) {
+	o, err := drawgl.ParseOverride("Scale.Width=50%")
+	if err != nil {
+		t.Fatalf("Error parsing override: %v\n", err)
+	}
+
+	if o != (drawgl.Override{Target: "Scale", Option: "Width", Value: "50%"}) {
+		t.Fatalf("Unexpected override %#v\n", o)
+	}
+
+	for _, s := range []string{"Scale", "Width=50%", ".Width=50%", "Scale.=50%"} {
+		if _, err := drawgl.ParseOverride(s); err == nil {
+			t.Fatalf("Expected an error for %q\n", s)
+		}
+	}
+}
+
+func TestProcessJSONExpressions(t *testing.T) {
+	in := filepath.Join(tests.TestDataDir(), "test.png")
+	out := filepath.Join(t.TempDir(), "out.png")
+
+	def := fmt.Sprintf(`{
+		"Name": "Load",
+		"Options": {"Path": %q},
+		"Outputs": {
+			"Output": {
+				"Id": "half",
+				"Name": "Scale",
+				"Options": {"Width": "=input.width / 2", "Height": "=(input.height + 1) / 3", "Crop": true},
+				"Outputs": {
+					"Output": {"Name": "Save", "Options": {"Path": "placeholder"}}
+				}
+			}
+		}
+	}`, in)
+
+	roots, err := drawgl.ProcessJSON(strings.NewReader(def), nil, drawgl.Override{Target: "Save", Option: "Path", Value: out})
+	if err != nil {
+		t.Fatalf("Error reading graph: %v\n", err)
+	}
+
+	g := drawgl.Graph{}
+	if err := g.Process(roots[0]); err != nil {
+		t.Fatalf("Error processing graph: %v\n", err)
+	}
+
+	src, dst := decodeConfig(t, in), decodeConfig(t, out)
+	width := int(math.Round(float64(src.Width) / 2))
+	height := int(math.Round(float64(src.Height+1) / 3))
+	if dst.Width != width || dst.Height != height {
+		t.Fatalf("Expected %dx%d from %dx%d, got %dx%d\n",
+			width, height, src.Width, src.Height, dst.Width, dst.Height)
+	}
+
+	// Overrides may replace expressions, and are matched against ids
+	roots, err = drawgl.ProcessJSON(strings.NewReader(def), nil,
+		drawgl.Override{Target: "half", Option: "Width", Value: "10"},
+		drawgl.Override{Target: "half", Option: "Height", Value: "=meta.missing"},
+		drawgl.Override{Target: "Save", Option: "Path", Value: out},
+	)
+	if err != nil {
+		t.Fatalf("Error reading graph: %v\n", err)
+	}
+
+	err = g.Process(roots[0])
+
+	var nerr *drawgl.NodeError
+	if !errors.As(err, &nerr) || nerr.Name != "Scale" || !strings.Contains(err.Error(), "no metadata") {
+		t.Fatalf("Expected a Scale error about missing metadata, got %v\n", err)
+	}
+}
+
+func TestProcessJSONLiteralOptions(t *testing.T) {
+	in := filepath.Join(tests.TestDataDir(), "test.png")
+	t.Chdir(t.TempDir())
+
+	// Without the expression prefix, values that would parse as expressions
+	// are used as they are
+	for _, out := range []string{"meta.png", "input.x"} {
+		def := fmt.Sprintf(`{
+			"Name": "Load",
+			"Options": {"Path": %q},
+			"Outputs": {
+				"Output": {"Name": "Save", "Options": {"Path": %q, "Type": "png"}}
+			}
+		}`, in, out)
+
+		roots, err := drawgl.ProcessJSON(strings.NewReader(def), nil)
+		if err != nil {
+			t.Fatalf("Error reading graph: %v\n", err)
+		}
+
+		if err := (drawgl.Graph{}).Process(roots[0]); err != nil {
+			t.Fatalf("Error processing graph: %v\n", err)
+		}
+
+		if _, err := os.Stat(out); err != nil {
+			t.Fatalf("Expected %s to be saved: %v\n", out, err)
+		}
+	}
+
+	def := `{"Name": "Scale", "Options": {"Width": "=input.width /"}}`
+	if _, err := drawgl.ProcessJSON(strings.NewReader(def), nil); err == nil || !strings.Contains(err.Error(), "parsing expression") {
+		t.Fatalf("Expected an invalid expression error, got %v\n", err)
+	}
+}
+
+func TestProcessJSONDeferredFactory(t *testing.T) {
+	var calls []string
+	drawgl.RegisterLinker("testRecorded", func(opts json.RawMessage) (graph.Linker, error) {
+		calls = append(calls, string(opts))
+		return base.NewLinkerNode(base.NewNode()), nil
+	})
+
+	// The factory of a deferred node only sees the evaluated options
+	def := `{"Name": "testRecorded", "Options": {"Width": "=input.width / 2"}}`
+	if _, err := drawgl.ProcessJSON(strings.NewReader(def), nil); err != nil {
+		t.Fatalf("Error reading graph: %v\n", err)
+	}
+
+	if len(calls) != 0 {
+		t.Fatalf("Expected no factory calls for a deferred node, got %q\n", calls)
+	}
+
+	def = `{"Name": "testRecorded", "Options": {"Width": 10}}`
+	if _, err := drawgl.ProcessJSON(strings.NewReader(def), nil); err != nil {
+		t.Fatalf("Error reading graph: %v\n", err)
+	}
+
+	if len(calls) != 1 || calls[0] != `{"Width": 10}` {
+		t.Fatalf("Expected a single factory call with the literal options, got %q\n", calls)
+	}
+}
+
+func TestProcessJSONOverrideErrors(t *testing.T) {
+	def := `{"Name": "BoxBlur", "Options": {"Radius": 1}}`
+
+	_, err := drawgl.ProcessJSON(strings.NewReader(def), nil, drawgl.Override{Target: "Scale", Option: "Width", Value: "50%"})
+	if err == nil || !strings.Contains(err.Error(), "no node matches") {
+		t.Fatalf("Expected an unmatched override error, got %v\n", err)
+	}
+
+	_, err = drawgl.ProcessJSON(strings.NewReader(def), nil, drawgl.Override{Target: "BoxBlur", Option: "Radius", Value: "-1"})
+	if err == nil {
+		t.Fatalf("Expected an invalid radius error\n")
+	}
+}
+
+func decodeConfig(t *testing.T, path string) image.Config {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Error opening %s: %v\n", path, err)
+	}
+	defer f.Close()
+
+	c, _, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatalf("Error decoding %s: %v\n", path, err)
+	}
+
+	return c
+}
@@ -0,0 +1,98 @@
+package drawgl
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// workers is the pool of goroutines shared by every parallel iteration. It
+// is started lazily, with one goroutine less than GOMAXPROCS, since the
+// goroutine that requests the work always takes part in it.
+var workers struct {
+	once  sync.Once
+	tasks chan func()
+}
+
+// iterateChunk is the number of rows or columns that a parallel iteration
+// hands out to a goroutine at a time.
+const iterateChunk = 200
+
+func workerTasks() chan func() {
+	workers.once.Do(func() {
+		workers.tasks = make(chan func())
+
+		for i := 1; i < runtime.GOMAXPROCS(0); i++ {
+			go func() {
+				for task := range workers.tasks {
+					task()
+				}
+			}()
+		}
+	})
+
+	return workers.tasks
+}
+
+// parallel calls fn concurrently from the calling goroutine and from up to
+// n-1 idle workers of the shared pool, and returns once all the calls have
+// returned. Since the calling goroutine always takes part, the work
+// progresses even when every worker is busy, and nested calls cannot
+// deadlock. fn is expected to consume a shared queue of work, and to return
+// once it is exhausted.
+func parallel(n int, fn func()) {
+	var wg sync.WaitGroup
+
+	tasks := workerTasks()
+	task := func() {
+		defer wg.Done()
+		fn()
+	}
+
+dispatch:
+	for i := 1; i < n; i++ {
+		wg.Add(1)
+		select {
+		case tasks <- task:
+		default:
+			// No idle workers
+			wg.Done()
+			break dispatch
+		}
+	}
+
+	fn()
+	wg.Wait()
+}
+
+// spans hands out consecutive chunks of a range to concurrent callers.
+type spans struct {
+	taken    int64
+	min, max int
+	size     int
+}
+
+func newSpans(min, max, size int) *spans {
+	return &spans{min: min, max: max, size: size}
+}
+
+// next returns the bounds of the next chunk, or false if the range is
+// exhausted or the context is done.
+func (s *spans) next(ctx context.Context) (start, end int, ok bool) {
+	if ctx.Err() != nil {
+		return 0, 0, false
+	}
+
+	start = s.min + int(atomic.AddInt64(&s.taken, 1)-1)*s.size
+	if start >= s.max {
+		return 0, 0, false
+	}
+
+	end = start + s.size
+	if end > s.max {
+		end = s.max
+	}
+
+	return start, end, true
+}
@@ -0,0 +1,103 @@
+package drawgl
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/urandom/graph"
+)
+
+// LinkerFactory constructs a linker from its JSON options.
+type LinkerFactory func(opts json.RawMessage) (graph.Linker, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]LinkerFactory)
+	descriptors = make(map[string]Descriptor)
+)
+
+// RegisterLinker registers a linker factory under the given name with the
+// graph package, so that it may be used in graph definitions. The factory is
+// also retained, so that graph definitions can be validated without being
+// processed.
+func RegisterLinker(name string, factory LinkerFactory) {
+	factoriesMu.Lock()
+	factories[name] = factory
+	factoriesMu.Unlock()
+
+	graph.RegisterLinker(name, func(opts json.RawMessage) (graph.Linker, error) {
+		return factory(opts)
+	})
+}
+
+// RegisterOperation registers a linker factory under the name of the
+// descriptor, as RegisterLinker does, keeping the descriptor for Describe.
+func RegisterOperation(d Descriptor, factory LinkerFactory) {
+	factoriesMu.Lock()
+	descriptors[d.Name] = d
+	factoriesMu.Unlock()
+
+	RegisterLinker(d.Name, factory)
+}
+
+// Describe returns the descriptor of the operation registered under the
+// given name. Linkers registered without one are not described.
+func Describe(name string) (Descriptor, bool) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	d, ok := descriptors[name]
+	return d, ok
+}
+
+// Descriptors returns the descriptors of all registered operations, sorted
+// by name.
+func Descriptors() []Descriptor {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	list := make([]Descriptor, 0, len(descriptors))
+	for _, d := range descriptors {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
+
+// LinkerNames returns the sorted names of all registered linkers.
+func LinkerNames() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func linkerFactory(name string) (LinkerFactory, bool) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	f, ok := factories[name]
+	return f, ok
+}
+
+// UnmarshalOptions decodes the JSON options of a linker into v. Unlike
+// json.Unmarshal, fields that do not exist in v are reported as errors.
+func UnmarshalOptions(opts json.RawMessage, v interface{}) error {
+	if len(bytes.TrimSpace(opts)) == 0 {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(opts))
+	dec.DisallowUnknownFields()
+
+	return dec.Decode(v)
+}
@@ -0,0 +1,116 @@
+package drawgl
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/urandom/graph"
+)
+
+// NodeStats holds the statistics of a single processed node.
+type NodeStats struct {
+	Id   graph.Id
+	Name string
+	// Duration is the wall time from the start of the node until its result
+	// was received
+	Duration time.Duration
+	// Pixels is the number of pixels iterated over by the node, or, for
+	// nodes that do not iterate, the number of pixels of their output
+	Pixels int64
+	// Buffers is the number of image buffers allocated for the node, either
+	// by the node itself, or by the graph when copying or materializing its
+	// inputs
+	Buffers int
+	// PeakBytes estimates the memory held by the node while processing, as
+	// the size of its input buffers and its allocated buffers
+	PeakBytes int64
+	// Cached is set when the result was taken from the graph's cache
+	Cached bool
+	// Deferred is set when the node produced a deferred tile chain, whose
+	// work is accounted for in the node that required it
+	Deferred bool
+	// Skipped is set when the node was on a branch that was not taken
+	Skipped bool
+	Error   string `json:",omitempty"`
+}
+
+// Report collects the statistics of the nodes processed by a Graph. It is
+// safe for concurrent use, and may be shared by several graphs.
+type Report struct {
+	mu    sync.Mutex
+	nodes []NodeStats
+}
+
+// Nodes returns the statistics of the processed nodes, in the order they
+// finished.
+func (r *Report) Nodes() []NodeStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	nodes := make([]NodeStats, len(r.nodes))
+	copy(nodes, r.nodes)
+
+	return nodes
+}
+
+// MarshalJSON encodes the report as an array of node statistics.
+func (r *Report) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.Nodes())
+}
+
+func (r *Report) add(s NodeStats) {
+	r.mu.Lock()
+	r.nodes = append(r.nodes, s)
+	r.mu.Unlock()
+}
+
+// nodeStats computes the statistics of a finished node from the buffers it
+// received and the result it produced.
+func nodeStats(state *nodeState, r Result) NodeStats {
+	s := NodeStats{
+		Id:       state.id,
+		Name:     state.name,
+		Duration: time.Since(state.start),
+		Pixels:   state.progress.pixels(),
+		Buffers:  state.buffers,
+		Cached:   state.cached,
+		Deferred: r.tiles != nil,
+	}
+
+	if r.Error != nil {
+		s.Error = r.Error.Error()
+	}
+
+	seen := make(map[*FloatImage]bool)
+	for _, buf := range state.inputs {
+		if !seen[buf] {
+			seen[buf] = true
+			s.PeakBytes += imageSize(buf.Rect)
+		}
+	}
+	s.PeakBytes += state.bytes
+
+	outputs := []*FloatImage{r.Buffer}
+	for _, buf := range r.NamedBuffers {
+		outputs = append(outputs, buf)
+	}
+
+	for _, buf := range outputs {
+		if buf == nil || seen[buf] {
+			continue
+		}
+		seen[buf] = true
+
+		if s.Pixels == 0 && buf == r.Buffer {
+			s.Pixels = int64(buf.Rect.Dx()) * int64(buf.Rect.Dy())
+		}
+
+		if !state.cached {
+			s.Buffers++
+			s.PeakBytes += imageSize(buf.Rect)
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,53 @@
+package drawgl_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/urandom/drawgl"
+)
+
+func TestGraphReport(t *testing.T) {
+	var out bytes.Buffer
+	load := testGraph(t, &out)
+
+	report := &drawgl.Report{}
+	g := drawgl.Graph{Report: report}
+	if err := g.Process(load); err != nil {
+		t.Fatalf("Error processing graph: %v\n", err)
+	}
+
+	nodes := report.Nodes()
+	if len(nodes) != 3 {
+		t.Fatalf("Expected statistics for 3 nodes, got %d\n", len(nodes))
+	}
+
+	stats := map[string]drawgl.NodeStats{}
+	for _, s := range nodes {
+		stats[s.Name] = s
+	}
+
+	blur, ok := stats["BoxBlur"]
+	if !ok {
+		t.Fatalf("Expected statistics for the box blur node, got %v\n", nodes)
+	}
+
+	if blur.Pixels == 0 || blur.Buffers == 0 || blur.PeakBytes == 0 {
+		t.Fatalf("Expected non-zero statistics for the box blur node, got %+v\n", blur)
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("Error encoding the report: %v\n", err)
+	}
+
+	var decoded []drawgl.NodeStats
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("Error decoding the report: %v\n", err)
+	}
+
+	if len(decoded) != 3 {
+		t.Fatalf("Expected 3 encoded nodes, got %d\n", len(decoded))
+	}
+}
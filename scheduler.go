@@ -0,0 +1,100 @@
+package drawgl
+
+import (
+	"image"
+
+	"github.com/urandom/graph"
+)
+
+// scheduler holds back nodes that are ready to be processed, until the
+// number of running nodes and their estimated memory use allow them to
+// start. It is only used by the goroutine that walks the graph.
+type scheduler struct {
+	maxNodes int
+	budget   int64
+
+	running int
+	usage   int64
+	sizes   map[graph.Id]int64
+	queue   []scheduledNode
+}
+
+type scheduledNode struct {
+	id   graph.Id
+	size int64
+	run  func()
+}
+
+func newScheduler(maxNodes int, budget int64) *scheduler {
+	return &scheduler{maxNodes: maxNodes, budget: budget, sizes: make(map[graph.Id]int64)}
+}
+
+// add queues a node, with the given estimated memory use, and starts as many
+// queued nodes as the limits allow.
+func (s *scheduler) add(id graph.Id, size int64, run func()) {
+	s.queue = append(s.queue, scheduledNode{id: id, size: size, run: run})
+	s.dispatch()
+}
+
+// done marks a node as finished, and starts any queued nodes that now fit in
+// the limits. Nodes that were not added to the scheduler are ignored.
+func (s *scheduler) done(id graph.Id) {
+	size, ok := s.sizes[id]
+	if !ok {
+		return
+	}
+
+	delete(s.sizes, id)
+	s.running--
+	s.usage -= size
+
+	s.dispatch()
+}
+
+func (s *scheduler) dispatch() {
+	for len(s.queue) > 0 && s.fits(s.queue[0].size) {
+		n := s.queue[0]
+		s.queue = s.queue[1:]
+
+		s.running++
+		s.usage += n.size
+		s.sizes[n.id] = n.size
+
+		n.run()
+	}
+}
+
+// fits reports whether a node with the given estimated memory use may start.
+// The memory budget is a soft limit, and a node is always allowed to start
+// when nothing else is running.
+func (s *scheduler) fits(size int64) bool {
+	if s.running == 0 {
+		return true
+	}
+
+	if s.maxNodes > 0 && s.running >= s.maxNodes {
+		return false
+	}
+
+	return s.budget <= 0 || s.usage+size <= s.budget
+}
+
+// estimateSize estimates the memory used while processing a node, as twice
+// the size of its input buffers, accounting for the output buffer.
+func estimateSize(buffers map[graph.ConnectorName]Result) (size int64) {
+	for _, r := range buffers {
+		if r.Buffer != nil {
+			size += imageSize(r.Buffer.Rect)
+		} else if r.tiles != nil {
+			size += imageSize(r.tiles.bounds)
+		}
+	}
+
+	return 2 * size
+}
+
+// imageSize returns the number of bytes of a FloatImage with the given bounds.
+func imageSize(r image.Rectangle) int64 {
+	// Four 32-bit channels per pixel
+	return int64(r.Dx()) * int64(r.Dy()) * 16
+}
@@ -0,0 +1,66 @@
+package drawgl_test
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/graph"
+)
+
+func TestGraphMaxConcurrentNodes(t *testing.T) {
+	var out1, out2, out3 bytes.Buffer
+	roots := []graph.Linker{testGraph(t, &out1), testGraph(t, &out2), testGraph(t, &out3)}
+
+	var mu sync.Mutex
+	running, max := 0, 0
+
+	g := drawgl.Graph{MaxConcurrentNodes: 1, Observer: func(e drawgl.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch e.Kind {
+		case drawgl.NodeStarted:
+			running++
+			if running > max {
+				max = running
+			}
+		case drawgl.NodeFinished, drawgl.NodeFailed:
+			running--
+		}
+	}}
+
+	for i, err := range g.ProcessRoots(context.Background(), roots...) {
+		if err != nil {
+			t.Fatalf("Error processing root %d: %v\n", i, err)
+		}
+	}
+
+	if max != 1 {
+		t.Fatalf("Expected at most 1 running node, got %d\n", max)
+	}
+
+	if out1.Len() == 0 || out2.Len() == 0 || out3.Len() == 0 {
+		t.Fatalf("Expected all images to be saved\n")
+	}
+}
+
+func TestGraphMemoryBudget(t *testing.T) {
+	var out1, out2 bytes.Buffer
+	roots := []graph.Linker{testGraph(t, &out1), testGraph(t, &out2)}
+
+	// The budget is smaller than any buffer, yet the nodes should still be
+	// processed one at a time
+	g := drawgl.Graph{MemoryBudget: 1}
+	for i, err := range g.ProcessRoots(context.Background(), roots...) {
+		if err != nil {
+			t.Fatalf("Error processing root %d: %v\n", i, err)
+		}
+	}
+
+	if out1.Len() == 0 || out2.Len() == 0 {
+		t.Fatalf("Expected both images to be saved\n")
+	}
+}
@@ -0,0 +1,165 @@
+package drawgl
+
+import "encoding/json"
+
+type schema map[string]interface{}
+
+// JSONSchema returns a JSON Schema (draft 7) of the graph definitions read
+// by ProcessJSON, so that editors can complete and check them. The options
+// of every described operation are included, while the options of linkers
+// registered without a descriptor are left unchecked.
+func JSONSchema() ([]byte, error) {
+	names := LinkerNames()
+	descriptors := Descriptors()
+
+	defs := schema{
+		"node": schema{
+			"type":     "object",
+			"required": []string{"Name"},
+			"properties": schema{
+				"Id":      schema{"type": "string", "description": "labels the node, so that it can be referenced"},
+				"Name":    schema{"enum": names, "description": "the operation of the node"},
+				"Options": schema{"type": "object"},
+				"Outputs": schema{"type": "object", "additionalProperties": schema{"$ref": "#/definitions/outputs"}},
+				"To":      schema{"type": "string", "description": "the input of the parent the node is connected to"},
+			},
+			"additionalProperties": false,
+		},
+		"reference": schema{
+			"type":     "object",
+			"required": []string{"Ref"},
+			"properties": schema{
+				"Ref": schema{"type": "string", "description": "the Id of the referenced node"},
+				"To":  schema{"type": "string", "description": "the input of the parent the node is connected to"},
+			},
+			"additionalProperties": false,
+		},
+		"target": schema{
+			"anyOf": []schema{{"$ref": "#/definitions/node"}, {"$ref": "#/definitions/reference"}},
+		},
+		"outputs": schema{
+			"anyOf": []schema{
+				{"$ref": "#/definitions/target"},
+				{"type": "array", "items": schema{"$ref": "#/definitions/target"}},
+			},
+		},
+	}
+
+	conditions := make([]schema, 0, len(descriptors))
+	for _, d := range descriptors {
+		conditions = append(conditions, schema{
+			"if": schema{"properties": schema{"Name": schema{"const": d.Name}}},
+			"then": schema{"properties": schema{
+				"Options": optionsSchema(d.Options),
+			}},
+		})
+	}
+	defs["node"].(schema)["allOf"] = conditions
+
+	return json.MarshalIndent(schema{
+		"$schema":     "http://json-schema.org/draft-07/schema#",
+		"title":       "drawgl graph definition",
+		"definitions": defs,
+		"anyOf": []schema{
+			{"$ref": "#/definitions/node"},
+			{"type": "array", "items": schema{"$ref": "#/definitions/node"}},
+		},
+	}, "", "  ")
+}
+
+func optionsSchema(opts []OptionDescriptor) schema {
+	s := schema{"type": "object", "additionalProperties": false}
+
+	props := schema{}
+	var required []string
+	for _, o := range opts {
+		props[o.Name] = optionSchema(o)
+		if o.Required {
+			required = append(required, o.Name)
+		}
+	}
+
+	s["properties"] = props
+	if len(required) > 0 {
+		s["required"] = required
+	}
+
+	return s
+}
+
+// optionSchema returns the schema of an option. Since option values may
+// also be expressions, strings are accepted in place of numbers and
+// booleans.
+func optionSchema(o OptionDescriptor) schema {
+	var s schema
+
+	switch o.Type {
+	case StringOption, ExpressionOption:
+		s = schema{"type": "string"}
+		if len(o.Enum) > 0 {
+			s["enum"] = o.Enum
+		}
+	case IntegerOption, NumberOption, BooleanOption:
+		s = schema{"type": []string{string(o.Type), "string"}}
+	case LengthOption:
+		s = schema{"type": []string{"integer", "string"}}
+	case ChannelOption:
+		s = schema{"type": "string", "pattern": "^(RGB|R?G?B?A?)$"}
+	case EdgeHandlerOption:
+		s = schema{"oneOf": []schema{
+			{"type": "string", "enum": EdgeNames},
+			{"type": "integer", "minimum": 0, "maximum": len(legacyEdges) - 1, "deprecated": true},
+			{
+				"type": "object",
+				"properties": schema{"Constant": schema{
+					"type": "array", "items": schema{"type": "number"}, "minItems": 4, "maxItems": 4,
+				}},
+				"required":             []string{"Constant"},
+				"additionalProperties": false,
+			},
+		}}
+	case MaskOption:
+		point := schema{
+			"type":       "object",
+			"properties": schema{"X": schema{"type": "integer"}, "Y": schema{"type": "integer"}},
+		}
+		s = schema{
+			"type": []string{"object", "null"},
+			"properties": schema{"Rect": schema{
+				"type":       "object",
+				"properties": schema{"Min": point, "Max": point},
+			}},
+			"additionalProperties": false,
+		}
+	case ArrayOption:
+		s = schema{"type": "array"}
+		if o.Items != nil {
+			s["items"] = optionSchema(*o.Items)
+		}
+		if o.Size > 0 {
+			s["minItems"] = o.Size
+			s["maxItems"] = o.Size
+		}
+	case ObjectOption:
+		if len(o.Fields) > 0 {
+			s = optionsSchema(o.Fields)
+		} else {
+			s = schema{"type": "object"}
+			if o.Items != nil {
+				s["additionalProperties"] = optionSchema(*o.Items)
+			}
+		}
+	default:
+		s = schema{}
+	}
+
+	if o.Doc != "" {
+		s["description"] = o.Doc
+	}
+
+	if o.Default != nil {
+		s["default"] = o.Default
+	}
+
+	return s
+}
@@ -0,0 +1,155 @@
+package drawgl
+
+import (
+	"context"
+	"image"
+	"runtime"
+)
+
+// Span is a horizontal run of pixels, handed to the functions of span
+// iterations.
+type Span struct {
+	// Y is the row of the span, while Min and Max are its first column and
+	// the one past its last
+	Y, Min, Max int
+	// Pix holds the pixels of the span in the iterated image, four values
+	// per pixel
+	Pix []ColorValue
+	// Factors holds the mask factor of every pixel of the span, or nil if
+	// there is no mask, in which case every factor is 1
+	Factors []float32
+}
+
+// Factor returns the mask factor of the i-th pixel of the span.
+func (s Span) Factor(i int) float32 {
+	if s.Factors == nil {
+		return 1
+	}
+
+	return s.Factors[i]
+}
+
+// At returns the color of the i-th pixel of the span.
+func (s Span) At(i int) FloatColor {
+	p := s.Pix[i*4 : i*4+4 : i*4+4]
+	return FloatColor{R: p[0], G: p[1], B: p[2], A: p[3]}
+}
+
+// Set sets the color of the i-th pixel of the span.
+func (s Span) Set(i int, c FloatColor) {
+	p := s.Pix[i*4 : i*4+4 : i*4+4]
+	p[0], p[1], p[2], p[3] = c.R, c.G, c.B, c.A
+}
+
+// Empty reports whether the mask covers the whole plane with a factor of 1.
+func (m Mask) Empty() bool {
+	return !m.hasImage && !m.hasRect
+}
+
+// MaskFactors stores the mask factors of the points of row y, from column
+// min up to max, into factors, growing it if needed. It returns nil if the
+// mask is empty.
+func MaskFactors(factors []float32, y, min, max int, mask Mask) []float32 {
+	if mask.Empty() {
+		return nil
+	}
+
+	if cap(factors) < max-min {
+		factors = make([]float32, max-min)
+	}
+	factors = factors[:max-min]
+
+	if mask.hasRect && (y < mask.Rect.Min.Y || y >= mask.Rect.Max.Y) {
+		for i := range factors {
+			factors[i] = 0
+		}
+		return factors
+	}
+
+	for i := range factors {
+		x := min + i
+		switch {
+		case mask.hasRect && (x < mask.Rect.Min.X || x >= mask.Rect.Max.X):
+			factors[i] = 0
+		case mask.hasImage:
+			_, _, _, ma := mask.Image.At(x, y).RGBA()
+			factors[i] = float32(ma) / float32(m)
+		default:
+			factors[i] = 1
+		}
+	}
+
+	return factors
+}
+
+func (rect ParallelRectangleIterator) IterateSpans(ctx context.Context, img *FloatImage, mask Mask, fn func(s Span)) error {
+	return rect.IterateSpanWorkers(ctx, img, mask, func() func(s Span) { return fn })
+}
+
+func (rect ParallelRectangleIterator) IterateSpanWorkers(ctx context.Context, img *FloatImage, mask Mask, newFn func() func(s Span)) error {
+	count := runtime.GOMAXPROCS(0)
+	if count == 1 {
+		return LinearRectangleIterator(rect).IterateSpanWorkers(ctx, img, mask, newFn)
+	}
+
+	r := image.Rectangle(rect)
+
+	progress := progressFromContext(ctx)
+	progress.expect(r.Dx() * r.Dy())
+
+	rows := newSpans(r.Min.Y, r.Max.Y, iterateChunk)
+	parallel(count, func() {
+		fn := newFn()
+		var factors []float32
+
+		for {
+			start, end, ok := rows.next(ctx)
+			if !ok {
+				return
+			}
+
+			for y := start; y < end; y++ {
+				factors = MaskFactors(factors, y, r.Min.X, r.Max.X, mask)
+				fn(rowSpan(img, r, y, factors))
+			}
+			progress.advance((end - start) * r.Dx())
+		}
+	})
+
+	return ctx.Err()
+}
+
+func (rect LinearRectangleIterator) IterateSpans(ctx context.Context, img *FloatImage, mask Mask, fn func(s Span)) error {
+	r := image.Rectangle(rect)
+
+	progress := progressFromContext(ctx)
+	progress.expect(r.Dx() * r.Dy())
+
+	var factors []float32
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		factors = MaskFactors(factors, y, r.Min.X, r.Max.X, mask)
+		fn(rowSpan(img, r, y, factors))
+		progress.advance(r.Dx())
+	}
+
+	return nil
+}
+
+func (rect LinearRectangleIterator) IterateSpanWorkers(ctx context.Context, img *FloatImage, mask Mask, newFn func() func(s Span)) error {
+	return rect.IterateSpans(ctx, img, mask, newFn())
+}
+
+// rowSpan returns the span of row y of the rectangle, within the image.
+func rowSpan(img *FloatImage, r image.Rectangle, y int, factors []float32) Span {
+	s := Span{Y: y, Min: r.Min.X, Max: r.Max.X, Factors: factors}
+	if !r.Empty() {
+		i := img.PixOffset(r.Min.X, y)
+		s.Pix = img.Pix[i : i+r.Dx()*4 : i+r.Dx()*4]
+	}
+
+	return s
+}
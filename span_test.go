@@ -0,0 +1,119 @@
+package drawgl_test
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/urandom/drawgl"
+)
+
+func TestIterateSpans(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	img := drawgl.NewFloatImage(image.Rect(-3, -2, 37, 1000))
+	rect := image.Rect(-1, 0, 30, 990)
+
+	alpha := image.NewAlpha(img.Bounds())
+	for y := alpha.Rect.Min.Y; y < alpha.Rect.Max.Y; y++ {
+		for x := alpha.Rect.Min.X; x < alpha.Rect.Max.X; x++ {
+			alpha.SetAlpha(x, y, color.Alpha{uint8(x * y)})
+		}
+	}
+
+	masks := []drawgl.Mask{
+		{},
+		drawgl.NewMask(nil, image.Rect(5, 5, 20, 500)),
+		drawgl.NewMask(alpha, image.Rect(0, 0, 25, 900)),
+	}
+
+	for _, it := range []drawgl.RectangleIterator{drawgl.LinearRectangleIterator(rect), drawgl.ParallelRectangleIterator(rect)} {
+		for mi, mask := range masks {
+			var mu sync.Mutex
+			seen := make(map[int]bool)
+
+			err := it.IterateSpanWorkers(context.Background(), img, mask, func() func(s drawgl.Span) {
+				last := rect.Min.Y - 1
+
+				return func(s drawgl.Span) {
+					if s.Y <= last {
+						t.Errorf("%T, mask %d: row %d after %d\n", it, mi, s.Y, last)
+					}
+					last = s.Y
+
+					if s.Min != rect.Min.X || s.Max != rect.Max.X || len(s.Pix) != rect.Dx()*4 {
+						t.Errorf("%T, mask %d: unexpected span %d-%d with %d values\n", it, mi, s.Min, s.Max, len(s.Pix))
+					}
+
+					if mask.Empty() != (s.Factors == nil) {
+						t.Errorf("%T, mask %d: unexpected factors %v\n", it, mi, s.Factors)
+					}
+
+					for i, x := 0, s.Min; x < s.Max; i, x = i+1, x+1 {
+						if f, e := s.Factor(i), drawgl.MaskFactor(image.Pt(x, s.Y), mask); f != e {
+							t.Errorf("%T, mask %d: factor %f at %d:%d doesn't match %f\n", it, mi, f, x, s.Y, e)
+						}
+
+						s.Set(i, drawgl.FloatColor{R: drawgl.ColorValue(x), G: drawgl.ColorValue(s.Y), A: 1})
+					}
+
+					mu.Lock()
+					seen[s.Y] = true
+					mu.Unlock()
+				}
+			})
+
+			if err != nil {
+				t.Fatalf("%T: error iterating: %v\n", it, err)
+			}
+
+			if len(seen) != rect.Dy() {
+				t.Fatalf("%T, mask %d: expected %d rows, got %d\n", it, mi, rect.Dy(), len(seen))
+			}
+
+			for y := rect.Min.Y; y < rect.Max.Y; y++ {
+				for x := rect.Min.X; x < rect.Max.X; x++ {
+					if c := img.FloatAt(x, y); c.R != drawgl.ColorValue(x) || c.G != drawgl.ColorValue(y) {
+						t.Fatalf("%T: unexpected color %v at %d:%d\n", it, c, x, y)
+					}
+				}
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := drawgl.LinearRectangleIterator(rect).IterateSpans(ctx, img, drawgl.Mask{}, func(s drawgl.Span) {}); err == nil {
+		t.Fatalf("Expected a cancellation error\n")
+	}
+}
+
+func BenchmarkIterate(b *testing.B) {
+	img := drawgl.NewFloatImage(image.Rect(0, 0, 1024, 1024))
+	it := drawgl.DefaultRectangleIterator(img.Bounds())
+
+	for i := 0; i < b.N; i++ {
+		it.Iterate(context.Background(), drawgl.Mask{}, func(pt image.Point, f float32) {
+			c := img.UnsafeFloatAt(pt.X, pt.Y)
+			img.UnsafeSetColor(pt.X, pt.Y, drawgl.FloatColor{R: 1 - c.R, G: 1 - c.G, B: 1 - c.B, A: c.A * drawgl.ColorValue(f)})
+		})
+	}
+}
+
+func BenchmarkIterateSpans(b *testing.B) {
+	img := drawgl.NewFloatImage(image.Rect(0, 0, 1024, 1024))
+	it := drawgl.DefaultRectangleIterator(img.Bounds())
+
+	for i := 0; i < b.N; i++ {
+		it.IterateSpans(context.Background(), img, drawgl.Mask{}, func(s drawgl.Span) {
+			for i := 0; i < s.Max-s.Min; i++ {
+				c := s.At(i)
+				s.Set(i, drawgl.FloatColor{R: 1 - c.R, G: 1 - c.G, B: 1 - c.B, A: c.A * drawgl.ColorValue(s.Factor(i))})
+			}
+		})
+	}
+}
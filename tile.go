@@ -0,0 +1,186 @@
+package drawgl
+
+import (
+	"context"
+	"image"
+	"runtime"
+	"sync"
+)
+
+// TileProcessor is implemented by single input processors that can produce
+// any region of their output independently, given a region of their input.
+// When a graph is processed in tiles, consecutive tile processors are chained
+// together, and only the buffers of the requested tiles are allocated.
+type TileProcessor interface {
+	Processor
+
+	// TileBounds returns the bounds of the output, produced from an input
+	// with the given bounds.
+	TileBounds(src image.Rectangle) image.Rectangle
+	// TileSource returns the region of the input, with the given bounds, that
+	// is required to produce the dst region of the output. This is usually
+	// the dst region, padded by the size of the operation's neighborhood.
+	TileSource(dst, src image.Rectangle) image.Rectangle
+	// ProcessTile produces the dst region of the output. The src buffer
+	// contains the region of the input returned by TileSource, clipped to the
+	// input bounds, which are given separately. Implementations must not
+	// modify the src buffer.
+	ProcessTile(ctx context.Context, src *FloatImage, bounds, dst image.Rectangle) (*FloatImage, error)
+}
+
+// tileSource lazily produces the tiles of a node's output, by requesting the
+// necessary tiles from its own input. Only the tiles that are being processed
+// are held in memory, apart from the output of shared sources.
+type tileSource struct {
+	proc   TileProcessor
+	input  *tileSource
+	buffer *FloatImage
+	bounds image.Rectangle
+
+	// shared sources have more than one consumer. Their output is produced
+	// once, in tiles of the given size, and kept for all of them, instead
+	// of computing each tile again for every consumer.
+	shared bool
+	size   int
+	once   sync.Once
+	output *FloatImage
+	err    error
+}
+
+func bufferTileSource(buf *FloatImage) *tileSource {
+	return &tileSource{buffer: buf, bounds: buf.Bounds()}
+}
+
+func newTileSource(proc TileProcessor, input *tileSource) *tileSource {
+	return &tileSource{proc: proc, input: input, bounds: proc.TileBounds(input.bounds)}
+}
+
+// sharedTileSource is like newTileSource, for a source with more than one
+// consumer.
+func sharedTileSource(proc TileProcessor, input *tileSource, size int) *tileSource {
+	s := newTileSource(proc, input)
+	s.shared, s.size = true, size
+
+	return s
+}
+
+// tile returns the given region of the source. The returned buffer might
+// share its pixels with other buffers, and must not be modified.
+func (s *tileSource) tile(ctx context.Context, rect image.Rectangle) (*FloatImage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if s.buffer != nil {
+		return s.buffer.SubImage(rect).(*FloatImage), nil
+	}
+
+	if s.shared {
+		buf, err := s.materialize(ctx, s.size)
+		if err != nil {
+			return nil, err
+		}
+
+		return buf.SubImage(rect).(*FloatImage), nil
+	}
+
+	return s.processTile(ctx, rect)
+}
+
+// processTile produces the given region from the required region of the
+// input.
+func (s *tileSource) processTile(ctx context.Context, rect image.Rectangle) (*FloatImage, error) {
+	bounds := s.input.bounds
+	src, err := s.input.tile(ctx, s.proc.TileSource(rect, bounds).Intersect(bounds))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.proc.ProcessTile(ctx, src, bounds, rect)
+}
+
+// materialize produces the whole output of the source, one tile at a time.
+// If the size is not positive, the output is produced as a single tile. The
+// output of a shared source is produced only once, and must not be modified.
+func (s *tileSource) materialize(ctx context.Context, size int) (*FloatImage, error) {
+	if s.buffer != nil {
+		return s.buffer, nil
+	}
+
+	if !s.shared {
+		return s.produce(ctx, size)
+	}
+
+	s.once.Do(func() {
+		s.output, s.err = s.produce(ctx, size)
+	})
+
+	return s.output, s.err
+}
+
+// produce computes the output of the source, holding only the tiles that are
+// being processed by the workers besides the output itself.
+func (s *tileSource) produce(ctx context.Context, size int) (*FloatImage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if size <= 0 {
+		return s.processTile(ctx, s.bounds)
+	}
+
+	dst := NewFloatImage(s.bounds)
+
+	columns := (s.bounds.Dx() + size - 1) / size
+	rows := (s.bounds.Dy() + size - 1) / size
+	tiles := newSpans(0, columns*rows, 1)
+
+	var once, tagged sync.Once
+	var err error
+
+	parallel(runtime.GOMAXPROCS(0), func() {
+		for {
+			i, _, ok := tiles.next(ctx)
+			if !ok {
+				return
+			}
+
+			min := s.bounds.Min.Add(image.Pt(i%columns*size, i/columns*size))
+			rect := image.Rectangle{min, min.Add(image.Pt(size, size))}.Intersect(s.bounds)
+
+			t, terr := s.processTile(ctx, rect)
+			if terr != nil {
+				once.Do(func() { err = terr })
+				continue
+			}
+
+			tagged.Do(func() { dst.ColorSpace, dst.Alpha = t.ColorSpace, t.Alpha })
+			copyRect(dst, t, rect)
+		}
+	})
+
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return dst, nil
+}
+
+// copyRect copies the pixels of the given region from src to dst.
+func copyRect(dst, src *FloatImage, r image.Rectangle) {
+	r = r.Intersect(dst.Rect).Intersect(src.Rect)
+	if r.Empty() {
+		return
+	}
+
+	w := 4 * r.Dx()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i := dst.PixOffset(r.Min.X, y)
+		j := src.PixOffset(r.Min.X, y)
+		copy(dst.Pix[i:i+w], src.Pix[j:j+w])
+	}
+}
@@ -0,0 +1,267 @@
+package drawgl_test
+
+import (
+	"context"
+	"image"
+	"sync"
+	"testing"
+
+	"github.com/urandom/drawgl"
+	"github.com/urandom/drawgl/operation/convolution"
+	"github.com/urandom/drawgl/operation/io"
+	"github.com/urandom/drawgl/operation/tests"
+	"github.com/urandom/drawgl/operation/transform"
+	"github.com/urandom/graph"
+	"github.com/urandom/graph/base"
+)
+
+type captureNode struct {
+	base.Node
+	buf **drawgl.FloatImage
+}
+
+func (n captureNode) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+	*n.buf = buffers[graph.InputName].Buffer
+	output <- drawgl.Result{Id: n.Id()}
+
+	wd.Close()
+}
+
+// recordNode is a tile processor which passes its input through, and records
+// the regions it was asked to produce
+type recordNode struct {
+	base.Node
+	mu    *sync.Mutex
+	rects *[]image.Rectangle
+}
+
+func (n recordNode) Process(ctx context.Context, wd graph.WalkData, buffers map[graph.ConnectorName]drawgl.Result, output chan<- drawgl.Result) {
+	r := buffers[graph.InputName]
+	buf, _ := n.ProcessTile(ctx, r.Buffer, r.Buffer.Bounds(), r.Buffer.Bounds())
+	output <- drawgl.Result{Id: n.Id(), Buffer: buf, Meta: r.Meta}
+
+	wd.Close()
+}
+
+func (n recordNode) TileBounds(src image.Rectangle) image.Rectangle {
+	return src
+}
+
+func (n recordNode) TileSource(dst, src image.Rectangle) image.Rectangle {
+	return dst
+}
+
+func (n recordNode) ProcessTile(ctx context.Context, src *drawgl.FloatImage, b, rect image.Rectangle) (*drawgl.FloatImage, error) {
+	n.mu.Lock()
+	*n.rects = append(*n.rects, rect)
+	n.mu.Unlock()
+
+	return drawgl.CropImage(src, rect), nil
+}
+
+func TestGraphRegionOfInterest(t *testing.T) {
+	var buf *drawgl.FloatImage
+	var rects []image.Rectangle
+
+	load, err := io.NewLoadLinker(io.LoadOptions{Path: tests.TestDataDir() + "/test.png"})
+	if err != nil {
+		t.Fatalf("Error creating a load linker: %v\n", err)
+	}
+
+	blur, err := convolution.NewBoxBlurLinker(convolution.BoxBlurOptions{Radius: 1})
+	if err != nil {
+		t.Fatalf("Error creating a box blur linker: %v\n", err)
+	}
+
+	crop, err := transform.NewCropLinker(transform.CropOptions{Min: [2]int{1, 1}, Max: [2]int{2, 2}})
+	if err != nil {
+		t.Fatalf("Error creating a crop linker: %v\n", err)
+	}
+
+	record := base.NewLinkerNode(recordNode{Node: base.NewNode(), mu: new(sync.Mutex), rects: &rects})
+	capture := base.NewLinkerNode(captureNode{Node: base.NewNode(), buf: &buf})
+
+	load.Link(record)
+	record.Link(blur)
+	blur.Link(crop)
+	crop.Link(capture)
+
+	if err := (drawgl.Graph{RegionOfInterest: true}).Process(load); err != nil {
+		t.Fatalf("Error processing graph: %v\n", err)
+	}
+
+	if len(rects) != 1 || rects[0] != image.Rect(0, 0, 3, 3) {
+		t.Fatalf("Unexpected requested regions %v\n", rects)
+	}
+
+	if b := buf.Bounds(); b != image.Rect(1, 1, 2, 2) {
+		t.Fatalf("Unexpected bounds %v\n", b)
+	}
+}
+
+func TestGraphTiles(t *testing.T) {
+	var full, tiled *drawgl.FloatImage
+
+	if err := (drawgl.Graph{}).Process(tileTestGraph(t, &full)); err != nil {
+		t.Fatalf("Error processing graph: %v\n", err)
+	}
+
+	if err := (drawgl.Graph{TileSize: 3}).Process(tileTestGraph(t, &tiled)); err != nil {
+		t.Fatalf("Error processing tiled graph: %v\n", err)
+	}
+
+	if full.Bounds() != tiled.Bounds() {
+		t.Fatalf("Tiled bounds %v don't match %v\n", tiled.Bounds(), full.Bounds())
+	}
+
+	b := full.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if c, e := tiled.FloatAt(x, y), full.FloatAt(x, y); !c.ApproxEqual(e) {
+				t.Fatalf("At %d:%d, color %v doesn't match %v\n", x, y, c, e)
+			}
+		}
+	}
+}
+
+func tileTestGraph(t *testing.T, buf **drawgl.FloatImage) graph.Linker {
+	load, err := io.NewLoadLinker(io.LoadOptions{Path: tests.TestDataDir() + "/test.png"})
+	if err != nil {
+		t.Fatalf("Error creating a load linker: %v\n", err)
+	}
+
+	blur, err := convolution.NewBoxBlurLinker(convolution.BoxBlurOptions{Radius: 2})
+	if err != nil {
+		t.Fatalf("Error creating a box blur linker: %v\n", err)
+	}
+
+	kernel, err := convolution.NewKernel([]float32{0, -1, 0, -1, 5, -1, 0, -1, 0})
+	if err != nil {
+		t.Fatalf("Error creating a kernel: %v\n", err)
+	}
+
+	sharpen, err := convolution.NewConvolutionLinker(convolution.ConvolutionOptions{Kernel: kernel})
+	if err != nil {
+		t.Fatalf("Error creating a convolution linker: %v\n", err)
+	}
+
+	rotate90, err := transform.NewTransformLinker(transform.TransformOptions{Operator: transform.Rotate90Operator})
+	if err != nil {
+		t.Fatalf("Error creating a transform linker: %v\n", err)
+	}
+
+	rotate, err := transform.NewRotateLinker(transform.RotateOptions{Degrees: 30, Interpolator: "Lanczos"})
+	if err != nil {
+		t.Fatalf("Error creating a rotate linker: %v\n", err)
+	}
+
+	scale, err := transform.NewScaleLinker(transform.ScaleOptions{Width: 3, Crop: true})
+	if err != nil {
+		t.Fatalf("Error creating a scale linker: %v\n", err)
+	}
+
+	capture := base.NewLinkerNode(captureNode{Node: base.NewNode(), buf: buf})
+
+	load.Link(blur)
+	blur.Link(sharpen)
+	sharpen.Link(rotate90)
+	rotate90.Link(rotate)
+	rotate.Link(scale)
+	scale.Link(capture)
+
+	return load
+}
+
+func TestGraphTilesShared(t *testing.T) {
+	src := tests.PatternImage(32, 32)
+
+	process := func(g drawgl.Graph) (a, b *drawgl.FloatImage, rects []image.Rectangle) {
+		source := base.NewLinkerNode(sourceNode{Node: base.NewNode(), buf: src})
+		record := base.NewLinkerNode(recordNode{Node: base.NewNode(), mu: new(sync.Mutex), rects: &rects})
+		source.Link(record)
+
+		for _, buf := range []**drawgl.FloatImage{&a, &b} {
+			blur, err := convolution.NewBoxBlurLinker(convolution.BoxBlurOptions{Radius: 1})
+			if err != nil {
+				t.Fatalf("Error creating a box blur linker: %v\n", err)
+			}
+
+			record.Link(blur)
+			blur.Link(base.NewLinkerNode(captureNode{Node: base.NewNode(), buf: buf}))
+		}
+
+		if err := g.Process(source); err != nil {
+			t.Fatalf("Error processing graph: %v\n", err)
+		}
+
+		return
+	}
+
+	expA, expB, _ := process(drawgl.Graph{})
+	a, b, rects := process(drawgl.Graph{TileSize: 8})
+
+	// The output of the shared node is produced once, one tile at a time
+	if len(rects) != 16 {
+		t.Fatalf("Expected 16 tiles of the shared node, got %d: %v\n", len(rects), rects)
+	}
+
+	for _, r := range rects {
+		if r.Dx() > 8 || r.Dy() > 8 {
+			t.Fatalf("Expected tiles of at most 8x8, got %v\n", r)
+		}
+	}
+
+	for _, c := range [][2]*drawgl.FloatImage{{a, expA}, {b, expB}} {
+		bounds := c[1].Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if c, e := c[0].FloatAt(x, y), c[1].FloatAt(x, y); !c.ApproxEqual(e) {
+					t.Fatalf("At %d:%d, color %v doesn't match %v\n", x, y, c, e)
+				}
+			}
+		}
+	}
+}
+
+func TestGraphTilesBounded(t *testing.T) {
+	var buf *drawgl.FloatImage
+	var before, after []image.Rectangle
+
+	source := base.NewLinkerNode(sourceNode{Node: base.NewNode(), buf: tests.PatternImage(64, 64)})
+	first := base.NewLinkerNode(recordNode{Node: base.NewNode(), mu: new(sync.Mutex), rects: &before})
+	last := base.NewLinkerNode(recordNode{Node: base.NewNode(), mu: new(sync.Mutex), rects: &after})
+
+	blur, err := convolution.NewBoxBlurLinker(convolution.BoxBlurOptions{Radius: 2})
+	if err != nil {
+		t.Fatalf("Error creating a box blur linker: %v\n", err)
+	}
+
+	source.Link(first)
+	first.Link(blur)
+	blur.Link(last)
+	last.Link(base.NewLinkerNode(captureNode{Node: base.NewNode(), buf: &buf}))
+
+	if err := (drawgl.Graph{TileSize: 8}).Process(source); err != nil {
+		t.Fatalf("Error processing graph: %v\n", err)
+	}
+
+	if buf.Bounds() != image.Rect(0, 0, 64, 64) {
+		t.Fatalf("Unexpected bounds %v\n", buf.Bounds())
+	}
+
+	// No node of the chain allocates more than a padded tile at a time
+	for _, c := range []struct {
+		rects []image.Rectangle
+		size  int
+	}{{after, 8}, {before, 8 + 2*2}} {
+		if len(c.rects) != 64 {
+			t.Fatalf("Expected 64 tiles, got %d\n", len(c.rects))
+		}
+
+		for _, r := range c.rects {
+			if r.Dx() > c.size || r.Dy() > c.size {
+				t.Fatalf("Expected tiles of at most %dx%[1]d, got %v\n", c.size, r)
+			}
+		}
+	}
+}
@@ -1,10 +1,17 @@
 package drawgl
 
 import (
+	"encoding/json"
+	"fmt"
+	"math"
 	"strconv"
 	"strings"
 )
 
+// Length is an option value holding a length, as parsed by ParseLength. In
+// JSON, it can be given either as a string, or as a number of pixels.
+type Length string
+
 // ParseLength parses a string containing a number an an optional unit of
 // length. The supported units are '%' for a percentage, 'px' or none for a
 // pixel. It returns both pixel and percentage, as well as any possible error
@@ -28,3 +35,40 @@ func ParseLength(dimen string) (px int, percent float64, err error) {
 
 	return
 }
+
+// FormatLength formats a length as parsed by ParseLength. A non-zero
+// percentage takes precedence over the pixel value, and an empty string is
+// returned if both are zero.
+func FormatLength(px int, percent float64) string {
+	if percent != 0 {
+		return strconv.FormatFloat(percent*100, 'f', -1, 64) + "%"
+	}
+
+	if px != 0 {
+		return strconv.Itoa(px)
+	}
+
+	return ""
+}
+
+// Parse parses the length, as ParseLength does.
+func (l Length) Parse() (px int, percent float64, err error) {
+	return ParseLength(string(l))
+}
+
+func (l *Length) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*l = Length(s)
+		return nil
+	}
+
+	var f float64
+	if err := json.Unmarshal(b, &f); err != nil {
+		return fmt.Errorf("invalid length %s", b)
+	}
+
+	*l = Length(strconv.Itoa(int(math.Round(f))))
+
+	return nil
+}
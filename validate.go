@@ -0,0 +1,53 @@
+package drawgl
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/urandom/graph"
+)
+
+// ValidationError describes a problem with a single node of a JSON graph
+// definition.
+type ValidationError struct {
+	// Path identifies the node within the definition, starting from its
+	// root and following the output connectors down to the node.
+	Path string
+	Err  error
+}
+
+// NamedOutputs is implemented by nodes that provide named outputs in
+// addition to the default one.
+type NamedOutputs interface {
+	NamedOutputs() []graph.ConnectorName
+}
+
+// NamedInputs is implemented by nodes that accept inputs other than the
+// default one. The returned names replace the default input.
+type NamedInputs interface {
+	NamedInputs() []graph.ConnectorName
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateJSON checks a JSON graph definition, as accepted by ProcessJSON,
+// without processing it. Each node is constructed using its registered
+// linker factory, options that are not recognized by the node are rejected,
+// and connectors are checked against the ones provided by the nodes. A single
+// problem is returned as a *ValidationError, while multiple ones are
+// collected in Errors. The options of nodes that contain expressions are only
+// checked once the graph is processed.
+func ValidateJSON(r io.Reader, data *graph.JSONTemplateData, overrides ...Override) error {
+	doc, err := parseJSON(r, data, overrides)
+	if err != nil {
+		return err
+	}
+
+	return doc.err()
+}
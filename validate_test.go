@@ -0,0 +1,88 @@
+package drawgl_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/urandom/drawgl"
+	_ "github.com/urandom/drawgl/operation"
+	"github.com/urandom/graph"
+)
+
+func TestValidateJSON(t *testing.T) {
+	valid := `{
+		"Name": "Load",
+		"Options": {"Path": "{{ index .Args 0 }}"},
+		"Outputs": {
+			"Output": {
+				"Name": "Convolution",
+				"Options": {"Kernel": [-1, -1, -1, -1, 8, -1, -1, -1, -1], "Normalize": true},
+				"Outputs": {
+					"Output": {"Name": "Save", "Options": {"Path": "/tmp/out.png"}}
+				}
+			}
+		}
+	}`
+
+	if err := drawgl.ValidateJSON(strings.NewReader(valid), &graph.JSONTemplateData{Args: []string{"in.png"}}); err != nil {
+		t.Fatalf("Expected a valid definition, got %v\n", err)
+	}
+
+	invalid := `[{
+		"Name": "Load",
+		"Options": {},
+		"Outputs": {
+			"Output": {
+				"Name": "Convolution",
+				"Options": {"Kernel": [1, 1, 1, 1, 1, 1, 1, 1]},
+				"Outputs": {
+					"Output": {"Name": "Scale", "Options": {"Width": "10", "Interpolator": "Cubic"}}
+				}
+			}
+		}
+	}, {
+		"Name": "Load",
+		"Options": {"Path": "in.png"},
+		"Outputs": {
+			"Output": {"Name": "BoxBlur", "Options": {"Radius": 2, "Noralize": true}},
+			"Mask": {"Name": "Save", "Options": {"Path": "/tmp/out.png"}}
+		}
+	}, {
+		"Name": "Blur"
+	}]`
+
+	err := drawgl.ValidateJSON(strings.NewReader(invalid), nil)
+	if err == nil {
+		t.Fatalf("Expected an invalid definition\n")
+	}
+
+	var errs drawgl.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected multiple errors, got %v\n", err)
+	}
+
+	expected := []string{
+		"[0]Load",
+		"[0]Load/Output:Convolution",
+		"[0]Load/Output:Convolution/Output:Scale",
+		"[1]Load",
+		"[1]Load/Output:BoxBlur",
+		"[2]Blur",
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d: %v\n", len(expected), len(errs), err)
+	}
+
+	for i := range errs {
+		var verr *drawgl.ValidationError
+		if !errors.As(errs[i], &verr) {
+			t.Fatalf("Expected a validation error, got %v\n", errs[i])
+		}
+
+		if verr.Path != expected[i] {
+			t.Fatalf("Expected error path %s, got %s (%v)\n", expected[i], verr.Path, verr.Err)
+		}
+	}
+}